@@ -0,0 +1,374 @@
+package main
+
+// This file loads the configuration of spike from a YAML file, applies any SPIKE_* environment
+// variable overrides on top of it and validates the result before the bot starts
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	cmds "github.com/philflip12/spikebot/internal/commands"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultConfigPath   = "./.env/spike.yaml"
+	defaultBotTokenPath = "./.env/BotToken"
+	defaultLogLevelStr  = "info"
+	defaultDataDir      = "persistentData"
+	// the files earlier versions read the servers and channels from, next to the config file
+	legacyServerIDsFile  = "ServerIDs"
+	legacyChannelIDsFile = "ChannelIDs"
+	// the environment variables override config keys by their path in upper case, such as
+	// SPIKE_DEFAULTS_MAX_SKILL_GAP for defaults.max_skill_gap
+	envPrefix       = "SPIKE_"
+	envServerPrefix = envPrefix + "SERVER_"
+)
+
+var (
+	logLevels       = []string{"debug", "info", "warn", "error", "fatal"}
+	storageBackends = []string{cmds.JSONBackend, cmds.SQLiteBackend}
+)
+
+// Config describes everything spike needs to run
+type Config struct {
+	Token          TokenConfig    `yaml:"token"`
+	LogLevel       string         `yaml:"log_level"`
+	DataDir        string         `yaml:"data_dir"`
+	StorageBackend string         `yaml:"storage_backend"`
+	Defaults       ServerDefaults `yaml:"defaults"`
+	Servers        []ServerConfig `yaml:"servers"`
+	// whether spike serves every server it is invited to rather than only the configured servers
+	AllowAnyServer bool `yaml:"allow_any_server"`
+	// whether the commands are registered once for every server rather than on each server
+	GlobalCommands bool `yaml:"global_commands"`
+}
+
+// TokenConfig gives the bot token either directly or by the path of a file containing it
+type TokenConfig struct {
+	Value string `yaml:"value"`
+	File  string `yaml:"file"`
+}
+
+// ServerConfig describes a server spike responds to commands from. The channels spike responds in
+// are chosen on the server itself with /config channels.
+type ServerConfig struct {
+	ID string `yaml:"id"`
+	// Deprecated: the channels spike responds in until they are chosen with /config channels, which
+	// are only read the first time the server is opened
+	Channels []string       `yaml:"channels"`
+	Defaults ServerDefaults `yaml:"defaults"`
+}
+
+// ServerDefaults holds the options /teams create uses when they are not given, nil fields fall back
+// to the defaults shared by every server
+type ServerDefaults struct {
+	MaxSkillGap      *int  `yaml:"max_skill_gap"`
+	RepeatPenalty    *int  `yaml:"repeat_penalty"`
+	BalancePositions *bool `yaml:"balance_positions"`
+}
+
+// ConfigError lists every problem found in the configuration
+type ConfigError []string
+
+func (e ConfigError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n\t%s", strings.Join(e, "\n\t"))
+}
+
+// loadConfig reads the config file at path, applies the SPIKE_* overrides of env in order and
+// validates the result. A missing file is only an error if explicit is set, so that spike can be
+// configured by environment variables alone.
+func loadConfig(path string, explicit bool, env []string) (*Config, error) {
+	config := &Config{
+		LogLevel:       defaultLogLevelStr,
+		DataDir:        defaultDataDir,
+		StorageBackend: cmds.JSONBackend,
+	}
+
+	file, err := os.Open(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+	case err != nil:
+		return nil, fmt.Errorf("failed to open config file '%s': %w", path, err)
+	default:
+		defer file.Close()
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse config file '%s': %w", path, err)
+		}
+	}
+
+	var problems ConfigError
+	problems = append(problems, config.applyEnv(env)...)
+	if len(problems) == 0 && len(config.Servers) == 0 && !config.AllowAnyServer {
+		problems = append(problems, checkLegacyFiles(filepath.Dir(path))...)
+	}
+	if len(problems) == 0 {
+		problems = append(problems, config.validate()...)
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return config, nil
+}
+
+// checkLegacyFiles returns a problem explaining how to move the servers and channels listed in the
+// files read by earlier versions into the config file, if they are in dir
+func checkLegacyFiles(dir string) []string {
+	serversPath := filepath.Join(dir, legacyServerIDsFile)
+	serverIDs, err := readLegacyIDs(serversPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("servers: failed to read '%s': %s", serversPath, err)}
+	}
+	channelsPath := filepath.Join(dir, legacyChannelIDsFile)
+	channelIDs, err := readLegacyIDs(channelsPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return []string{fmt.Sprintf("servers: failed to read '%s': %s", channelsPath, err)}
+	}
+
+	servers := ""
+	for _, serverID := range serverIDs {
+		servers = fmt.Sprintf("%s\n\t  - id: \"%s\"", servers, serverID)
+		if len(channelIDs) > 0 {
+			servers = fmt.Sprintf("%s\n\t    channels: [\"%s\"]", servers, strings.Join(channelIDs, "\", \""))
+		}
+	}
+	return []string{fmt.Sprintf("servers: '%s' and '%s' are no longer read, move their IDs into the config "+
+		"file and delete them:\n\tservers:%s", serversPath, channelsPath, servers)}
+}
+
+// readLegacyIDs returns the IDs listed one per line in the file
+func readLegacyIDs(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// applyEnv overrides the config with the SPIKE_* variables of env, returning a problem for each
+// variable which could not be applied
+func (c *Config) applyEnv(env []string) []string {
+	var problems []string
+	for _, entry := range env {
+		key, value, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(key, envPrefix) {
+			continue
+		}
+
+		var err error
+		switch key {
+		case envPrefix + "CONFIG":
+			// already used to find the config file
+		case envPrefix + "TOKEN":
+			c.Token = TokenConfig{Value: value}
+		case envPrefix + "TOKEN_FILE":
+			c.Token = TokenConfig{File: value}
+		case envPrefix + "LOG_LEVEL":
+			c.LogLevel = value
+		case envPrefix + "DATA_DIR":
+			c.DataDir = value
+		case envPrefix + "STORAGE_BACKEND":
+			c.StorageBackend = value
+		case envPrefix + "ALLOW_ANY_SERVER":
+			c.AllowAnyServer, err = parseBool(value)
+		case envPrefix + "GLOBAL_COMMANDS":
+			c.GlobalCommands, err = parseBool(value)
+		case envPrefix + "SERVERS":
+			for _, serverID := range strings.Split(value, ",") {
+				if serverID = strings.TrimSpace(serverID); serverID != "" {
+					c.getServer(serverID)
+				}
+			}
+		default:
+			if name, ok := strings.CutPrefix(key, envPrefix+"DEFAULTS_"); ok {
+				err = c.Defaults.set(name, value)
+			} else if rest, ok := strings.CutPrefix(key, envServerPrefix); ok {
+				err = c.setServerEnv(rest, value)
+			} else {
+				err = errors.New("unknown variable")
+			}
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", key, err))
+		}
+	}
+	return problems
+}
+
+// setServerEnv applies a SPIKE_SERVER_<ID>_<KEY> variable, given without its prefix. Servers which
+// are not in the config file are added.
+func (c *Config) setServerEnv(key, value string) error {
+	serverID, name, ok := strings.Cut(key, "_")
+	if !ok {
+		return errors.New("expected SPIKE_SERVER_<ID>_<KEY>")
+	}
+	server := c.getServer(serverID)
+	if name == "CHANNELS" {
+		server.Channels = nil
+		for _, channelID := range strings.Split(value, ",") {
+			if channelID = strings.TrimSpace(channelID); channelID != "" {
+				server.Channels = append(server.Channels, channelID)
+			}
+		}
+		return nil
+	}
+	if defaultName, ok := strings.CutPrefix(name, "DEFAULTS_"); ok {
+		return server.Defaults.set(defaultName, value)
+	}
+	return server.Defaults.set(name, value)
+}
+
+// getServer returns the server with the ID, adding it if it is not configured
+func (c *Config) getServer(serverID string) *ServerConfig {
+	idx := slices.IndexFunc(c.Servers, func(server ServerConfig) bool { return server.ID == serverID })
+	if idx == -1 {
+		c.Servers = append(c.Servers, ServerConfig{ID: serverID})
+		idx = len(c.Servers) - 1
+	}
+	return &c.Servers[idx]
+}
+
+// set applies the default named by an environment variable, such as MAX_SKILL_GAP
+func (d *ServerDefaults) set(name, value string) error {
+	switch name {
+	case "MAX_SKILL_GAP", "REPEAT_PENALTY":
+		num, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a whole number", value)
+		}
+		if name == "MAX_SKILL_GAP" {
+			d.MaxSkillGap = &num
+		} else {
+			d.RepeatPenalty = &num
+		}
+	case "BALANCE_POSITIONS":
+		balance, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		d.BalancePositions = &balance
+	default:
+		return errors.New("unknown variable")
+	}
+	return nil
+}
+
+func parseBool(value string) (bool, error) {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("'%s' is not true or false", value)
+	}
+	return b, nil
+}
+
+// validate returns every problem with the config, reading the bot token from its file if needed
+func (c *Config) validate() []string {
+	var problems []string
+
+	if c.Token.Value != "" && c.Token.File != "" {
+		problems = append(problems, "token: only one of value and file may be given")
+	}
+	if c.Token.Value == "" {
+		path := c.Token.File
+		if path == "" {
+			path = defaultBotTokenPath
+		}
+		token, err := os.ReadFile(path)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("token.file: failed to read bot token file '%s'", path))
+		}
+		c.Token.Value = strings.TrimSpace(string(token))
+		if err == nil && c.Token.Value == "" {
+			problems = append(problems, fmt.Sprintf("token.file: bot token file '%s' is empty", path))
+		}
+	}
+
+	if !slices.Contains(logLevels, c.LogLevel) {
+		problems = append(problems, fmt.Sprintf("log_level: '%s' is not one of %s", c.LogLevel, strings.Join(logLevels, ", ")))
+	}
+	if !slices.Contains(storageBackends, c.StorageBackend) {
+		problems = append(problems, fmt.Sprintf("storage_backend: '%s' is not one of %s", c.StorageBackend, strings.Join(storageBackends, ", ")))
+	}
+	if c.DataDir == "" {
+		problems = append(problems, "data_dir: must not be empty")
+	} else if info, err := os.Stat(c.DataDir); err == nil && !info.IsDir() {
+		problems = append(problems, fmt.Sprintf("data_dir: '%s' is not a directory", c.DataDir))
+	}
+	problems = append(problems, c.Defaults.validate("defaults")...)
+
+	if len(c.Servers) == 0 && !c.AllowAnyServer {
+		problems = append(problems, "servers: at least one server must be given unless allow_any_server is set")
+	}
+	seenServers := map[string]bool{}
+	for i, server := range c.Servers {
+		key := fmt.Sprintf("servers[%d]", i)
+		if !isSnowflake(server.ID) {
+			problems = append(problems, fmt.Sprintf("%s.id: '%s' is not a discord ID", key, server.ID))
+		} else if seenServers[server.ID] {
+			problems = append(problems, fmt.Sprintf("%s.id: server %s is given more than once", key, server.ID))
+		}
+		seenServers[server.ID] = true
+		for j, channelID := range server.Channels {
+			if !isSnowflake(channelID) {
+				problems = append(problems, fmt.Sprintf("%s.channels[%d]: '%s' is not a discord ID", key, j, channelID))
+			}
+		}
+		problems = append(problems, server.Defaults.validate(key+".defaults")...)
+	}
+	return problems
+}
+
+func (d ServerDefaults) validate(key string) []string {
+	var problems []string
+	if d.MaxSkillGap != nil && *d.MaxSkillGap < 0 {
+		problems = append(problems, fmt.Sprintf("%s.max_skill_gap: must not be negative", key))
+	}
+	if d.RepeatPenalty != nil && (*d.RepeatPenalty < 0 || *d.RepeatPenalty > 10) {
+		problems = append(problems, fmt.Sprintf("%s.repeat_penalty: must be between 0 and 10", key))
+	}
+	return problems
+}
+
+// isSnowflake returns whether the ID could be a discord ID, which are positive integers
+func isSnowflake(id string) bool {
+	num, err := strconv.ParseUint(id, 10, 64)
+	return err == nil && num > 0
+}
+
+// getServerIDs returns the ID of every configured server
+func (c *Config) getServerIDs() []string {
+	serverIDs := make([]string, len(c.Servers))
+	for i, server := range c.Servers {
+		serverIDs[i] = server.ID
+	}
+	return serverIDs
+}
+
+// getTeamsDefaults returns the options /teams create uses on the server, taking the server's own
+// defaults first, then the shared defaults
+func (c *Config) getTeamsDefaults(server ServerConfig) cmds.TeamsDefaults {
+	defaults := cmds.TeamsDefaults{MaxSkillGap: cmds.DefaultTeamsMaxSkillGap}
+	for _, d := range []ServerDefaults{c.Defaults, server.Defaults} {
+		if d.MaxSkillGap != nil {
+			defaults.MaxSkillGap = float64(*d.MaxSkillGap)
+		}
+		if d.RepeatPenalty != nil {
+			defaults.RepeatPenalty = *d.RepeatPenalty
+		}
+		if d.BalancePositions != nil {
+			defaults.BalancePositions = *d.BalancePositions
+		}
+	}
+	return defaults
+}
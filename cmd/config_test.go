@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	cmds "github.com/philflip12/spikebot/internal/commands"
+)
+
+// writeTestConfig writes the YAML config to a temporary file, returning its path
+func writeTestConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "spike.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigEnvPrecedence(t *testing.T) {
+	dataDir := t.TempDir()
+	tokenFile := filepath.Join(t.TempDir(), "BotToken")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := writeTestConfig(t, `
+token:
+  file: `+tokenFile+`
+log_level: debug
+data_dir: `+dataDir+`
+defaults:
+  max_skill_gap: 3
+  repeat_penalty: 2
+servers:
+  - id: "100"
+    defaults:
+      max_skill_gap: 4
+`)
+
+	config, err := loadConfig(path, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Token.Value != "file-token" {
+		t.Errorf("token '%s', want the token read from the file", config.Token.Value)
+	}
+	if config.StorageBackend != cmds.JSONBackend {
+		t.Errorf("storage backend '%s', want the default %s", config.StorageBackend, cmds.JSONBackend)
+	}
+
+	config, err = loadConfig(path, true, []string{
+		"HOME=/root",
+		"SPIKE_TOKEN=env-token",
+		"SPIKE_LOG_LEVEL=warn",
+		"SPIKE_STORAGE_BACKEND=" + cmds.SQLiteBackend,
+		"SPIKE_DEFAULTS_REPEAT_PENALTY=5",
+		"SPIKE_DEFAULTS_BALANCE_POSITIONS=true",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the token given by the environment replaces the file given by the config file
+	if config.Token != (TokenConfig{Value: "env-token"}) {
+		t.Errorf("token %+v, want the environment token alone", config.Token)
+	}
+	if config.LogLevel != "warn" || config.StorageBackend != cmds.SQLiteBackend || config.DataDir != dataDir {
+		t.Errorf("log level '%s', backend '%s' and data dir '%s', want warn, %s and %s",
+			config.LogLevel, config.StorageBackend, config.DataDir, cmds.SQLiteBackend, dataDir)
+	}
+
+	// a server's own defaults win over the shared defaults, whether from the file or the environment
+	want := cmds.TeamsDefaults{MaxSkillGap: 4, RepeatPenalty: 5, BalancePositions: true}
+	if got := config.getTeamsDefaults(config.Servers[0]); got != want {
+		t.Errorf("teams defaults %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadConfigServerEnv(t *testing.T) {
+	path := writeTestConfig(t, `
+token:
+  value: token
+data_dir: `+t.TempDir()+`
+servers:
+  - id: "100"
+    channels: ["1000"]
+`)
+
+	config, err := loadConfig(path, true, []string{
+		"SPIKE_SERVERS=100, 300",
+		"SPIKE_SERVER_100_CHANNELS=1001, 1002,",
+		"SPIKE_SERVER_100_DEFAULTS_MAX_SKILL_GAP=6",
+		"SPIKE_SERVER_200_MAX_SKILL_GAP=7",
+		"SPIKE_SERVER_200_REPEAT_PENALTY=1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// servers first named by the environment are added in order, the configured server only once
+	if serverIDs := config.getServerIDs(); !slices.Equal(serverIDs, []string{"100", "300", "200"}) {
+		t.Fatalf("servers %v, want [100 300 200]", serverIDs)
+	}
+	if channels := config.Servers[0].Channels; !slices.Equal(channels, []string{"1001", "1002"}) {
+		t.Errorf("channels %v, want the environment channels [1001 1002]", channels)
+	}
+
+	tests := []struct {
+		serverIdx int
+		want      cmds.TeamsDefaults
+	}{
+		{0, cmds.TeamsDefaults{MaxSkillGap: 6}},
+		{1, cmds.TeamsDefaults{MaxSkillGap: cmds.DefaultTeamsMaxSkillGap}},
+		{2, cmds.TeamsDefaults{MaxSkillGap: 7, RepeatPenalty: 1}},
+	}
+	for _, test := range tests {
+		server := config.Servers[test.serverIdx]
+		if got := config.getTeamsDefaults(server); got != test.want {
+			t.Errorf("server %s teams defaults %+v, want %+v", server.ID, got, test.want)
+		}
+	}
+}
+
+func TestLoadConfigProblems(t *testing.T) {
+	dataDir := t.TempDir()
+	notDir := filepath.Join(dataDir, "file")
+	if err := os.WriteFile(notDir, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	emptyToken := filepath.Join(dataDir, "BotToken")
+	if err := os.WriteFile(emptyToken, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		yaml string
+		env  []string
+		want []string
+	}{
+		{
+			name: "environment",
+			yaml: "token:\n  value: token\ndata_dir: " + dataDir + "\n",
+			env: []string{
+				"SPIKE_ALLOW_ANY_SERVER=maybe",
+				"SPIKE_DEFAULTS_MAX_SKILL_GAP=two",
+				"SPIKE_DEFAULTS_TEAM_SIZE=4",
+				"SPIKE_SERVER_100",
+				"SPIKE_UNKNOWN=1",
+			},
+			// problems with the environment are reported before the config is validated
+			want: []string{
+				"SPIKE_ALLOW_ANY_SERVER: 'maybe' is not true or false",
+				"SPIKE_DEFAULTS_MAX_SKILL_GAP: 'two' is not a whole number",
+				"SPIKE_DEFAULTS_TEAM_SIZE: unknown variable",
+				"SPIKE_SERVER_100: expected SPIKE_SERVER_<ID>_<KEY>",
+				"SPIKE_UNKNOWN: unknown variable",
+			},
+		},
+		{
+			name: "values",
+			yaml: `
+token:
+  value: token
+  file: ` + emptyToken + `
+log_level: verbose
+storage_backend: postgres
+data_dir: ` + notDir + `
+defaults:
+  max_skill_gap: -1
+servers:
+  - id: "100"
+    channels: ["1000", "general"]
+    defaults:
+      repeat_penalty: 11
+  - id: "100"
+  - id: server
+`,
+			want: []string{
+				"token: only one of value and file may be given",
+				"log_level: 'verbose' is not one of debug, info, warn, error, fatal",
+				"storage_backend: 'postgres' is not one of json, sqlite",
+				"data_dir: '" + notDir + "' is not a directory",
+				"defaults.max_skill_gap: must not be negative",
+				"servers[0].channels[1]: 'general' is not a discord ID",
+				"servers[0].defaults.repeat_penalty: must be between 0 and 10",
+				"servers[1].id: server 100 is given more than once",
+				"servers[2].id: 'server' is not a discord ID",
+			},
+		},
+		{
+			name: "empty token file",
+			yaml: "token:\n  file: " + emptyToken + "\ndata_dir: " + dataDir + "\nallow_any_server: true\n",
+			want: []string{"token.file: bot token file '" + emptyToken + "' is empty"},
+		},
+		{
+			name: "no servers",
+			yaml: "token:\n  value: token\ndata_dir: " + dataDir + "\n",
+			want: []string{"servers: at least one server must be given unless allow_any_server is set"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadConfig(writeTestConfig(t, test.yaml), true, test.env)
+			var problems ConfigError
+			if !errors.As(err, &problems) {
+				t.Fatalf("error %v, want a ConfigError", err)
+			}
+			if !slices.Equal(problems, test.want) {
+				t.Errorf("problems:\n\t%q\nwant:\n\t%q", problems, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "spike.yaml")
+	// without a config file spike can be configured by the environment alone
+	env := []string{"SPIKE_TOKEN=token", "SPIKE_DATA_DIR=" + t.TempDir(), "SPIKE_SERVERS=100"}
+	if _, err := loadConfig(missing, false, env); err != nil {
+		t.Errorf("error %v without a config file, want nil", err)
+	}
+	if _, err := loadConfig(missing, true, env); err == nil {
+		t.Error("no error for a missing config file given explicitly")
+	}
+	if _, err := loadConfig(writeTestConfig(t, "token_value: token\n"), true, env); err == nil {
+		t.Error("no error for an unknown config key")
+	}
+}
+
+func TestLoadConfigLegacyFiles(t *testing.T) {
+	path := writeTestConfig(t, "token:\n  value: token\ndata_dir: "+t.TempDir()+"\n")
+	dir := filepath.Dir(path)
+	if err := os.WriteFile(filepath.Join(dir, "ServerIDs"), []byte("100\n200\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ChannelIDs"), []byte("1000\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := loadConfig(path, true, nil)
+	var problems ConfigError
+	if !errors.As(err, &problems) {
+		t.Fatalf("error %v, want a ConfigError", err)
+	}
+	want := "servers: '" + filepath.Join(dir, "ServerIDs") + "' and '" + filepath.Join(dir, "ChannelIDs") +
+		"' are no longer read, move their IDs into the config file and delete them:\n\tservers:" +
+		"\n\t  - id: \"100\"\n\t    channels: [\"1000\"]" +
+		"\n\t  - id: \"200\"\n\t    channels: [\"1000\"]"
+	if !slices.Equal(problems, ConfigError{want}) {
+		t.Errorf("problems:\n\t%q\nwant:\n\t%q", problems, []string{want})
+	}
+
+	// the files are ignored once the servers are configured
+	if _, err := loadConfig(path, true, []string{"SPIKE_SERVERS=100"}); err != nil {
+		t.Errorf("error %v with the servers configured, want nil", err)
+	}
+}
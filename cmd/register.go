@@ -0,0 +1,148 @@
+package main
+
+// This file keeps the commands registered with discord in line with the commands spike defines,
+// creating, editing or deleting only the commands which changed so that they never disappear for
+// users while spike restarts
+
+import (
+	"fmt"
+	"slices"
+
+	dg "github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// syncCommands makes the commands registered on the server, or the global commands if serverID is
+// empty, match commands. A nil commands removes every registered command.
+func syncCommands(session *dg.Session, serverID string, commands []*dg.ApplicationCommand) error {
+	appID := session.State.User.ID
+	registered, err := session.ApplicationCommands(appID, serverID)
+	if err != nil {
+		return fmt.Errorf("failed to get the registered commands: %w", err)
+	}
+
+	var created, edited, deleted int
+	for _, command := range commands {
+		idx := slices.IndexFunc(registered, func(r *dg.ApplicationCommand) bool { return r.Name == command.Name })
+		switch {
+		case idx == -1:
+			if _, err := session.ApplicationCommandCreate(appID, serverID, command); err != nil {
+				return fmt.Errorf("failed to create command /%s: %w", command.Name, err)
+			}
+			created++
+		case !commandsEqual(command, registered[idx]):
+			if _, err := session.ApplicationCommandEdit(appID, serverID, registered[idx].ID, command); err != nil {
+				return fmt.Errorf("failed to edit command /%s: %w", command.Name, err)
+			}
+			edited++
+		}
+	}
+	for _, r := range registered {
+		if slices.ContainsFunc(commands, func(c *dg.ApplicationCommand) bool { return c.Name == r.Name }) {
+			continue
+		}
+		if err := session.ApplicationCommandDelete(appID, serverID, r.ID); err != nil {
+			return fmt.Errorf("failed to delete command /%s: %w", r.Name, err)
+		}
+		deleted++
+	}
+
+	if created+edited+deleted > 0 {
+		where := "globally"
+		if serverID != "" {
+			where = fmt.Sprintf("on server %s", serverID)
+		}
+		log.Infof("Commands %s: %d created, %d edited, %d deleted", where, created, edited, deleted)
+	}
+	return nil
+}
+
+// commandsEqual returns whether the registered command matches the defined command in every field
+// spike sets
+func commandsEqual(defined, registered *dg.ApplicationCommand) bool {
+	return getCommandType(defined) == getCommandType(registered) &&
+		defined.Description == registered.Description &&
+		pointersEqual(defined.DefaultMemberPermissions, registered.DefaultMemberPermissions) &&
+		// discord reports whether any command may be used in direct messages, so it is only compared
+		// when spike sets it
+		(defined.DMPermission == nil || *defined.DMPermission == getDMPermission(registered)) &&
+		optionsEqual(defined.Options, registered.Options)
+}
+
+// getCommandType returns the type of the command, which discord treats as a chat command if unset
+func getCommandType(command *dg.ApplicationCommand) dg.ApplicationCommandType {
+	if command.Type == 0 {
+		return dg.ChatApplicationCommand
+	}
+	return command.Type
+}
+
+// getDMPermission returns whether the command may be used in direct messages, which discord allows
+// if unset
+func getDMPermission(command *dg.ApplicationCommand) bool {
+	return command.DMPermission == nil || *command.DMPermission
+}
+
+func optionsEqual(a, b []*dg.ApplicationCommandOption) bool {
+	return slices.EqualFunc(a, b, func(a, b *dg.ApplicationCommandOption) bool {
+		return a.Type == b.Type &&
+			a.Name == b.Name &&
+			a.Description == b.Description &&
+			a.Required == b.Required &&
+			a.Autocomplete == b.Autocomplete &&
+			slices.Equal(a.ChannelTypes, b.ChannelTypes) &&
+			pointersEqual(a.MinValue, b.MinValue) &&
+			a.MaxValue == b.MaxValue &&
+			pointersEqual(a.MinLength, b.MinLength) &&
+			a.MaxLength == b.MaxLength &&
+			slices.EqualFunc(a.Choices, b.Choices, func(a, b *dg.ApplicationCommandOptionChoice) bool {
+				// integer values come back from discord as floats, so values are compared as text
+				return a.Name == b.Name && fmt.Sprint(a.Value) == fmt.Sprint(b.Value)
+			}) &&
+			optionsEqual(a.Options, b.Options)
+	})
+}
+
+// pointersEqual returns whether both pointers are nil or point to equal values
+func pointersEqual[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// getServerCommands returns the commands spike defines for use on servers only, and not in direct
+// messages, for registering them globally
+func getServerCommands(commands []*dg.ApplicationCommand) []*dg.ApplicationCommand {
+	serverCommands := make([]*dg.ApplicationCommand, len(commands))
+	for i, command := range commands {
+		serverCommand := *command
+		serverCommand.DMPermission = new(bool)
+		serverCommands[i] = &serverCommand
+	}
+	return serverCommands
+}
+
+// deregisterAllCommands removes the commands spike registered globally and on every server it is in
+func deregisterAllCommands(session *dg.Session) error {
+	if err := syncCommands(session, "", nil); err != nil {
+		return err
+	}
+	// discord lists the servers in pages ordered by their ID
+	afterID := ""
+	for {
+		guilds, err := session.UserGuilds(100, "", afterID, false)
+		if err != nil {
+			return fmt.Errorf("failed to list servers: %w", err)
+		}
+		for _, guild := range guilds {
+			if err := syncCommands(session, guild.ID, nil); err != nil {
+				return fmt.Errorf("server '%s' (%s): %w", guild.Name, guild.ID, err)
+			}
+		}
+		if len(guilds) < 100 {
+			return nil
+		}
+		afterID = guilds[len(guilds)-1].ID
+	}
+}
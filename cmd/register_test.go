@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	dg "github.com/bwmarrin/discordgo"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// getTestCommand returns a command with a subcommand group, choices and a minimum value, as defined
+// by spike
+func getTestCommand() *dg.ApplicationCommand {
+	return &dg.ApplicationCommand{
+		Name:        "teams",
+		Description: "Commands for creating teams",
+		Options: []*dg.ApplicationCommandOption{{
+			Name:        "config",
+			Description: "Change the defaults of /teams",
+			Type:        dg.ApplicationCommandOptionSubCommandGroup,
+			Options: []*dg.ApplicationCommandOption{{
+				Name:        "set",
+				Description: "Set a default",
+				Type:        dg.ApplicationCommandOptionSubCommand,
+				Options: []*dg.ApplicationCommandOption{{
+					Name:        "count",
+					Description: "Number of teams",
+					Type:        dg.ApplicationCommandOptionInteger,
+					Required:    true,
+					MinValue:    ptr(float64(2)),
+				}, {
+					Name:        "objective",
+					Description: "What to balance the teams by",
+					Type:        dg.ApplicationCommandOptionString,
+					Choices: []*dg.ApplicationCommandOptionChoice{
+						{Name: "average", Value: "average"},
+						{Name: "total", Value: "total"},
+					},
+				}, {
+					Name:        "size",
+					Description: "Players per team",
+					Type:        dg.ApplicationCommandOptionInteger,
+					Choices: []*dg.ApplicationCommandOptionChoice{
+						{Name: "small", Value: 4},
+						{Name: "large", Value: 6},
+					},
+				}},
+			}},
+		}},
+	}
+}
+
+// getSetOptions returns the options of the nested "config set" subcommand
+func getSetOptions(command *dg.ApplicationCommand) []*dg.ApplicationCommandOption {
+	return command.Options[0].Options[0].Options
+}
+
+func TestCommandsEqual(t *testing.T) {
+	tests := []struct {
+		name string
+		// change edits the command as registered with discord
+		change func(registered *dg.ApplicationCommand)
+		global bool
+		want   bool
+	}{{
+		name:   "unchanged",
+		change: func(*dg.ApplicationCommand) {},
+		want:   true,
+	}, {
+		name: "integer choices reported as floats",
+		change: func(registered *dg.ApplicationCommand) {
+			for _, choice := range getSetOptions(registered)[2].Choices {
+				choice.Value = float64(choice.Value.(int))
+			}
+		},
+		want: true,
+	}, {
+		name: "chat type reported when unset",
+		change: func(registered *dg.ApplicationCommand) {
+			registered.Type = dg.ChatApplicationCommand
+		},
+		want: true,
+	}, {
+		name: "changed description",
+		change: func(registered *dg.ApplicationCommand) {
+			registered.Description = "Old description"
+		},
+	}, {
+		name: "changed choice value",
+		change: func(registered *dg.ApplicationCommand) {
+			getSetOptions(registered)[1].Choices[1].Value = "variance"
+		},
+	}, {
+		name: "removed choice",
+		change: func(registered *dg.ApplicationCommand) {
+			options := getSetOptions(registered)
+			options[1].Choices = options[1].Choices[:1]
+		},
+	}, {
+		name: "changed min value",
+		change: func(registered *dg.ApplicationCommand) {
+			getSetOptions(registered)[0].MinValue = ptr(float64(1))
+		},
+	}, {
+		name: "removed min value",
+		change: func(registered *dg.ApplicationCommand) {
+			getSetOptions(registered)[0].MinValue = nil
+		},
+	}, {
+		name: "nested option no longer required",
+		change: func(registered *dg.ApplicationCommand) {
+			getSetOptions(registered)[0].Required = false
+		},
+	}, {
+		name: "nested option missing",
+		change: func(registered *dg.ApplicationCommand) {
+			registered.Options[0].Options[0].Options = getSetOptions(registered)[:2]
+		},
+	}, {
+		name: "renamed subcommand",
+		change: func(registered *dg.ApplicationCommand) {
+			registered.Options[0].Options[0].Name = "update"
+		},
+	}, {
+		name: "direct messages reported as allowed on a server",
+		change: func(registered *dg.ApplicationCommand) {
+			registered.DMPermission = ptr(true)
+		},
+		want: true,
+	}, {
+		name: "direct messages not allowed globally",
+		change: func(registered *dg.ApplicationCommand) {
+			registered.DMPermission = ptr(false)
+		},
+		global: true,
+		want:   true,
+	}, {
+		name: "direct messages allowed globally",
+		change: func(registered *dg.ApplicationCommand) {
+			registered.DMPermission = ptr(true)
+		},
+		global: true,
+	}, {
+		name: "direct messages allowed globally by default",
+		change: func(registered *dg.ApplicationCommand) {
+			registered.DMPermission = nil
+		},
+		global: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defined := getTestCommand()
+			if test.global {
+				defined = getServerCommands([]*dg.ApplicationCommand{defined})[0]
+			}
+			registered := getTestCommand()
+			test.change(registered)
+			if got := commandsEqual(defined, registered); got != test.want {
+				t.Errorf("commandsEqual = %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+// fakeCommandsAPI serves the commands endpoints of discord, filling in defaults as discord does
+type fakeCommandsAPI struct {
+	mutex    sync.Mutex
+	commands []*dg.ApplicationCommand
+	nextID   int
+	// the number of requests which changed the commands
+	writes int
+}
+
+func (api *fakeCommandsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	id := path.Base(r.URL.Path)
+	index := slices.IndexFunc(api.commands, func(c *dg.ApplicationCommand) bool { return c.ID == id })
+	if r.Method != http.MethodGet {
+		api.writes++
+	}
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(api.commands)
+	case http.MethodPost, http.MethodPatch:
+		var command dg.ApplicationCommand
+		if err := json.NewDecoder(r.Body).Decode(&command); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		command.Type = getCommandType(&command)
+		command.DMPermission = ptr(getDMPermission(&command))
+		if r.Method == http.MethodPost {
+			api.nextID++
+			command.ID = strconv.Itoa(api.nextID)
+			api.commands = append(api.commands, &command)
+		} else {
+			command.ID = id
+			api.commands[index] = &command
+		}
+		json.NewEncoder(w).Encode(command)
+	case http.MethodDelete:
+		api.commands = slices.Delete(api.commands, index, index+1)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestSyncCommands(t *testing.T) {
+	api := &fakeCommandsAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	prevEndpoint := dg.EndpointApplications
+	dg.EndpointApplications = server.URL + "/applications"
+	defer func() { dg.EndpointApplications = prevEndpoint }()
+
+	session, err := dg.New("Bot token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.State.User = &dg.User{ID: "1"}
+
+	other := &dg.ApplicationCommand{Name: "help", Description: "Show the commands"}
+	commands := []*dg.ApplicationCommand{getTestCommand(), other}
+	steps := []struct {
+		name     string
+		commands []*dg.ApplicationCommand
+		writes   int
+	}{
+		{"every command created", commands, 2},
+		{"nothing changed", commands, 0},
+		{"nothing changed globally", getServerCommands(commands), 2},
+		{"nothing changed globally again", getServerCommands(commands), 0},
+		{"one command changed", []*dg.ApplicationCommand{getTestCommand(), {Name: "help", Description: "Help"}}, 1},
+		{"one command removed", []*dg.ApplicationCommand{getTestCommand()}, 1},
+		{"every command removed", nil, 1},
+	}
+	for _, step := range steps {
+		api.writes = 0
+		if err := syncCommands(session, "", step.commands); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if api.writes != step.writes {
+			t.Errorf("%s: %d commands written, want %d", step.name, api.writes, step.writes)
+		}
+		if len(api.commands) != len(step.commands) {
+			t.Errorf("%s: %d commands registered, want %d", step.name, len(api.commands), len(step.commands))
+		}
+	}
+}
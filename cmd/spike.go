@@ -1,161 +1,168 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"flag"
 	"fmt"
-	"io"
 	"os"
 	"os/signal"
+	"slices"
+	"sync"
 	"syscall"
 
 	dg "github.com/bwmarrin/discordgo"
 	cmds "github.com/philflip12/spikebot/internal/commands"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/sys/windows"
 )
 
 const (
-	logTimeStampFmt       = "06-01-02 15:04:05" // YYMMDD HH:MM:SS
-	defaultBotTokenPath   = "./.env/BotToken"
-	defaultServerIDsPath  = "./.env/ServerIDs"
-	defaultChannelIDsPath = "./.env/ChannelIDs"
-	defaultLogLevelStr    = "info"
-	usageDialogFmtStr     = `
+	logTimeStampFmt   = "06-01-02 15:04:05" // YYMMDD HH:MM:SS
+	usageDialogFmtStr = `
     SpikeBot [Options...]
 
     Options:
         -h                Print this help dialog
+        -f CONFIG_PATH    Read the configuration from CONFIG_PATH
         -l LOG_LEVEL      Set program to print logs of LOG_LEVEL and higher
-        -t TOKEN_PATH     Set the bot token file path to TOKEN_PATH
-        -s SERVER_PATH    Set the server-id file path to SERVER_PATH
-        -c CHANNEL_PATH   Set the channel-id file path to CHANNEL_PATH
+        -b BACKEND        Set the storage backend for persistent data to BACKEND
+        -deregister       Remove the commands spike registered on every server and exit
 
     Log Levels:
         [debug, info, warn, error, fatal]
 
-    Default Options: [SpikeBot -l "%s" -t "%s" -s "%s" -c "%s"]
+    Storage Backends:
+        [json, sqlite]
+
+    Every key of the config file may be overridden by an environment variable, such as
+    SPIKE_LOG_LEVEL, SPIKE_TOKEN, SPIKE_DEFAULTS_MAX_SKILL_GAP or SPIKE_SERVERS.
+    The options given here override both. See .env/README.md for every key.
+
+    Default Options: [SpikeBot -f "%s"]
 `
 )
 
-type programArgs struct {
-	botToken   string
-	serverIDs  []string
-	channelIDs []string
-}
-
 func main() {
-	// Try to enable colored printing to terminal
-	enableTerminalColor()
+	// Try to enable colored printing to terminal, output which is not a terminal is left plain. The
+	// logs go to stderr and the banner to stdout, either of which may be redirected on its own.
+	logColor := enableTerminalColor(os.Stderr)
+	bannerColor := enableTerminalColor(os.Stdout)
 	// Set the logrus logging formatter
 	log.SetFormatter(&log.TextFormatter{
-		ForceColors:     true,
+		ForceColors:     logColor,
+		DisableColors:   !logColor,
+		DisableQuote:    true,
 		FullTimestamp:   true,
 		TimestampFormat: logTimeStampFmt,
 	})
 
 	args := parseFlags()
+	config := args.config
+
+	// Spike's commands are kept registered when it stops, so that they do not disappear while it
+	// restarts, and are only removed on request
+	if args.deregister {
+		session := openDiscordSession(config.Token.Value)
+		defer session.Close()
+		if err := deregisterAllCommands(session); err != nil {
+			log.Error(err)
+			return
+		}
+		log.Info("Removed every registered command")
+		return
+	}
 
-	// Only accept commands from specified servers and channels
-	cmds.SetServerIDs(args.serverIDs)
-	cmds.SetChannelIDs(args.channelIDs)
+	if err := cmds.SetStorageBackend(config.StorageBackend); err != nil {
+		log.Fatal(err)
+	}
+	cmds.SetDataDirectory(config.DataDir)
 
-	// Start spike and set the servers it will respond to commands from
-	spike := startSpikeSession(args.botToken, args.serverIDs)
-	defer spike.Close()
+	// The channels of each server are moved into its settings the first time it is opened
+	for _, server := range config.Servers {
+		if len(server.Channels) > 0 {
+			log.Warnf("servers.channels is deprecated, the channels of server %s are only used until they are chosen with /config channels", server.ID)
+			cmds.SetServerChannels(server.ID, server.Channels)
+		}
+	}
 
-	// Register commands for the servers previously specified
-	if err := spike.registerCommmands(cmds.CommandList); err != nil {
-		log.Info(err)
-		return
+	// Only accept commands from specified servers, unless any server may invite spike
+	if err := cmds.SetServerIDs(config.getServerIDs()); err != nil {
+		log.Fatal(err)
+	}
+	defer cmds.CloseServers()
+	cmds.AllowAnyServer(config.AllowAnyServer)
+	cmds.SetSharedTeamsDefaults(config.getTeamsDefaults(ServerConfig{}))
+	for _, server := range config.Servers {
+		cmds.SetTeamsDefaults(server.ID, config.getTeamsDefaults(server))
 	}
-	// Remove all registered commands from the servers when spike stops running.
-	defer spike.deregisterCommands()
 
-	fmt.Print(spikeAscii)
+	// Start spike, which registers its commands globally or on each allowed server as discord
+	// announces it
+	spike := startSpikeSession(config.Token.Value, cmds.CommandList, config.GlobalCommands)
+	defer spike.Close()
+
+	fmt.Print(getSpikeAscii(bannerColor))
 	log.Info("Press CTRL-C to stop Spike")
 
 	waitForKillSig()
 	log.Info("Closing Spike")
 }
 
-// Reads the command line flags for running the "Spike" discord bot.
-// Kills the program on error or help request.
+type programArgs struct {
+	config     *Config
+	deregister bool
+}
+
+// Reads the command line flags and the config file for running the "Spike" discord bot.
+// Kills the program on an invalid configuration or help request.
 func parseFlags() *programArgs {
 	var printHelp bool
+	var deregister bool
+	var configPath string
 	var logLevelStr string
-	var botTokenPath string
-	var serverIDPath string
-	var channelIDPath string
+	var storageBackend string
 	flag.BoolVar(&printHelp, "h", false, "")
-	flag.StringVar(&botTokenPath, "t", defaultBotTokenPath, "h")
-	flag.StringVar(&serverIDPath, "s", defaultServerIDsPath, "")
-	flag.StringVar(&channelIDPath, "c", defaultChannelIDsPath, "")
-	flag.StringVar(&logLevelStr, "l", defaultLogLevelStr, "")
+	flag.StringVar(&configPath, "f", "", "")
+	flag.StringVar(&logLevelStr, "l", "", "")
+	flag.StringVar(&storageBackend, "b", "", "")
+	flag.BoolVar(&deregister, "deregister", false, "")
 	flag.Usage = func() {
-		log.Fatalf(usageDialogFmtStr, defaultLogLevelStr, defaultBotTokenPath, defaultServerIDsPath, defaultChannelIDsPath)
+		log.Fatalf(usageDialogFmtStr, defaultConfigPath)
 	}
 	flag.Parse()
 
 	if printHelp {
-		if printHelp {
-			log.Infof(usageDialogFmtStr, defaultLogLevelStr, defaultBotTokenPath, defaultServerIDsPath, defaultChannelIDsPath)
-		}
+		log.Infof(usageDialogFmtStr, defaultConfigPath)
 		os.Exit(0)
 	}
 
-	// Set log level according to provided flag or default to info
-	setLogLevel(logLevelStr)
-
-	// Open and read bot token from provided file path or default path
-	botTokenFile, err := os.Open(botTokenPath)
-	if err != nil {
-		log.Fatalf("Failed to open bot token file path '%s'", botTokenPath)
-	}
-	botToken, err := io.ReadAll(botTokenFile)
-	if err != nil {
-		log.Fatalf("Failed to read from bot token file path '%s'", botTokenPath)
+	// The config file is found by the flag, then the environment, then the default path
+	explicit := true
+	if configPath == "" {
+		configPath = os.Getenv(envPrefix + "CONFIG")
 	}
-
-	// Open and read server ID from provided file path or default path
-	serverIDFile, err := os.Open(serverIDPath)
-	if err != nil {
-		log.Fatalf("Failed to open server ID file path '%s'", serverIDPath)
+	if configPath == "" {
+		configPath = defaultConfigPath
+		explicit = false
 	}
-	serverIDData, err := io.ReadAll(serverIDFile)
-	if err != nil {
-		log.Fatalf("Failed to read from server ID file path '%s'", serverIDPath)
+	// The flags override the environment by being applied after it
+	env := os.Environ()
+	if logLevelStr != "" {
+		env = append(env, envPrefix+"LOG_LEVEL="+logLevelStr)
 	}
-	serverReader := bytes.NewBuffer(serverIDData)
-	serverScanner := bufio.NewScanner(serverReader)
-	serverScanner.Split(bufio.ScanLines)
-	serverIDs := []string{}
-	for serverScanner.Scan() {
-		serverIDs = append(serverIDs, serverScanner.Text())
+	if storageBackend != "" {
+		env = append(env, envPrefix+"STORAGE_BACKEND="+storageBackend)
 	}
 
-	// Open and read channel ID from provided file path or default path
-	channelIDFile, err := os.Open(channelIDPath)
-	if err != nil {
-		log.Fatalf("Failed to open channel ID file path '%s'", channelIDPath)
-	}
-	channelIDData, err := io.ReadAll(channelIDFile)
+	config, err := loadConfig(configPath, explicit, env)
 	if err != nil {
-		log.Fatalf("Failed to read from channel ID file path '%s'", channelIDPath)
-	}
-	channelReader := bytes.NewBuffer(channelIDData)
-	channelScanner := bufio.NewScanner(channelReader)
-	channelScanner.Split(bufio.ScanLines)
-	channelIDs := []string{}
-	for channelScanner.Scan() {
-		channelIDs = append(channelIDs, channelScanner.Text())
+		log.Fatal(err)
 	}
 
+	// Set log level according to the configuration or default to info
+	setLogLevel(config.LogLevel)
+
 	return &programArgs{
-		botToken:   string(botToken),
-		serverIDs:  serverIDs,
-		channelIDs: channelIDs,
+		config:     config,
+		deregister: deregister,
 	}
 }
 
@@ -180,11 +187,27 @@ func setLogLevel(levelStr string) {
 
 type spikeSession struct {
 	*dg.Session
+	commands []*dg.ApplicationCommand
+	// whether the commands are registered globally rather than on each server
+	global bool
+	mutex  sync.Mutex
+	// the servers the commands have been synced on
 	serverIDs []string
 }
 
 // Connects to the discord server and starts spike using the specified botToken
-func startSpikeSession(botToken string, serverIDs []string) *spikeSession {
+func startSpikeSession(botToken string, commands []*dg.ApplicationCommand, global bool) *spikeSession {
+	spike := &spikeSession{
+		commands: commands,
+		global:   global,
+	}
+	spike.Session = openDiscordSession(botToken, cmds.OnInteractionCreate, spike.onReady, spike.onGuildCreate, spike.onGuildDelete)
+	return spike
+}
+
+// Connects to the discord server using the specified botToken, adding the handlers before any
+// event arrives
+func openDiscordSession(botToken string, handlers ...interface{}) *dg.Session {
 	// Configure the logging of discord go
 	dg.Logger = func(msgL, caller int, format string, a ...interface{}) {
 		// Start any logs from the Discord Go library with "[DG]"
@@ -211,7 +234,9 @@ func startSpikeSession(botToken string, serverIDs []string) *spikeSession {
 	// Set the bot permission requirements ("guild" is the develement equivalent of "server")
 	session.Identify.Intents = dg.IntentGuildMessages | dg.IntentGuilds | dg.IntentGuildMembers
 
-	session.AddHandler(cmds.OnInteractionCreate)
+	for _, handler := range handlers {
+		session.AddHandler(handler)
+	}
 
 	// Open a websocket connection to Discord and begin listening.
 	err = session.Open()
@@ -219,27 +244,68 @@ func startSpikeSession(botToken string, serverIDs []string) *spikeSession {
 		log.Fatalf("Error opening connection: %v", err)
 	}
 
-	return &spikeSession{
-		Session:   session,
-		serverIDs: serverIDs,
-	}
+	return session
+}
 
+// onReady is called once spike connects. The global commands are synced, removing any left from
+// running with global commands if they are now registered on each server.
+func (s *spikeSession) onReady(session *dg.Session, ready *dg.Ready) {
+	var commands []*dg.ApplicationCommand
+	if s.global {
+		commands = getServerCommands(s.commands)
+	}
+	if err := syncCommands(session, "", commands); err != nil {
+		log.Errorf("Failed to register global commands: %v", err)
+	}
 }
 
-func (s *spikeSession) registerCommmands(cmds []*dg.ApplicationCommand) error {
-	for _, serverID := range s.serverIDs {
-		_, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, serverID, cmds)
-		if err != nil {
-			return err
-		}
+// onGuildCreate is called for every server spike is in once it connects, and again whenever it is
+// invited to a new server. The commands are synced on each allowed server the first time, removing
+// any left from running without global commands if they are now registered globally.
+func (s *spikeSession) onGuildCreate(session *dg.Session, guild *dg.GuildCreate) {
+	if guild.Unavailable {
+		return
+	}
+	if !cmds.IsServerAllowed(guild.ID) {
+		log.Warnf("Ignoring server '%s' (%s), it is not one of the configured servers", guild.Name, guild.ID)
+		return
+	}
+	if err := cmds.OpenServer(guild.ID); err != nil {
+		log.Error(err)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// discord announces the servers again after reconnecting
+	if slices.Contains(s.serverIDs, guild.ID) {
+		return
 	}
-	return nil
+	commands := s.commands
+	if s.global {
+		commands = nil
+	}
+	if err := syncCommands(session, guild.ID, commands); err != nil {
+		log.Errorf("Failed to register commands on server '%s' (%s): %v", guild.Name, guild.ID, err)
+		return
+	}
+	s.serverIDs = append(s.serverIDs, guild.ID)
+	log.Infof("Serving server '%s' (%s)", guild.Name, guild.ID)
 }
 
-func (s *spikeSession) deregisterCommands() {
-	for _, serverID := range s.serverIDs {
-		s.ApplicationCommandBulkOverwrite(s.State.User.ID, serverID, nil)
+// onGuildDelete is called when spike is removed from a server, or when a server becomes unavailable
+// during a discord outage
+func (s *spikeSession) onGuildDelete(session *dg.Session, guild *dg.GuildDelete) {
+	if guild.Unavailable {
+		log.Warnf("Server %s is unavailable", guild.ID)
+		return
 	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.serverIDs = slices.DeleteFunc(s.serverIDs, func(serverID string) bool { return serverID == guild.ID })
+	cmds.CloseServer(guild.ID)
+	log.Infof("Removed from server %s", guild.ID)
 }
 
 // blocks until a kill signal is sent to the program such as "CTRL-C"
@@ -249,15 +315,6 @@ func waitForKillSig() {
 	<-sc
 }
 
-func enableTerminalColor() {
-	handle := windows.Handle(os.Stdout.Fd())
-	var mode uint32
-	if windows.GetConsoleMode(handle, &mode) == nil {
-		mode |= windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING
-		windows.SetConsoleMode(handle, mode)
-	}
-}
-
 // Colors
 var (
 	white    = "\x1b[0m"
@@ -275,16 +332,30 @@ var (
 	}
 )
 
-var spikeAscii = `
-` + gradient[0] + `         @@@@@@             @@@@@@   @@@@@@@   @@@  @@@  @@@  @@@@@@@@            @@@@@@
-` + gradient[1] + `     @@@    @@  @@@        @@@@@@@   @@@@@@@@  @@@  @@@  @@@  @@@@@@@@        @@@    @@  @@@
-` + gradient[2] + `   @@   @@    @@   @@      !@@       @@!  @@@  @@!  @@!  !@@  @@!           @@   @@    @@   @@
-` + gradient[3] + `  @    @@ @@    @@   @     !@!       !@!  @!@  !@!  !@!  @!!  !@!          @    @@ @@    @@   @
-` + gradient[4] + ` @   @@    @@@    @   @    !!@@!!    @!@@!@!   !!@  @!@@!@!   @!!!:!      @   @@    @@@    @   @
-` + gradient[5] + ` @  @    @@   @@@  @  @     !!@!!!   !!@!!!    !!!  !!@!!!    !!!!!:      @  @    @@   @@@  @  @
-` + gradient[6] + `  @@    @@@      @@@@@          !:!  !!:       !!:  !!: :!!   !!:          @@    @@@      @@@@@
-` + gradient[7] + `   @@  @   @@@     @@          !:!   :!:       :!:  :!:  !:!  :!:           @@  @   @@@     @@
-` + gradient[8] + `     @@@      @@@@@        :::: ::    ::        ::   ::  :::   :: ::::        @@@      @@@@@
-` + gradient[9] + `         @@@@@@            :: : :     :        :     :   :::  : :: ::             @@@@@@
-` + white + `
-`
+var spikeAsciiLines = []string{
+	`         @@@@@@             @@@@@@   @@@@@@@   @@@  @@@  @@@  @@@@@@@@            @@@@@@`,
+	`     @@@    @@  @@@        @@@@@@@   @@@@@@@@  @@@  @@@  @@@  @@@@@@@@        @@@    @@  @@@`,
+	`   @@   @@    @@   @@      !@@       @@!  @@@  @@!  @@!  !@@  @@!           @@   @@    @@   @@`,
+	`  @    @@ @@    @@   @     !@!       !@!  @!@  !@!  !@!  @!!  !@!          @    @@ @@    @@   @`,
+	` @   @@    @@@    @   @    !!@@!!    @!@@!@!   !!@  @!@@!@!   @!!!:!      @   @@    @@@    @   @`,
+	` @  @    @@   @@@  @  @     !!@!!!   !!@!!!    !!!  !!@!!!    !!!!!:      @  @    @@   @@@  @  @`,
+	`  @@    @@@      @@@@@          !:!  !!:       !!:  !!: :!!   !!:          @@    @@@      @@@@@`,
+	`   @@  @   @@@     @@          !:!   :!:       :!:  :!:  !:!  :!:           @@  @   @@@     @@`,
+	`     @@@      @@@@@        :::: ::    ::        ::   ::  :::   :: ::::        @@@      @@@@@`,
+	`         @@@@@@            :: : :     :        :     :   :::  : :: ::             @@@@@@`,
+}
+
+// getSpikeAscii returns the spike banner, shaded from red to orange when color is enabled
+func getSpikeAscii(color bool) string {
+	ascii := "\n"
+	for i, line := range spikeAsciiLines {
+		if color {
+			line = gradient[i] + line
+		}
+		ascii += line + "\n"
+	}
+	if color {
+		ascii += white
+	}
+	return ascii + "\n"
+}
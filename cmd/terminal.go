@@ -0,0 +1,17 @@
+package main
+
+// This file decides whether spike's output is colored. Each platform detects whether its output is
+// a terminal able to show color in its own terminal_<platform>.go file, and output such as a log
+// file, journald or docker logs is left plain.
+
+import "os"
+
+// enableTerminalColor prepares the terminal of the file to show colored output, returning whether
+// output written to the file should be colored. Setting the NO_COLOR environment variable always
+// disables color.
+func enableTerminalColor(file *os.File) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return enablePlatformColor(file)
+}
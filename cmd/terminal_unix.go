@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// enablePlatformColor reports whether the file is a terminal which can show color. Terminals show
+// color escape sequences without any setup, except for those declaring themselves dumb.
+func enablePlatformColor(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	return os.Getenv("TERM") != "dumb"
+}
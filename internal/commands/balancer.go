@@ -0,0 +1,900 @@
+package commands
+
+// This file contains the algorithm used to split the playing group into teams of balanced skill.
+// Teams are seeded greedily and improved with pairwise swaps. If the result misses the requested
+// skill gap, an exhaustive branch and bound search is run to either find a better arrangement or
+// prove that the target cannot be met. When positions are balanced, every arrangement considered
+// splits the players of each position as evenly as possible between the teams, and pairs of players
+// which must be kept together or apart are always honored. Once the skill gap is within the target,
+// players can be swapped further to avoid repeating teammate pairings from earlier sessions, or to
+// meet an objective beyond the skill gap such as spreading the strongest players between the teams.
+//
+// Teams of different sizes are only compared with the teams they play against, which are those
+// whose sizes differ by at most one. So a team of 7 is balanced against a team of 6, while teams of
+// 6 and teams of 4 playing on separate courts are each balanced among themselves.
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"time"
+)
+
+// tolerance used when comparing team skill averages
+const skillEpsilon = 1e-9
+
+// number of search nodes visited between checks of the deadline
+const deadlineCheckInterval = 1 << 10
+
+// the objectives teams can be balanced by
+const (
+	// the smallest gap between team skill averages
+	objectiveAverage = "average"
+	// the smallest gap between team skill totals, which favors the teams with fewer players
+	objectiveTotal = "total"
+	// an average gap within the target, then the most similar spread of skill within each team
+	objectiveVariance = "variance"
+	// an average gap within the target, then the strongest players split evenly between the teams
+	objectiveTop = "top"
+)
+
+const (
+	// the most times the arrangement is shaken up while refining it
+	refineRounds = 50
+	// the number of random swaps made to shake up the arrangement
+	refineShakeSwaps = 3
+)
+
+// balanceRules are the requirements every arrangement of the players must meet. Each holds indices
+// into the player list.
+type balanceRules struct {
+	// positions holds the position index of each player, or -1 for players without a position, and
+	// is nil when positions are not balanced
+	positions []int
+	// pairs of players which must be placed on the same team
+	together [][2]int
+	// pairs of players which must be placed on different teams
+	apart [][2]int
+}
+
+type balancer struct {
+	// skills of the players sorted from highest to lowest
+	skills []int
+	// order[i] is the index into the original player list of the player with skills[i]
+	order []int
+	// prefix[i] is the sum of skills[:i]
+	prefix []int
+	sizes  []int
+	// groups[team] is the group of teams which play against each other that the team belongs to
+	groups []int
+	// the largest and smallest values seen for each group, reused while measuring skill gaps
+	groupMax []float64
+	groupMin []float64
+	// positions[i] is the position index of the player with skills[i], or -1 for no position
+	positions []int
+	// the fewest and most players of each position allowed on a team
+	minPositionCount []int
+	maxPositionCount []int
+	// remainingPositions[i][p] is the number of players of position p in skills[i:]
+	remainingPositions [][]int
+	// together[i] and apart[i] are the players which the player with skills[i] must be placed with or
+	// away from
+	together [][]int
+	apart    [][]int
+	// the number of players with a together or apart requirement placed on each team while searching
+	pinned []int
+	// repeats[i][j] is the number of earlier sessions in which the players with skills[i] and
+	// skills[j] were teammates
+	repeats [][]int
+	// the skill gap each repeated teammate pairing is worth, 0 if repeats are ignored
+	repeatWeight float64
+	// the objective balanced by, "" for objectiveAverage
+	objective string
+	// the skill needed to be one of the strongest players split evenly by objectiveTop
+	topThreshold int
+	// the skill total of each team is divided by its divisor to get the team skill which is compared,
+	// the team size for averages or 1 for totals
+	divisors []float64
+
+	// seeds the random swaps made while refining, so that the same players are always refined the
+	// same way
+	seed     int64
+	deadline time.Time
+	target   float64
+	visited  int
+	timedOut bool
+
+	bestAssign []int
+	bestGap    float64
+}
+
+// newBalancer creates a balancer for splitting the players into teams of the given sizes
+func newBalancer(
+	players []Player,
+	rules balanceRules,
+	teamSizes []int,
+	maxSkillGap float64,
+	timeLimit time.Duration,
+) *balancer {
+	order := make([]int, len(players))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return players[order[i]].Skill > players[order[j]].Skill
+	})
+
+	skills := make([]int, len(players))
+	prefix := make([]int, len(players)+1)
+	for i, playerIdx := range order {
+		skills[i] = players[playerIdx].Skill
+		prefix[i+1] = prefix[i] + skills[i]
+	}
+
+	numPositions := 0
+	sortedPositions := make([]int, len(players))
+	for i, playerIdx := range order {
+		sortedPositions[i] = -1
+		if rules.positions != nil {
+			sortedPositions[i] = rules.positions[playerIdx]
+			numPositions = max(numPositions, rules.positions[playerIdx]+1)
+		}
+	}
+	remainingPositions := make([][]int, len(players)+1)
+	remainingPositions[len(players)] = make([]int, numPositions)
+	for i := len(players) - 1; i >= 0; i-- {
+		remainingPositions[i] = slices.Clone(remainingPositions[i+1])
+		if sortedPositions[i] >= 0 {
+			remainingPositions[i][sortedPositions[i]]++
+		}
+	}
+	minPositionCount := make([]int, numPositions)
+	maxPositionCount := make([]int, numPositions)
+	for position, count := range remainingPositions[0] {
+		minPositionCount[position] = count / len(teamSizes)
+		maxPositionCount[position] = (count + len(teamSizes) - 1) / len(teamSizes)
+	}
+
+	sortedIndex := make([]int, len(players))
+	for i, playerIdx := range order {
+		sortedIndex[playerIdx] = i
+	}
+	together := make([][]int, len(players))
+	for _, pair := range rules.together {
+		a, b := sortedIndex[pair[0]], sortedIndex[pair[1]]
+		together[a] = append(together[a], b)
+		together[b] = append(together[b], a)
+	}
+	apart := make([][]int, len(players))
+	for _, pair := range rules.apart {
+		a, b := sortedIndex[pair[0]], sortedIndex[pair[1]]
+		apart[a] = append(apart[a], b)
+		apart[b] = append(apart[b], a)
+	}
+
+	divisors := make([]float64, len(teamSizes))
+	for team, size := range teamSizes {
+		divisors[team] = float64(size)
+	}
+
+	groups := getSizeGroups(teamSizes)
+	numGroups := 0
+	for _, group := range groups {
+		numGroups = max(numGroups, group+1)
+	}
+
+	return &balancer{
+		together:           together,
+		apart:              apart,
+		pinned:             make([]int, len(teamSizes)),
+		skills:             skills,
+		order:              order,
+		prefix:             prefix,
+		sizes:              teamSizes,
+		groups:             groups,
+		divisors:           divisors,
+		groupMax:           make([]float64, numGroups),
+		groupMin:           make([]float64, numGroups),
+		positions:          sortedPositions,
+		minPositionCount:   minPositionCount,
+		maxPositionCount:   maxPositionCount,
+		remainingPositions: remainingPositions,
+		seed:               getPlayersSeed(players),
+		deadline:           time.Now().Add(timeLimit),
+		target:             maxSkillGap,
+		bestGap:            math.Inf(1),
+	}
+}
+
+// getPlayersSeed returns a random seed which depends only on the IDs of the players
+func getPlayersSeed(players []Player) int64 {
+	ids := make([]string, len(players))
+	for i, player := range players {
+		ids[i] = player.ID
+	}
+	slices.Sort(ids)
+	hash := fnv.New64a()
+	for _, id := range ids {
+		hash.Write([]byte(id))
+		hash.Write([]byte{0})
+	}
+	return int64(hash.Sum64())
+}
+
+// withRepeatPenalty makes the balancer prefer arrangements repeating fewer teammate pairings, with
+// each pairing worth weight points of skill gap. The skill gap is still kept within the target.
+// repeats is indexed by the original player list.
+func (b *balancer) withRepeatPenalty(repeats [][]int, weight float64) *balancer {
+	b.repeats = make([][]int, len(b.skills))
+	for i, playerI := range b.order {
+		b.repeats[i] = make([]int, len(b.skills))
+		for j, playerJ := range b.order {
+			b.repeats[i][j] = repeats[playerI][playerJ]
+		}
+	}
+	b.repeatWeight = weight
+	return b
+}
+
+// withObjective makes the balancer balance the teams by the objective rather than by the gap
+// between team averages. topCount is the number of strongest players objectiveTop splits evenly.
+func (b *balancer) withObjective(objective string, topCount int) *balancer {
+	b.objective = objective
+	if objective == objectiveTop && len(b.skills) > 0 {
+		b.topThreshold = getTopThreshold(b.skills, topCount)
+	}
+	if objective == objectiveTotal {
+		for team := range b.divisors {
+			b.divisors[team] = 1
+		}
+	}
+	return b
+}
+
+// balance returns the team index of each player in the original player list, the resulting skill
+// gap and whether that gap is proven to be the smallest possible. The assignment is nil if no
+// arrangement meeting the rules was found, in which case optimal reports whether none exists.
+func (b *balancer) balance() (assignment []int, skillGap float64, optimal bool) {
+	assign, sums, ok := b.greedySeed()
+	if !ok {
+		assign, sums = b.dealSeed()
+		ok = b.meetsPairs(assign)
+	}
+	b.bestAssign = make([]int, len(b.skills))
+	if ok {
+		b.localSearch(assign, sums)
+		copy(b.bestAssign, assign)
+		b.bestGap = b.gap(sums)
+		optimal = b.bestGap <= b.lowerBound()+skillEpsilon
+	}
+
+	if b.bestGap > b.target+skillEpsilon && !optimal {
+		assign := make([]int, len(b.skills))
+		sums := make([]int, len(b.sizes))
+		counts := make([]int, len(b.sizes))
+		b.search(0, assign, sums, counts, b.newPositionCounts())
+		// a search which ran to completion without meeting the target has checked every arrangement,
+		// and one which met it early may have reached the lower bound
+		optimal = (!b.timedOut && b.bestGap > b.target+skillEpsilon) || b.bestGap <= b.lowerBound()+skillEpsilon
+	}
+
+	if math.IsInf(b.bestGap, 1) {
+		return nil, b.bestGap, optimal
+	}
+	refines := b.repeatWeight > 0 || b.objective == objectiveVariance || b.objective == objectiveTop
+	if refines && b.bestGap <= b.target+skillEpsilon {
+		b.refine()
+	}
+	assignment = make([]int, len(b.skills))
+	for i, team := range b.bestAssign {
+		assignment[b.order[i]] = team
+	}
+	return assignment, b.bestGap, optimal
+}
+
+// greedySeed assigns the players from strongest to weakest, each to the team with the lowest
+// team skill. It fails if the positions cannot be split evenly this way.
+func (b *balancer) greedySeed() (assign []int, sums []int, ok bool) {
+	assign = make([]int, len(b.skills))
+	sums = make([]int, len(b.sizes))
+	counts := make([]int, len(b.sizes))
+	positionCounts := b.newPositionCounts()
+	for i, skill := range b.skills {
+		position := b.positions[i]
+		bestTeam := -1
+		for team := range b.sizes {
+			if counts[team] == b.sizes[team] {
+				continue
+			}
+			if position >= 0 && positionCounts[team][position] == b.maxPositionCount[position] {
+				continue
+			}
+			if !b.canPlace(assign, i, team, i, -1) {
+				continue
+			}
+			if bestTeam == -1 || b.average(team, sums) < b.average(bestTeam, sums) {
+				bestTeam = team
+			}
+		}
+		if bestTeam == -1 {
+			return nil, nil, false
+		}
+		assign[i] = bestTeam
+		sums[bestTeam] += skill
+		counts[bestTeam]++
+		if position >= 0 {
+			positionCounts[bestTeam][position]++
+		}
+	}
+	return assign, sums, b.positionsFeasible(len(b.skills), counts, positionCounts)
+}
+
+// canPlace reports whether placing player i on team keeps them with or away from the players they
+// are required to be. Only players before assigned are considered placed, and player except is
+// ignored.
+func (b *balancer) canPlace(assign []int, i, team, assigned, except int) bool {
+	for _, other := range b.together[i] {
+		if other < assigned && other != except && assign[other] != team {
+			return false
+		}
+	}
+	for _, other := range b.apart[i] {
+		if other < assigned && other != except && assign[other] == team {
+			return false
+		}
+	}
+	return true
+}
+
+// meetsPairs reports whether a complete arrangement keeps every pair together or apart as required
+func (b *balancer) meetsPairs(assign []int) bool {
+	for i, team := range assign {
+		if !b.canPlace(assign, i, team, len(assign), -1) {
+			return false
+		}
+	}
+	return true
+}
+
+// dealSeed deals the players out in turn to the teams with room left, grouped by position, which
+// splits each position evenly as long as the teams are of similar sizes.
+func (b *balancer) dealSeed() (assign []int, sums []int) {
+	byPosition := make([]int, len(b.skills))
+	for i := range byPosition {
+		byPosition[i] = i
+	}
+	sort.SliceStable(byPosition, func(i, j int) bool {
+		return b.positions[byPosition[i]] < b.positions[byPosition[j]]
+	})
+
+	assign = make([]int, len(b.skills))
+	sums = make([]int, len(b.sizes))
+	counts := make([]int, len(b.sizes))
+	team := 0
+	for _, i := range byPosition {
+		for counts[team] == b.sizes[team] {
+			team = (team + 1) % len(b.sizes)
+		}
+		assign[i] = team
+		sums[team] += b.skills[i]
+		counts[team]++
+		team = (team + 1) % len(b.sizes)
+	}
+	return assign, sums
+}
+
+// localSearch repeatedly swaps pairs of players on different teams while doing so reduces the
+// skill gap, or keeps the skill gap and brings the team averages closer together.
+func (b *balancer) localSearch(assign []int, sums []int) {
+	positionCounts := b.newPositionCounts()
+	for i, team := range assign {
+		if b.positions[i] >= 0 {
+			positionCounts[team][b.positions[i]]++
+		}
+	}
+
+	gap, spread := b.gap(sums), b.spread(sums)
+	for improved := true; improved; {
+		improved = false
+		for i := range b.skills {
+			for j := i + 1; j < len(b.skills); j++ {
+				teamI, teamJ := assign[i], assign[j]
+				diff := b.skills[i] - b.skills[j]
+				if teamI == teamJ || diff == 0 || !b.canSwap(positionCounts, i, j, teamI, teamJ) {
+					continue
+				}
+				if !b.canPlace(assign, i, teamJ, len(assign), j) || !b.canPlace(assign, j, teamI, len(assign), i) {
+					continue
+				}
+				sums[teamI] -= diff
+				sums[teamJ] += diff
+				newGap, newSpread := b.gap(sums), b.spread(sums)
+				if newGap < gap-skillEpsilon || (newGap <= gap+skillEpsilon && newSpread < spread-skillEpsilon) {
+					assign[i], assign[j] = teamJ, teamI
+					b.movePosition(positionCounts, i, teamI, teamJ)
+					b.movePosition(positionCounts, j, teamJ, teamI)
+					gap, spread = newGap, newSpread
+					improved = true
+				} else {
+					sums[teamI] += diff
+					sums[teamJ] -= diff
+				}
+			}
+		}
+	}
+}
+
+// canSwap reports whether players i and j, on teams teamI and teamJ, can trade teams without
+// leaving a team with too few or too many players of a position.
+func (b *balancer) canSwap(positionCounts [][]int, i, j, teamI, teamJ int) bool {
+	positionI, positionJ := b.positions[i], b.positions[j]
+	if positionI == positionJ {
+		return true
+	}
+	if positionI >= 0 && (positionCounts[teamI][positionI] == b.minPositionCount[positionI] ||
+		positionCounts[teamJ][positionI] == b.maxPositionCount[positionI]) {
+		return false
+	}
+	if positionJ >= 0 && (positionCounts[teamJ][positionJ] == b.minPositionCount[positionJ] ||
+		positionCounts[teamI][positionJ] == b.maxPositionCount[positionJ]) {
+		return false
+	}
+	return true
+}
+
+func (b *balancer) movePosition(positionCounts [][]int, i, from, to int) {
+	if position := b.positions[i]; position >= 0 {
+		positionCounts[from][position]--
+		positionCounts[to][position]++
+	}
+}
+
+// newPositionCounts returns the number of players of each position on each team, all zero
+func (b *balancer) newPositionCounts() [][]int {
+	positionCounts := make([][]int, len(b.sizes))
+	for team := range positionCounts {
+		positionCounts[team] = make([]int, len(b.minPositionCount))
+	}
+	return positionCounts
+}
+
+// positionsFeasible reports whether the players from idx onward can still bring every team up to
+// the fewest players of each position allowed.
+func (b *balancer) positionsFeasible(idx int, counts []int, positionCounts [][]int) bool {
+	missing := make([]int, len(b.sizes))
+	for position, minCount := range b.minPositionCount {
+		positionMissing := 0
+		for team := range b.sizes {
+			if positionCounts[team][position] < minCount {
+				missing[team] += minCount - positionCounts[team][position]
+				positionMissing += minCount - positionCounts[team][position]
+			}
+		}
+		if positionMissing > b.remainingPositions[idx][position] {
+			return false
+		}
+	}
+	for team, size := range b.sizes {
+		if missing[team] > size-counts[team] {
+			return false
+		}
+	}
+	return true
+}
+
+// refine swaps players between teams while doing so lowers the skill gap plus the objective score
+// and the weighted number of repeated teammate pairings, keeping the skill gap within the target.
+// The best arrangement is then shaken up with random swaps and improved again until the deadline
+// passes.
+func (b *balancer) refine() {
+	random := rand.New(rand.NewSource(b.seed))
+	assign := slices.Clone(b.bestAssign)
+	sums, positionCounts := b.teamState(assign)
+	repeats := b.countRepeats(assign)
+	bestScore := b.bestGap + b.objectiveScore(assign) + b.repeatWeight*float64(repeats)
+
+	for round := 0; round < refineRounds; round++ {
+		for improved := true; improved; {
+			improved = false
+			for i := range b.skills {
+				for j := i + 1; j < len(b.skills); j++ {
+					delta := b.repeatDelta(assign, i, j)
+					score := b.gap(sums) + b.objectiveScore(assign)
+					if !b.trySwap(assign, sums, positionCounts, i, j) {
+						continue
+					}
+					if b.gap(sums)+b.objectiveScore(assign)+b.repeatWeight*float64(delta) < score-skillEpsilon {
+						repeats += delta
+						improved = true
+					} else {
+						b.swap(assign, sums, positionCounts, i, j)
+					}
+				}
+			}
+		}
+
+		if score := b.gap(sums) + b.objectiveScore(assign) + b.repeatWeight*float64(repeats); score < bestScore-skillEpsilon {
+			bestScore = score
+			b.bestGap = b.gap(sums)
+			copy(b.bestAssign, assign)
+		}
+		if time.Now().After(b.deadline) || len(b.skills) < 2 {
+			return
+		}
+
+		copy(assign, b.bestAssign)
+		sums, positionCounts = b.teamState(assign)
+		for shake := 0; shake < refineShakeSwaps; shake++ {
+			i, j := random.Intn(len(b.skills)), random.Intn(len(b.skills))
+			b.trySwap(assign, sums, positionCounts, i, j)
+		}
+		repeats = b.countRepeats(assign)
+	}
+}
+
+// trySwap swaps players i and j between their teams if they are on different teams, the swap keeps
+// to the rules and the skill gap stays within the target. It reports whether the swap was made.
+func (b *balancer) trySwap(assign, sums []int, positionCounts [][]int, i, j int) bool {
+	teamI, teamJ := assign[i], assign[j]
+	if teamI == teamJ || !b.canSwap(positionCounts, i, j, teamI, teamJ) {
+		return false
+	}
+	if !b.canPlace(assign, i, teamJ, len(assign), j) || !b.canPlace(assign, j, teamI, len(assign), i) {
+		return false
+	}
+	b.swap(assign, sums, positionCounts, i, j)
+	if b.gap(sums) > b.target+skillEpsilon {
+		b.swap(assign, sums, positionCounts, i, j)
+		return false
+	}
+	return true
+}
+
+func (b *balancer) swap(assign, sums []int, positionCounts [][]int, i, j int) {
+	teamI, teamJ := assign[i], assign[j]
+	diff := b.skills[i] - b.skills[j]
+	sums[teamI] -= diff
+	sums[teamJ] += diff
+	b.movePosition(positionCounts, i, teamI, teamJ)
+	b.movePosition(positionCounts, j, teamJ, teamI)
+	assign[i], assign[j] = teamJ, teamI
+}
+
+// teamState returns the skill total and position counts of each team in an arrangement
+func (b *balancer) teamState(assign []int) (sums []int, positionCounts [][]int) {
+	sums = make([]int, len(b.sizes))
+	positionCounts = b.newPositionCounts()
+	for i, team := range assign {
+		sums[team] += b.skills[i]
+		if b.positions[i] >= 0 {
+			positionCounts[team][b.positions[i]]++
+		}
+	}
+	return sums, positionCounts
+}
+
+// countRepeats returns the number of teammate pairings in an arrangement which were also teammates
+// in earlier sessions, counting a pairing once for each session
+func (b *balancer) countRepeats(assign []int) int {
+	if b.repeats == nil {
+		return 0
+	}
+	repeats := 0
+	for i := range assign {
+		for j := i + 1; j < len(assign); j++ {
+			if assign[i] == assign[j] {
+				repeats += b.repeats[i][j]
+			}
+		}
+	}
+	return repeats
+}
+
+// repeatDelta returns the change in repeated teammate pairings from swapping players i and j
+func (b *balancer) repeatDelta(assign []int, i, j int) int {
+	teamI, teamJ := assign[i], assign[j]
+	if teamI == teamJ || b.repeats == nil {
+		return 0
+	}
+	delta := 0
+	for k, team := range assign {
+		if k == i || k == j {
+			continue
+		}
+		if team == teamI {
+			delta += b.repeats[j][k] - b.repeats[i][k]
+		} else if team == teamJ {
+			delta += b.repeats[i][k] - b.repeats[j][k]
+		}
+	}
+	return delta
+}
+
+// search assigns players from idx onward to every team with room, pruning partial arrangements
+// which cannot beat the best skill gap found so far. It returns true when the search should stop.
+func (b *balancer) search(idx int, assign, sums, counts []int, positionCounts [][]int) (stop bool) {
+	b.visited++
+	if b.visited%deadlineCheckInterval == 0 && time.Now().After(b.deadline) {
+		b.timedOut = true
+		return true
+	}
+
+	if !b.positionsFeasible(idx, counts, positionCounts) {
+		return false
+	}
+
+	if idx == len(b.skills) {
+		if gap := b.gap(sums); gap < b.bestGap-skillEpsilon {
+			b.bestGap = gap
+			copy(b.bestAssign, assign)
+		}
+		return b.bestGap <= b.target+skillEpsilon
+	}
+
+	if b.partialBound(idx, sums, counts) >= b.bestGap-skillEpsilon {
+		return false
+	}
+
+	// try the teams with the lowest average first to reach good arrangements early
+	position := b.positions[idx]
+	teams := make([]int, 0, len(b.sizes))
+	for team := range b.sizes {
+		if counts[team] == b.sizes[team] || b.isDuplicateTeam(team, sums, counts, positionCounts) {
+			continue
+		}
+		if position >= 0 && positionCounts[team][position] == b.maxPositionCount[position] {
+			continue
+		}
+		if !b.canPlace(assign, idx, team, idx, -1) {
+			continue
+		}
+		teams = append(teams, team)
+	}
+	sort.SliceStable(teams, func(i, j int) bool {
+		return b.average(teams[i], sums) < b.average(teams[j], sums)
+	})
+
+	for _, team := range teams {
+		assign[idx] = team
+		sums[team] += b.skills[idx]
+		counts[team]++
+		if position >= 0 {
+			positionCounts[team][position]++
+		}
+		pinned := len(b.together[idx]) > 0 || len(b.apart[idx]) > 0
+		if pinned {
+			b.pinned[team]++
+		}
+		stop = b.search(idx+1, assign, sums, counts, positionCounts)
+		sums[team] -= b.skills[idx]
+		counts[team]--
+		if position >= 0 {
+			positionCounts[team][position]--
+		}
+		if pinned {
+			b.pinned[team]--
+		}
+		if stop {
+			return true
+		}
+	}
+	return false
+}
+
+// isDuplicateTeam reports whether an earlier team is in an identical state, in which case placing
+// a player on this team would only repeat work. Teams holding players which others must be kept
+// with or away from are never identical.
+func (b *balancer) isDuplicateTeam(team int, sums, counts []int, positionCounts [][]int) bool {
+	if b.pinned[team] > 0 {
+		return false
+	}
+	for other := 0; other < team; other++ {
+		if b.sizes[other] == b.sizes[team] && counts[other] == counts[team] && sums[other] == sums[team] &&
+			b.pinned[other] == 0 && slices.Equal(positionCounts[other], positionCounts[team]) {
+			return true
+		}
+	}
+	return false
+}
+
+// partialBound returns a lower bound on the skill gap of any completion of a partial arrangement
+// in which the players before idx have been assigned.
+func (b *balancer) partialBound(idx int, sums, counts []int) float64 {
+	n := len(b.skills)
+	b.resetGroups()
+	for team, size := range b.sizes {
+		remaining := size - counts[team]
+		// the remaining players are sorted, so the strongest and weakest fills are at either end
+		low := float64(sums[team]+b.prefix[n]-b.prefix[n-remaining]) / b.divisors[team]
+		high := float64(sums[team]+b.prefix[idx+remaining]-b.prefix[idx]) / b.divisors[team]
+		group := b.groups[team]
+		b.groupMax[group] = math.Max(b.groupMax[group], low)
+		b.groupMin[group] = math.Min(b.groupMin[group], high)
+	}
+	return math.Max(0, b.largestGroupGap())
+}
+
+// lowerBound returns a lower bound on the skill gap of any arrangement. When every team is the
+// same size, the team totals are integers which can only be equal if the total divides evenly.
+func (b *balancer) lowerBound() float64 {
+	size := b.sizes[0]
+	for _, s := range b.sizes {
+		if s != size {
+			return 0
+		}
+	}
+	if b.prefix[len(b.skills)]%len(b.sizes) == 0 {
+		return 0
+	}
+	return 1 / b.divisors[0]
+}
+
+// average returns the team skill which is compared between teams, its average or its total
+// depending on the objective
+func (b *balancer) average(team int, sums []int) float64 {
+	return float64(sums[team]) / b.divisors[team]
+}
+
+// gap returns the largest difference between the highest and lowest team averages of a group
+func (b *balancer) gap(sums []int) float64 {
+	b.resetGroups()
+	for team := range sums {
+		average := b.average(team, sums)
+		group := b.groups[team]
+		b.groupMax[group] = math.Max(b.groupMax[group], average)
+		b.groupMin[group] = math.Min(b.groupMin[group], average)
+	}
+	return b.largestGroupGap()
+}
+
+func (b *balancer) resetGroups() {
+	for group := range b.groupMax {
+		b.groupMax[group] = math.Inf(-1)
+		b.groupMin[group] = math.Inf(1)
+	}
+}
+
+// largestGroupGap returns the largest difference between the maximum and minimum of a group
+func (b *balancer) largestGroupGap() float64 {
+	largest := math.Inf(-1)
+	for group := range b.groupMax {
+		largest = math.Max(largest, b.groupMax[group]-b.groupMin[group])
+	}
+	return largest
+}
+
+// objectiveScore measures how far an arrangement is from meeting the objective beyond the skill
+// gap, always 0 for objectives which only measure the skill gap
+func (b *balancer) objectiveScore(assign []int) float64 {
+	switch b.objective {
+	case objectiveVariance:
+		teamSkills := make([][]int, len(b.sizes))
+		for i, team := range assign {
+			teamSkills[team] = append(teamSkills[team], b.skills[i])
+		}
+		spreads := make([]float64, len(b.sizes))
+		for team, skills := range teamSkills {
+			spreads[team] = getSkillSpread(skills)
+		}
+		return b.valueGap(spreads)
+	case objectiveTop:
+		counts := make([]float64, len(b.sizes))
+		for i, team := range assign {
+			if b.skills[i] >= b.topThreshold {
+				counts[team]++
+			}
+		}
+		return b.valueGap(counts)
+	}
+	return 0
+}
+
+// valueGap returns the largest difference between the highest and lowest value of a group
+func (b *balancer) valueGap(values []float64) float64 {
+	b.resetGroups()
+	for team, value := range values {
+		group := b.groups[team]
+		b.groupMax[group] = math.Max(b.groupMax[group], value)
+		b.groupMin[group] = math.Min(b.groupMin[group], value)
+	}
+	return b.largestGroupGap()
+}
+
+// getSkillSpread returns the standard deviation of the skills
+func getSkillSpread(skills []int) float64 {
+	if len(skills) == 0 {
+		return 0
+	}
+	sum, sumSquares := 0, 0
+	for _, skill := range skills {
+		sum += skill
+		sumSquares += skill * skill
+	}
+	mean := float64(sum) / float64(len(skills))
+	return math.Sqrt(math.Max(0, float64(sumSquares)/float64(len(skills))-mean*mean))
+}
+
+// getTopThreshold returns the skill needed to be one of the count strongest players. No skill meets
+// the threshold if count is not positive or there are no players.
+func getTopThreshold(skills []int, count int) int {
+	if count <= 0 || len(skills) == 0 {
+		return math.MaxInt
+	}
+	sorted := slices.Clone(skills)
+	slices.Sort(sorted)
+	return sorted[len(sorted)-min(count, len(sorted))]
+}
+
+// getSizeGroups returns the group of each team, where each group holds the teams which play against
+// each other. Each group starts at the smallest size not yet grouped and takes the sizes at most
+// one larger, so that the sizes within a group never differ by more than one.
+func getSizeGroups(sizes []int) []int {
+	distinct := slices.Clone(sizes)
+	slices.Sort(distinct)
+	distinct = slices.Compact(distinct)
+
+	groupOfSize := make(map[int]int, len(distinct))
+	group, anchor := 0, 0
+	for i, size := range distinct {
+		if i == 0 {
+			anchor = size
+		} else if size-anchor > 1 {
+			group++
+			anchor = size
+		}
+		groupOfSize[size] = group
+	}
+
+	groups := make([]int, len(sizes))
+	for team, size := range sizes {
+		groups[team] = groupOfSize[size]
+	}
+	return groups
+}
+
+// getSkillGap returns the largest difference between the skill averages of teams which play against
+// each other
+func getSkillGap(averages []float64, sizes []int) float64 {
+	groups := getSizeGroups(sizes)
+	gap := float64(0)
+	for i := range averages {
+		for j := i + 1; j < len(averages); j++ {
+			if groups[i] == groups[j] {
+				gap = math.Max(gap, math.Abs(averages[i]-averages[j]))
+			}
+		}
+	}
+	return gap
+}
+
+// getObjectiveMaxSkillGap returns the largest skill gap allowed between teams balanced by the
+// objective. The max skill gap is a gap between team averages, so it is scaled by the size of the
+// largest team when teams are balanced by their totals.
+func getObjectiveMaxSkillGap(maxSkillGap float64, objective string, sizes []int) float64 {
+	if objective != objectiveTotal || len(sizes) == 0 {
+		return maxSkillGap
+	}
+	return maxSkillGap * float64(slices.Max(sizes))
+}
+
+// getSkillGapLabel names the skill gap of teams balanced by the objective, which is between team
+// totals rather than averages for objectiveTotal
+func getSkillGapLabel(objective string) string {
+	if objective == objectiveTotal {
+		return "total skill gap"
+	}
+	return "skill gap"
+}
+
+// spread returns the sum of the squared differences between each team average and the mean
+func (b *balancer) spread(sums []int) float64 {
+	mean := float64(b.prefix[len(b.skills)]) / float64(len(b.skills))
+	spread := float64(0)
+	for team := range sums {
+		diff := b.average(team, sums) - mean
+		spread += diff * diff
+	}
+	return spread
+}
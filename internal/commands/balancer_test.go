@@ -0,0 +1,333 @@
+package commands
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+)
+
+// getTestPlayers returns count players with skills drawn from 1 to 10, the same for every seed
+func getTestPlayers(count int, seed int64) []Player {
+	random := rand.New(rand.NewSource(seed))
+	players := make([]Player, count)
+	for i := range players {
+		players[i] = Player{ID: fmt.Sprintf("p%d", i), Skill: 1 + random.Intn(10)}
+	}
+	return players
+}
+
+// getAssignmentGap returns the skill gap between the team averages of an assignment
+func getAssignmentGap(players []Player, assignment []int, sizes []int) float64 {
+	sums := make([]float64, len(sizes))
+	for i, team := range assignment {
+		sums[team] += float64(players[i].Skill)
+	}
+	averages := make([]float64, len(sizes))
+	for team, size := range sizes {
+		averages[team] = sums[team] / float64(size)
+	}
+	return getSkillGap(averages, sizes)
+}
+
+// bruteForceGap returns the smallest skill gap of any assignment of the players to teams of the
+// given sizes which meets the rules, or +Inf if none does
+func bruteForceGap(players []Player, rules balanceRules, sizes []int) float64 {
+	numPositions := 0
+	for _, position := range rules.positions {
+		numPositions = max(numPositions, position+1)
+	}
+	positionTotals := make([]int, numPositions)
+	for _, position := range rules.positions {
+		if position >= 0 {
+			positionTotals[position]++
+		}
+	}
+
+	best := math.Inf(1)
+	assignment := make([]int, len(players))
+	counts := make([]int, len(sizes))
+	var assign func(idx int)
+	assign = func(idx int) {
+		if idx < len(players) {
+			for team, size := range sizes {
+				if counts[team] < size {
+					assignment[idx] = team
+					counts[team]++
+					assign(idx + 1)
+					counts[team]--
+				}
+			}
+			return
+		}
+		for _, pair := range rules.together {
+			if assignment[pair[0]] != assignment[pair[1]] {
+				return
+			}
+		}
+		for _, pair := range rules.apart {
+			if assignment[pair[0]] == assignment[pair[1]] {
+				return
+			}
+		}
+		for position, total := range positionTotals {
+			for team := range sizes {
+				count := 0
+				for i, p := range rules.positions {
+					if p == position && assignment[i] == team {
+						count++
+					}
+				}
+				if count < total/len(sizes) || count > (total+len(sizes)-1)/len(sizes) {
+					return
+				}
+			}
+		}
+		best = math.Min(best, getAssignmentGap(players, assignment, sizes))
+	}
+	assign(0)
+	return best
+}
+
+// checkAssignment fails the test if the assignment does not fill each team to its size or breaks a
+// together or apart rule
+func checkAssignment(t *testing.T, assignment []int, rules balanceRules, sizes []int) {
+	t.Helper()
+	counts := make([]int, len(sizes))
+	for _, team := range assignment {
+		counts[team]++
+	}
+	if !slices.Equal(counts, sizes) {
+		t.Errorf("team sizes %v, want %v", counts, sizes)
+	}
+	for _, pair := range rules.together {
+		if assignment[pair[0]] != assignment[pair[1]] {
+			t.Errorf("players %d and %d were split up", pair[0], pair[1])
+		}
+	}
+	for _, pair := range rules.apart {
+		if assignment[pair[0]] == assignment[pair[1]] {
+			t.Errorf("players %d and %d were placed together", pair[0], pair[1])
+		}
+	}
+}
+
+func TestBalanceMatchesBruteForce(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		sizes []int
+		rules balanceRules
+	}{
+		{"2 teams of 2", 4, []int{2, 2}, balanceRules{}},
+		{"2 teams of 4", 8, []int{4, 4}, balanceRules{}},
+		{"uneven teams", 7, []int{4, 3}, balanceRules{}},
+		{"3 teams of 3", 9, []int{3, 3, 3}, balanceRules{}},
+		{"separate courts", 9, []int{2, 2, 5}, balanceRules{}},
+		{"together", 8, []int{4, 4}, balanceRules{together: [][2]int{{0, 1}, {2, 3}}}},
+		{"apart", 8, []int{4, 4}, balanceRules{apart: [][2]int{{0, 1}, {1, 2}}}},
+		{"positions", 8, []int{4, 4}, balanceRules{positions: []int{0, 0, 0, 1, 1, 1, -1, -1}}},
+		{"positions and pairs", 9, []int{3, 3, 3}, balanceRules{
+			positions: []int{0, 0, 0, 1, 1, 1, 2, 2, 2},
+			together:  [][2]int{{0, 3}},
+			apart:     [][2]int{{4, 6}},
+		}},
+	}
+	for _, test := range tests {
+		for seed := int64(0); seed < 20; seed++ {
+			t.Run(fmt.Sprintf("%s seed %d", test.name, seed), func(t *testing.T) {
+				players := getTestPlayers(test.count, seed)
+				want := bruteForceGap(players, test.rules, test.sizes)
+
+				// a target of 0 makes the balancer search until it proves its gap is the smallest
+				assignment, gap, optimal := newBalancer(players, test.rules, test.sizes, 0, time.Minute).balance()
+				if assignment == nil {
+					t.Fatalf("no assignment found, brute force gap %g", want)
+				}
+				checkAssignment(t, assignment, test.rules, test.sizes)
+				if math.Abs(gap-want) > skillEpsilon {
+					t.Errorf("gap %g, brute force gap %g", gap, want)
+				}
+				if math.Abs(getAssignmentGap(players, assignment, test.sizes)-gap) > skillEpsilon {
+					t.Errorf("reported gap %g does not match the assignment", gap)
+				}
+				if !optimal {
+					t.Error("the search ran to completion but was not reported optimal")
+				}
+			})
+		}
+	}
+}
+
+func TestBalanceInfeasible(t *testing.T) {
+	players := getTestPlayers(6, 1)
+	// three players who must all be apart cannot fit on two teams
+	rules := balanceRules{apart: [][2]int{{0, 1}, {1, 2}, {0, 2}}}
+	assignment, _, optimal := newBalancer(players, rules, []int{3, 3}, 1, time.Minute).balance()
+	if assignment != nil {
+		t.Errorf("assignment %v breaks the apart rules", assignment)
+	}
+	if !optimal {
+		t.Error("the arrangement was not proven impossible")
+	}
+}
+
+func TestBalanceDeterministic(t *testing.T) {
+	players := getTestPlayers(16, 3)
+	sizes := []int{4, 4, 4, 4}
+	// the variance and top objectives are refined with random swaps after the search
+	for _, objective := range []string{objectiveAverage, objectiveVariance, objectiveTop} {
+		balance := func() ([]int, float64) {
+			assignment, gap, _ := newBalancer(players, balanceRules{}, sizes, 1, time.Minute).
+				withObjective(objective, len(sizes)).balance()
+			return assignment, gap
+		}
+		first, firstGap := balance()
+		for run := 0; run < 5; run++ {
+			if assignment, gap := balance(); !slices.Equal(assignment, first) || gap != firstGap {
+				t.Fatalf("%s run %d gave %v with gap %g, first run gave %v with gap %g", objective, run, assignment, gap, first, firstGap)
+			}
+		}
+	}
+}
+
+func TestBalanceTimeout(t *testing.T) {
+	players := getTestPlayers(60, 4)
+	sizes := []int{6, 6, 6, 6, 6, 6, 6, 6, 6, 6}
+	// a passed deadline stops the search at once, leaving the seeded arrangement
+	assignment, gap, _ := newBalancer(players, balanceRules{}, sizes, 0, -time.Second).balance()
+	if assignment == nil {
+		t.Fatal("no assignment found")
+	}
+	checkAssignment(t, assignment, balanceRules{}, sizes)
+	if math.Abs(getAssignmentGap(players, assignment, sizes)-gap) > skillEpsilon {
+		t.Errorf("reported gap %g does not match the assignment", gap)
+	}
+}
+
+// shuffleBalance is the balancer spike used before, which shuffles the players into teams until
+// the gap is within maxSkillGap or the time limit passes
+func shuffleBalance(players []Player, sizes []int, maxSkillGap float64, timeLimit time.Duration) float64 {
+	deadline := time.Now().Add(timeLimit)
+	arrangement := make([]int, len(players))
+	for i := range arrangement {
+		arrangement[i] = i
+	}
+	assignment := make([]int, len(players))
+	best := math.Inf(1)
+	for {
+		rand.Shuffle(len(arrangement), func(i, j int) {
+			arrangement[i], arrangement[j] = arrangement[j], arrangement[i]
+		})
+		playerIdx := 0
+		for team, size := range sizes {
+			for ; size > 0; size-- {
+				assignment[arrangement[playerIdx]] = team
+				playerIdx++
+			}
+		}
+		best = math.Min(best, getAssignmentGap(players, assignment, sizes))
+		if best <= maxSkillGap || time.Now().After(deadline) {
+			return best
+		}
+	}
+}
+
+func BenchmarkBalance(b *testing.B) {
+	for _, count := range []int{8, 16, 32, 60} {
+		players := getTestPlayers(count, int64(count))
+		sizes := getTeamSizes(count, count/4)
+		// a target of 0 can rarely be met, so both search until the time limit or a perfect split
+		b.Run(fmt.Sprintf("balancer/%d", count), func(b *testing.B) {
+			gap := 0.0
+			for i := 0; i < b.N; i++ {
+				_, gap, _ = newBalancer(players, balanceRules{}, sizes, 0, teamGenTimeLimit).balance()
+			}
+			b.ReportMetric(gap, "gap")
+		})
+		b.Run(fmt.Sprintf("shuffler/%d", count), func(b *testing.B) {
+			gap := 0.0
+			for i := 0; i < b.N; i++ {
+				gap = shuffleBalance(players, sizes, 0, teamGenTimeLimit)
+			}
+			b.ReportMetric(gap, "gap")
+		})
+	}
+}
+
+func TestObjectiveMaxSkillGap(t *testing.T) {
+	tests := []struct {
+		objective string
+		sizes     []int
+		want      float64
+	}{
+		{objectiveAverage, []int{4, 4}, 1},
+		{objectiveTop, []int{4, 4}, 1},
+		{objectiveTotal, []int{4, 4}, 4},
+		{objectiveTotal, []int{5, 4, 4}, 5},
+	}
+	for _, test := range tests {
+		if got := getObjectiveMaxSkillGap(1, test.objective, test.sizes); got != test.want {
+			t.Errorf("%s with sizes %v: max skill gap %g, want %g", test.objective, test.sizes, got, test.want)
+		}
+	}
+}
+
+func TestBalanceTopCount(t *testing.T) {
+	// the strongest two and four players can both be split evenly within the skill gap
+	players := []Player{
+		{ID: "a", Skill: 10}, {ID: "b", Skill: 10}, {ID: "c", Skill: 9}, {ID: "d", Skill: 9},
+		{ID: "e", Skill: 2}, {ID: "f", Skill: 2}, {ID: "g", Skill: 1}, {ID: "h", Skill: 1},
+	}
+	sizes := []int{4, 4}
+	for _, topCount := range []int{2, 4} {
+		assignment, _, _ := newBalancer(players, balanceRules{}, sizes, 1, time.Minute).
+			withObjective(objectiveTop, topCount).balance()
+		counts := make([]int, len(sizes))
+		for i := 0; i < topCount; i++ {
+			counts[assignment[i]]++
+		}
+		if counts[0] != counts[1] {
+			t.Errorf("top %d split %v, want an even split", topCount, counts)
+		}
+	}
+}
+
+func TestTopThreshold(t *testing.T) {
+	tests := []struct {
+		skills []int
+		count  int
+		want   int
+	}{
+		{[]int{3, 9, 5, 7}, 2, 7},
+		{[]int{3, 9, 5, 7}, 10, 3},
+		{[]int{3, 9, 5, 7}, 0, math.MaxInt},
+		{nil, 2, math.MaxInt},
+	}
+	for _, test := range tests {
+		if got := getTopThreshold(test.skills, test.count); got != test.want {
+			t.Errorf("getTopThreshold(%v, %d) = %d, want %d", test.skills, test.count, got, test.want)
+		}
+	}
+}
+
+func TestSizeGroups(t *testing.T) {
+	tests := []struct {
+		sizes []int
+		want  []int
+	}{
+		{[]int{4, 4}, []int{0, 0}},
+		{[]int{5, 4, 4}, []int{0, 0, 0}},
+		{[]int{6, 6, 4, 4}, []int{1, 1, 0, 0}},
+		// sizes which differ by one each step are not chained into a single group
+		{[]int{4, 5, 6}, []int{0, 0, 1}},
+		{[]int{7, 6, 5, 4, 3}, []int{2, 1, 1, 0, 0}},
+	}
+	for _, test := range tests {
+		if got := getSizeGroups(test.sizes); !slices.Equal(got, test.want) {
+			t.Errorf("sizes %v: groups %v, want %v", test.sizes, got, test.want)
+		}
+	}
+}
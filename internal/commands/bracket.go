@@ -0,0 +1,378 @@
+package commands
+
+// This file builds the matches of a tournament and advances teams through them as results come in.
+// Every match lists where its two sides come from, either an entrant placed when the match was
+// created or the winner or loser of an earlier match, so the whole bracket is known up front and a
+// side is filled in as soon as the match it comes from is decided. Brackets are padded to a power of
+// two with byes, which the seeds at the top of the bracket receive, and a team facing a bye
+// advances without playing.
+//
+// A double elimination bracket sends the loser of each winners bracket match to the losers
+// bracket, where they play the survivors of the losers bracket until one team remains to face the
+// winners bracket champion in the grand final. If the losers bracket team wins the grand final,
+// each team has lost once and a reset match decides the champion. Pool play splits the teams into
+// pools which each play a round robin, then the top teams of each pool advance to a single
+// elimination bracket.
+
+import (
+	"sort"
+)
+
+const (
+	tournamentSingle = "single_elimination"
+	tournamentDouble = "double_elimination"
+	tournamentPools  = "pools"
+)
+
+const (
+	bracketPool    = "pool"
+	bracketWinners = "winners"
+	bracketLosers  = "losers"
+	bracketFinal   = "final"
+)
+
+// entrant indices of match sides which are not filled by an entrant
+const (
+	// the side is decided by an earlier match which has not been played
+	tournamentTBD = -1
+	// nobody fills the side, so the other side advances without playing
+	tournamentBye = -2
+)
+
+// newTournament builds the matches of a tournament between entrants given in seed order. For pool
+// play the number of pools and the number of teams advancing from each must be given, which are
+// reduced when there are too few teams for them.
+func newTournament(format string, entrants []TournamentEntrant, numPools, advance int) Tournament {
+	tournament := Tournament{Format: format, Entrants: entrants, Final: -1}
+	seeds := make([]int, len(entrants))
+	for i := range seeds {
+		seeds[i] = i
+	}
+
+	switch format {
+	case tournamentDouble:
+		tournament.addDoubleElimination(seeds)
+	case tournamentPools:
+		// every pool needs at least two teams
+		numPools = max(1, min(numPools, len(entrants)/2))
+		tournament.Pools = make([][]int, numPools)
+		for seed := range seeds {
+			// snake the seeds between the pools so each pool is as strong as the others
+			pool := seed % numPools
+			if (seed/numPools)%2 == 1 {
+				pool = numPools - 1 - pool
+			}
+			tournament.Pools[pool] = append(tournament.Pools[pool], seed)
+		}
+		smallestPool := len(entrants)
+		for _, pool := range tournament.Pools {
+			smallestPool = min(smallestPool, len(pool))
+		}
+		// at least two teams must advance to make a bracket
+		tournament.Advance = max(min(advance, smallestPool), (2+numPools-1)/numPools)
+		tournament.addPoolMatches()
+	default:
+		rounds := tournament.addSingleElimination(seeds, bracketWinners)
+		tournament.Final = rounds[len(rounds)-1][0]
+	}
+	tournament.resolve()
+	return tournament
+}
+
+// addMatch appends a match and returns its index
+func (t *Tournament) addMatch(match TournamentMatch) int {
+	match.Winner = tournamentTBD
+	t.Matches = append(t.Matches, match)
+	return len(t.Matches) - 1
+}
+
+// getSeedOrder returns the seeds of a bracket of the given power of two size in the order of the
+// first round matches, such that the top seeds can only meet in the later rounds
+func getSeedOrder(size int) []int {
+	order := []int{0}
+	for len(order) < size {
+		next := make([]int, 0, 2*len(order))
+		for _, seed := range order {
+			next = append(next, seed, 2*len(order)-1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+// addSingleElimination adds a single elimination bracket between the entrants, given in seed
+// order. It returns the match indices of each round, so the last round holds the final.
+func (t *Tournament) addSingleElimination(entrants []int, bracket string) [][]int {
+	size := 1
+	for size < len(entrants) {
+		size *= 2
+	}
+	order := getSeedOrder(max(size, 2))
+
+	rounds := [][]int{{}}
+	for i := 0; i < len(order); i += 2 {
+		match := TournamentMatch{Bracket: bracket, Round: 1}
+		for side := 0; side < 2; side++ {
+			match.Entrants[side] = tournamentBye
+			if seed := order[i+side]; seed < len(entrants) {
+				match.Entrants[side] = entrants[seed]
+			}
+		}
+		rounds[0] = append(rounds[0], t.addMatch(match))
+	}
+	for len(rounds[len(rounds)-1]) > 1 {
+		prev := rounds[len(rounds)-1]
+		round := []int{}
+		for i := 0; i < len(prev); i += 2 {
+			round = append(round, t.addMatch(TournamentMatch{
+				Bracket:  bracket,
+				Round:    len(rounds) + 1,
+				Entrants: [2]int{tournamentTBD, tournamentTBD},
+				Sources:  [2]*MatchSource{{Match: prev[i]}, {Match: prev[i+1]}},
+			}))
+		}
+		rounds = append(rounds, round)
+	}
+	return rounds
+}
+
+// addDoubleElimination adds a winners bracket, a losers bracket and the grand final between the
+// entrants, given in seed order
+func (t *Tournament) addDoubleElimination(entrants []int) {
+	winners := t.addSingleElimination(entrants, bracketWinners)
+	winnersFinal := winners[len(winners)-1][0]
+
+	// with only two teams the loser of the winners bracket goes straight to the grand final
+	losersChampion := &MatchSource{Match: winnersFinal, Loser: true}
+	if len(winners) > 1 {
+		// the losers of the first round play each other
+		prev := []int{}
+		for i := 0; i < len(winners[0]); i += 2 {
+			prev = append(prev, t.addMatch(TournamentMatch{
+				Bracket:  bracketLosers,
+				Round:    1,
+				Entrants: [2]int{tournamentTBD, tournamentTBD},
+				Sources:  [2]*MatchSource{{Match: winners[0][i], Loser: true}, {Match: winners[0][i+1], Loser: true}},
+			}))
+		}
+		losersRound := 1
+		for winnersRound := 1; winnersRound < len(winners); winnersRound++ {
+			// the losers of each later winners round drop in against the losers bracket survivors,
+			// in reverse order to avoid rematches of the winners bracket
+			dropIns := winners[winnersRound]
+			losersRound++
+			round := []int{}
+			for i, match := range prev {
+				round = append(round, t.addMatch(TournamentMatch{
+					Bracket:  bracketLosers,
+					Round:    losersRound,
+					Entrants: [2]int{tournamentTBD, tournamentTBD},
+					Sources:  [2]*MatchSource{{Match: match}, {Match: dropIns[len(dropIns)-1-i], Loser: true}},
+				}))
+			}
+			prev = round
+			if len(prev) == 1 {
+				break
+			}
+
+			// then the survivors play each other
+			losersRound++
+			round = []int{}
+			for i := 0; i < len(prev); i += 2 {
+				round = append(round, t.addMatch(TournamentMatch{
+					Bracket:  bracketLosers,
+					Round:    losersRound,
+					Entrants: [2]int{tournamentTBD, tournamentTBD},
+					Sources:  [2]*MatchSource{{Match: prev[i]}, {Match: prev[i+1]}},
+				}))
+			}
+			prev = round
+		}
+		losersChampion = &MatchSource{Match: prev[0]}
+	}
+
+	t.Final = t.addMatch(TournamentMatch{
+		Bracket:  bracketFinal,
+		Round:    1,
+		Entrants: [2]int{tournamentTBD, tournamentTBD},
+		Sources:  [2]*MatchSource{{Match: winnersFinal}, losersChampion},
+	})
+}
+
+// addPoolMatches adds a round robin within each pool
+func (t *Tournament) addPoolMatches() {
+	for poolIdx, pool := range t.Pools {
+		for roundIdx, round := range getRoundRobinRounds(len(pool), len(pool)/2) {
+			for _, pairing := range round {
+				t.addMatch(TournamentMatch{
+					Bracket:  bracketPool,
+					Round:    roundIdx + 1,
+					Pool:     poolIdx,
+					Entrants: [2]int{pool[pairing[0]-1], pool[pairing[1]-1]},
+				})
+			}
+		}
+	}
+}
+
+// loser returns the entrant index of the loser of a decided match
+func (match TournamentMatch) loser() int {
+	switch match.Winner {
+	case tournamentBye:
+		return tournamentBye
+	case match.Entrants[0]:
+		return match.Entrants[1]
+	default:
+		return match.Entrants[0]
+	}
+}
+
+// isReady returns whether both sides of an undecided match are filled by entrants
+func (match TournamentMatch) isReady() bool {
+	return match.Winner == tournamentTBD &&
+		match.Entrants[0] >= 0 && match.Entrants[1] >= 0
+}
+
+// resolve fills in the sides decided by earlier matches and advances teams facing byes. Once the
+// pools are complete it creates the bracket, and if the losers bracket team wins the grand final it
+// adds the reset match.
+func (t *Tournament) resolve() {
+	for i := range t.Matches {
+		match := &t.Matches[i]
+		if match.Winner != tournamentTBD {
+			continue
+		}
+		for side, source := range match.Sources {
+			if source == nil || match.Entrants[side] != tournamentTBD {
+				continue
+			}
+			sourceMatch := t.Matches[source.Match]
+			if sourceMatch.Winner == tournamentTBD {
+				continue
+			}
+			if source.Loser {
+				match.Entrants[side] = sourceMatch.loser()
+			} else {
+				match.Entrants[side] = sourceMatch.Winner
+			}
+		}
+		if match.Entrants[0] == tournamentBye {
+			match.Winner = match.Entrants[1]
+		} else if match.Entrants[1] == tournamentBye {
+			match.Winner = match.Entrants[0]
+		}
+	}
+
+	if t.Format == tournamentPools && t.Final == -1 && t.poolsComplete() {
+		rounds := t.addSingleElimination(t.getAdvancing(), bracketWinners)
+		t.Final = rounds[len(rounds)-1][0]
+		t.resolve()
+		return
+	}
+
+	if t.Format != tournamentDouble {
+		return
+	}
+	final := t.Matches[t.Final]
+	if final.Bracket == bracketFinal && final.Round == 1 &&
+		final.Winner != tournamentTBD && final.Winner == final.Entrants[1] {
+		t.Final = t.addMatch(TournamentMatch{
+			Bracket:  bracketFinal,
+			Round:    2,
+			Entrants: final.Entrants,
+		})
+	}
+}
+
+// poolsComplete returns whether every pool match has been decided
+func (t *Tournament) poolsComplete() bool {
+	for _, match := range t.Matches {
+		if match.Bracket == bracketPool && match.Winner == tournamentTBD {
+			return false
+		}
+	}
+	return true
+}
+
+// poolStanding is the record of an entrant within their pool
+type poolStanding struct {
+	Entrant int
+	Wins    int
+	Losses  int
+	// the points scored minus the points conceded
+	PointDiff int
+}
+
+// getPoolStandings returns the standings of each pool, ranked by wins, then point difference, then
+// seed
+func (t *Tournament) getPoolStandings() [][]poolStanding {
+	standings := make([][]poolStanding, len(t.Pools))
+	for poolIdx, pool := range t.Pools {
+		byEntrant := map[int]*poolStanding{}
+		for _, entrant := range pool {
+			byEntrant[entrant] = &poolStanding{Entrant: entrant}
+		}
+		for _, match := range t.Matches {
+			if match.Bracket != bracketPool || match.Pool != poolIdx || match.Winner == tournamentTBD {
+				continue
+			}
+			for side, entrant := range match.Entrants {
+				standing := byEntrant[entrant]
+				if entrant == match.Winner {
+					standing.Wins++
+				} else {
+					standing.Losses++
+				}
+				standing.PointDiff += match.Scores[side] - match.Scores[1-side]
+			}
+		}
+		for _, entrant := range pool {
+			standings[poolIdx] = append(standings[poolIdx], *byEntrant[entrant])
+		}
+		sort.SliceStable(standings[poolIdx], func(i, j int) bool {
+			a, b := standings[poolIdx][i], standings[poolIdx][j]
+			if a.Wins != b.Wins {
+				return a.Wins > b.Wins
+			}
+			if a.PointDiff != b.PointDiff {
+				return a.PointDiff > b.PointDiff
+			}
+			return a.Entrant < b.Entrant
+		})
+	}
+	return standings
+}
+
+// getAdvancing returns the entrants advancing from the pools in seed order for the bracket. Pool
+// winners are seeded above runners up and ranked by their pool record, then by their original seed.
+// Teams with a lower place follow in the same order of pools as the winners, so the top seeds meet
+// teams from the other pools first.
+func (t *Tournament) getAdvancing() []int {
+	standings := t.getPoolStandings()
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i][0], standings[j][0]
+		if a.Wins-a.Losses != b.Wins-b.Losses {
+			return a.Wins-a.Losses > b.Wins-b.Losses
+		}
+		if a.PointDiff != b.PointDiff {
+			return a.PointDiff > b.PointDiff
+		}
+		return a.Entrant < b.Entrant
+	})
+	advancing := []int{}
+	for place := 0; place < t.Advance; place++ {
+		for _, pool := range standings {
+			advancing = append(advancing, pool[place].Entrant)
+		}
+	}
+	return advancing
+}
+
+// getChampion returns the entrant index of the tournament champion, ok is false until the
+// tournament is complete
+func (t *Tournament) getChampion() (entrant int, ok bool) {
+	if t.Final == -1 || t.Matches[t.Final].Winner == tournamentTBD {
+		return 0, false
+	}
+	return t.Matches[t.Final].Winner, true
+}
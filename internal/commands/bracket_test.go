@@ -0,0 +1,282 @@
+package commands
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// getTestEntrants returns count entrants in seed order
+func getTestEntrants(count int) []TournamentEntrant {
+	entrants := make([]TournamentEntrant, count)
+	for i := range entrants {
+		entrants[i] = TournamentEntrant{TeamNumber: i + 1}
+	}
+	return entrants
+}
+
+// higherSeedWins picks the side with the better seed as the winner of a match
+func higherSeedWins(match TournamentMatch) int {
+	if match.Entrants[0] < match.Entrants[1] {
+		return 0
+	}
+	return 1
+}
+
+// playTournament reports a result for each match as soon as it is ready, the way /tournament report
+// does, until no match is left to play. It returns the indices of the matches played.
+func playTournament(t *testing.T, tournament *Tournament, winnerSide func(match TournamentMatch) int) []int {
+	t.Helper()
+	played := []int{}
+	for {
+		idx := slices.IndexFunc(tournament.Matches, TournamentMatch.isReady)
+		if idx == -1 {
+			return played
+		}
+		if len(played) > 100 {
+			t.Fatal("the tournament never finished")
+		}
+		match := &tournament.Matches[idx]
+		side := winnerSide(*match)
+		match.Winner = match.Entrants[side]
+		match.Scores[side], match.Scores[1-side] = 21, 15
+		tournament.resolve()
+		played = append(played, idx)
+	}
+}
+
+// getLosses counts the matches each entrant lost out of the matches played
+func getLosses(tournament Tournament, played []int) []int {
+	losses := make([]int, len(tournament.Entrants))
+	for _, idx := range played {
+		losses[tournament.Matches[idx].loser()]++
+	}
+	return losses
+}
+
+// checkFirstRound fails the test unless the first round of the bracket pairs the seeds so that
+// each pair adds up to the same total, with the byes given to the top seeds
+func checkFirstRound(t *testing.T, tournament Tournament, entrants []int) {
+	t.Helper()
+	size := 2
+	for size < len(entrants) {
+		size *= 2
+	}
+	// seeds within the bracket, which differ from the entrant indices after pool play
+	seedOf := map[int]int{tournamentBye: size - 1}
+	for seed, entrant := range entrants {
+		seedOf[entrant] = seed
+	}
+	byes := 0
+	for _, match := range tournament.Matches {
+		if match.Bracket != bracketWinners || match.Round != 1 {
+			continue
+		}
+		a, b := match.Entrants[0], match.Entrants[1]
+		if b == tournamentBye {
+			byes++
+			if seedOf[a] >= size-len(entrants) {
+				t.Errorf("seed %d has a bye, only the top %d seeds should", seedOf[a], size-len(entrants))
+			}
+			continue
+		}
+		if seedOf[a]+seedOf[b] != size-1 {
+			t.Errorf("seeds %d and %d meet in the first round of a bracket of %d", seedOf[a], seedOf[b], size)
+		}
+	}
+	if byes != size-len(entrants) {
+		t.Errorf("%d byes in a bracket of %d for %d entrants, want %d", byes, size, len(entrants), size-len(entrants))
+	}
+}
+
+func TestSeedOrder(t *testing.T) {
+	tests := []struct {
+		size int
+		want []int
+	}{
+		{1, []int{0}},
+		{2, []int{0, 1}},
+		{4, []int{0, 3, 1, 2}},
+		{8, []int{0, 7, 3, 4, 1, 6, 2, 5}},
+	}
+	for _, test := range tests {
+		if got := getSeedOrder(test.size); !slices.Equal(got, test.want) {
+			t.Errorf("seed order of %d: %v, want %v", test.size, got, test.want)
+		}
+	}
+}
+
+func TestSingleElimination(t *testing.T) {
+	for count := 2; count <= 9; count++ {
+		t.Run(fmt.Sprintf("%d entrants", count), func(t *testing.T) {
+			tournament := newTournament(tournamentSingle, getTestEntrants(count), 0, 0)
+			seeds := make([]int, count)
+			for i := range seeds {
+				seeds[i] = i
+			}
+			checkFirstRound(t, tournament, seeds)
+
+			played := playTournament(t, &tournament, higherSeedWins)
+			if len(played) != count-1 {
+				t.Errorf("%d matches played, want %d", len(played), count-1)
+			}
+			if champion, ok := tournament.getChampion(); !ok || champion != 0 {
+				t.Errorf("champion %d (decided %t), want the top seed", champion, ok)
+			}
+			// the top two seeds are in different halves, so they only meet in the final
+			if final := tournament.Matches[tournament.Final]; final.Entrants != [2]int{0, 1} {
+				t.Errorf("final between %v, want the top two seeds", final.Entrants)
+			}
+			for entrant, losses := range getLosses(tournament, played) {
+				if want := min(entrant, 1); losses != want {
+					t.Errorf("entrant %d lost %d times, want %d", entrant, losses, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDoubleElimination(t *testing.T) {
+	for count := 2; count <= 9; count++ {
+		t.Run(fmt.Sprintf("%d entrants", count), func(t *testing.T) {
+			tournament := newTournament(tournamentDouble, getTestEntrants(count), 0, 0)
+			seeds := make([]int, count)
+			for i := range seeds {
+				seeds[i] = i
+			}
+			checkFirstRound(t, tournament, seeds)
+
+			played := playTournament(t, &tournament, higherSeedWins)
+			if len(played) != 2*count-2 {
+				t.Errorf("%d matches played, want %d", len(played), 2*count-2)
+			}
+			if champion, ok := tournament.getChampion(); !ok || champion != 0 {
+				t.Errorf("champion %d (decided %t), want the top seed", champion, ok)
+			}
+			if final := tournament.Matches[tournament.Final]; final.Bracket != bracketFinal || final.Round != 1 {
+				t.Errorf("the %s bracket round %d decided the champion, want the grand final", final.Bracket, final.Round)
+			}
+			// every team but the champion is knocked out by its second loss
+			for entrant, losses := range getLosses(tournament, played) {
+				if want := 2 * min(entrant, 1); losses != want {
+					t.Errorf("entrant %d lost %d times, want %d", entrant, losses, want)
+				}
+			}
+
+			// each team which loses in the winners bracket drops into the losers bracket, or the
+			// grand final for the loser of the winners final
+			for i, idx := range played {
+				match := tournament.Matches[idx]
+				if match.Bracket != bracketWinners {
+					continue
+				}
+				dropped := slices.ContainsFunc(played[i+1:], func(later int) bool {
+					laterMatch := tournament.Matches[later]
+					return laterMatch.Bracket != bracketWinners && slices.Contains(laterMatch.Entrants[:], match.loser())
+				})
+				if !dropped {
+					t.Errorf("entrant %d lost winners round %d but did not play again", match.loser(), match.Round)
+				}
+			}
+		})
+	}
+}
+
+func TestDoubleEliminationReset(t *testing.T) {
+	for count := 2; count <= 9; count++ {
+		t.Run(fmt.Sprintf("%d entrants", count), func(t *testing.T) {
+			tournament := newTournament(tournamentDouble, getTestEntrants(count), 0, 0)
+			// the losers bracket team wins the first grand final, and the top seed wins the reset
+			played := playTournament(t, &tournament, func(match TournamentMatch) int {
+				if match.Bracket == bracketFinal && match.Round == 1 {
+					return 1
+				}
+				return higherSeedWins(match)
+			})
+			if len(played) != 2*count-1 {
+				t.Errorf("%d matches played, want %d", len(played), 2*count-1)
+			}
+			final := tournament.Matches[tournament.Final]
+			if final.Bracket != bracketFinal || final.Round != 2 {
+				t.Fatalf("the %s bracket round %d decided the champion, want the reset", final.Bracket, final.Round)
+			}
+			if first := tournament.Matches[played[len(played)-2]]; first.Entrants != final.Entrants {
+				t.Errorf("reset between %v, want the grand final teams %v", final.Entrants, first.Entrants)
+			}
+			if champion, ok := tournament.getChampion(); !ok || champion != 0 {
+				t.Errorf("champion %d (decided %t), want the top seed", champion, ok)
+			}
+		})
+	}
+}
+
+func TestPools(t *testing.T) {
+	const numPools, advance = 2, 2
+	for count := 2; count <= 9; count++ {
+		t.Run(fmt.Sprintf("%d entrants", count), func(t *testing.T) {
+			tournament := newTournament(tournamentPools, getTestEntrants(count), numPools, advance)
+
+			// the seeds snake between the pools, which differ in size by at most one team
+			wantPools := min(numPools, count/2)
+			if len(tournament.Pools) != wantPools {
+				t.Fatalf("%d pools, want %d", len(tournament.Pools), wantPools)
+			}
+			if tournament.Pools[0][0] != 0 || (wantPools > 1 && tournament.Pools[1][0] != 1) {
+				t.Errorf("pools %v, want the top seeds leading separate pools", tournament.Pools)
+			}
+			sizes := []int{}
+			for _, pool := range tournament.Pools {
+				sizes = append(sizes, len(pool))
+			}
+			if slices.Max(sizes)-slices.Min(sizes) > 1 {
+				t.Errorf("pools %v differ in size by more than one team", tournament.Pools)
+			}
+
+			// every team plays each other team in its pool once before the bracket is created
+			pairs := map[[2]int]int{}
+			for _, match := range tournament.Matches {
+				if match.Bracket != bracketPool {
+					t.Errorf("%s match created before the pools were complete", match.Bracket)
+				}
+				pairs[[2]int{min(match.Entrants[0], match.Entrants[1]), max(match.Entrants[0], match.Entrants[1])}]++
+			}
+			for _, pool := range tournament.Pools {
+				for i, a := range pool {
+					for _, b := range pool[i+1:] {
+						if n := pairs[[2]int{min(a, b), max(a, b)}]; n != 1 {
+							t.Errorf("entrants %d and %d meet %d times in their pool, want once", a, b, n)
+						}
+					}
+				}
+			}
+			if tournament.Final != -1 {
+				t.Error("the final was set before the pools were complete")
+			}
+
+			playTournament(t, &tournament, higherSeedWins)
+
+			// the top teams of each pool advance, pool winners seeded first
+			advancing := tournament.getAdvancing()
+			poolCount := len(tournament.Pools)
+			if len(advancing) != tournament.Advance*poolCount {
+				t.Fatalf("%d teams advanced, want %d from each of %d pools", len(advancing), tournament.Advance, poolCount)
+			}
+			for place := 0; place < tournament.Advance; place++ {
+				want := []int{}
+				for _, pool := range tournament.Pools {
+					want = append(want, pool[place])
+				}
+				got := slices.Clone(advancing[place*poolCount : (place+1)*poolCount])
+				slices.Sort(got)
+				slices.Sort(want)
+				if !slices.Equal(got, want) {
+					t.Errorf("entrants %v advanced in place %d, want %v", got, place+1, want)
+				}
+			}
+			checkFirstRound(t, tournament, advancing)
+			if champion, ok := tournament.getChampion(); !ok || champion != 0 {
+				t.Errorf("champion %d (decided %t), want the top seed", champion, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package commands
+
+// This file handles adjusting the last created teams by hand, by swapping or moving players between
+// them and locking players to their team for the next /redo
+
+import (
+	"fmt"
+
+	dg "github.com/bwmarrin/discordgo"
+	rsp "github.com/philflip12/spikebot/internal/responder"
+	log "github.com/sirupsen/logrus"
+)
+
+// benchTeamIdx is the team index findPlayer gives players on the bench
+const benchTeamIdx = -1
+
+// findPlayer returns the team and the index within it of the player, or benchTeamIdx as the team
+// of a player on the bench. ok is false if the player is neither on a team nor the bench.
+func (record TeamsRecord) findPlayer(userID string) (teamIdx, playerIdx int, ok bool) {
+	for teamIdx, team := range record.Teams {
+		for playerIdx, player := range team {
+			if player.ID == userID {
+				return teamIdx, playerIdx, true
+			}
+		}
+	}
+	for playerIdx, player := range record.Bench {
+		if player.ID == userID {
+			return benchTeamIdx, playerIdx, true
+		}
+	}
+	return 0, 0, false
+}
+
+// getTeam returns the team with the index, or the bench for benchTeamIdx
+func (record *TeamsRecord) getTeam(teamIdx int) *[]TeamsRecordPlayer {
+	if teamIdx == benchTeamIdx {
+		return &record.Bench
+	}
+	return &record.Teams[teamIdx]
+}
+
+// updateSkillGap recalculates the skill gap after the teams were changed by hand. The teams are no
+// longer known to be optimal. The teams which play against each other are grouped by the sizes the
+// teams were created with, so that moving a player cannot split two teams into separate groups.
+func (record *TeamsRecord) updateSkillGap() {
+	teamSkills := make([]float64, len(record.Teams))
+	// teams created without explicit sizes were split evenly, and all play against each other
+	sizes := make([]int, len(record.Teams))
+	if len(record.Config.TeamSizes) == len(record.Teams) {
+		sizes = record.Config.TeamSizes
+	}
+	for teamIdx, team := range record.Teams {
+		sum := 0
+		for _, player := range team {
+			sum += player.Skill
+		}
+		// the skill gap is measured between team totals when the teams were balanced by them
+		teamSkills[teamIdx] = float64(sum)
+		if record.Config.Objective != objectiveTotal {
+			teamSkills[teamIdx] /= float64(len(team))
+		}
+	}
+	record.SkillGap = getSkillGap(teamSkills, sizes)
+	record.Optimal = false
+}
+
+// updateRepeats recounts the teammate pairings repeated from the sessions before the one the teams
+// were created for
+func (record *TeamsRecord) updateRepeats(rosters []Roster) {
+	if len(rosters) > 0 && isSameSession(rosters[0].Time, record.Time) {
+		rosters = rosters[1:]
+	}
+	var players []Player
+	var teamOf []int
+	for teamIdx, team := range record.Teams {
+		for _, player := range team {
+			players = append(players, Player{ID: player.ID})
+			teamOf = append(teamOf, teamIdx)
+		}
+	}
+	repeats := getTeammateRepeats(players, rosters)
+	record.Repeats = 0
+	for i := range players {
+		for j := i + 1; j < len(players); j++ {
+			if teamOf[i] == teamOf[j] {
+				record.Repeats += repeats[i][j]
+			}
+		}
+	}
+}
+
+// adjustTeams changes the last created teams by hand with adjust, which returns the response to
+// give and whether it changed the teams. The teams are read, changed and saved in a single step so
+// that teams created at the same time are not overwritten. Changed teams are recalculated and saved
+// along with their roster.
+func adjustTeams(
+	session *dg.Session,
+	interaction *dg.InteractionCreate,
+	data *serverData,
+	adjust func(record *TeamsRecord) (response string, changed bool),
+) {
+	// the rosters are read beforehand, since nothing else may be read while the teams are updated
+	rosters, err := data.GetRosters()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	var response string
+	var changed bool
+	record, ok, err := data.UpdateLastTeams(func(record *TeamsRecord) bool {
+		response, changed = adjust(record)
+		if !changed {
+			return false
+		}
+		record.updateSkillGap()
+		if record.Config.RepeatPenalty > 0 {
+			record.updateRepeats(rosters)
+		}
+		return true
+	})
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	if !ok {
+		rsp.InteractionRespond(session, interaction, "teams has not yet been called")
+		return
+	}
+	if !changed {
+		rsp.InteractionRespond(session, interaction, response)
+		return
+	}
+
+	if err := data.SaveRoster(Roster{Time: record.Time, Teams: record.teamIDs()}); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	teams := getRecordTeams(record)
+	rsp.InteractionRespondf(session, interaction, "%s, the %s is now %.2f:%s", response, getSkillGapLabel(record.Config.Objective), record.SkillGap, teams.String())
+}
+
+func swapTeamPlayers(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	userIDs, names, err := getMentionedPair(session, interaction, data)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	adjustTeams(session, interaction, data, func(record *TeamsRecord) (string, bool) {
+		var teamIdxs, playerIdxs [2]int
+		for i, userID := range userIDs {
+			var ok bool
+			teamIdxs[i], playerIdxs[i], ok = record.findPlayer(userID)
+			if !ok {
+				return fmt.Sprintf("\"%s\" is not on any of the last created teams or the bench", names[i]), false
+			}
+		}
+		if teamIdxs[0] == benchTeamIdx && teamIdxs[1] == benchTeamIdx {
+			return fmt.Sprintf("\"%s\" and \"%s\" are both on the bench", names[0], names[1]), false
+		}
+		if teamIdxs[0] == teamIdxs[1] {
+			return fmt.Sprintf("\"%s\" and \"%s\" are already on the same team", names[0], names[1]), false
+		}
+
+		teamA, teamB := *record.getTeam(teamIdxs[0]), *record.getTeam(teamIdxs[1])
+		teamA[playerIdxs[0]], teamB[playerIdxs[1]] = teamB[playerIdxs[1]], teamA[playerIdxs[0]]
+		record.clearBenchPositions()
+		return fmt.Sprintf("Swapped \"%s\" and \"%s\"", names[0], names[1]), true
+	})
+}
+
+func moveTeamPlayer(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options[0].Options
+	userID, name, err := getMentionedPlayer(session, interaction, data, options[0])
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	toTeam := int(options[1].IntValue())
+
+	adjustTeams(session, interaction, data, func(record *TeamsRecord) (string, bool) {
+		if toTeam > len(record.Teams) {
+			return fmt.Sprintf("Team numbers must be between 1 and %d", len(record.Teams)), false
+		}
+		teamIdx, playerIdx, ok := record.findPlayer(userID)
+		if !ok {
+			return fmt.Sprintf("\"%s\" is not on any of the last created teams or the bench", name), false
+		}
+		if teamIdx == toTeam-1 {
+			return fmt.Sprintf("\"%s\" is already on team %d", name, toTeam), false
+		}
+		if teamIdx != benchTeamIdx && len(record.Teams[teamIdx]) == 1 {
+			return fmt.Sprintf("\"%s\" is the only player on team %d", name, teamIdx+1), false
+		}
+
+		from := record.getTeam(teamIdx)
+		player := (*from)[playerIdx]
+		*from = append((*from)[:playerIdx], (*from)[playerIdx+1:]...)
+		record.Teams[toTeam-1] = append(record.Teams[toTeam-1], player)
+		if teamIdx == benchTeamIdx {
+			return fmt.Sprintf("Moved \"%s\" from the bench to team %d", name, toTeam), true
+		}
+		return fmt.Sprintf("Moved \"%s\" to team %d", name, toTeam), true
+	})
+}
+
+// clearBenchPositions removes the positions and locks of the players on the bench, which only apply
+// to players on a team
+func (record *TeamsRecord) clearBenchPositions() {
+	for i := range record.Bench {
+		record.Bench[i].Position = ""
+		record.Bench[i].Locked = false
+	}
+}
+
+func lockTeamPlayer(session *dg.Session, interaction *dg.InteractionCreate, data *serverData, locked bool) {
+	options := interaction.ApplicationCommandData().Options[0].Options
+	userID, name, err := getMentionedPlayer(session, interaction, data, options[0])
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	var response string
+	var teamIdx int
+	_, ok, err := data.UpdateLastTeams(func(record *TeamsRecord) (changed bool) {
+		if locked && record.Config.DraftCaptains != nil {
+			response = "Players cannot be locked to drafted teams, /redo runs the draft again"
+			return false
+		}
+		var playerIdx int
+		var found bool
+		teamIdx, playerIdx, found = record.findPlayer(userID)
+		if !found || teamIdx == benchTeamIdx {
+			response = fmt.Sprintf("\"%s\" is not on any of the last created teams", name)
+			return false
+		}
+		if record.Teams[teamIdx][playerIdx].Locked == locked {
+			if locked {
+				response = fmt.Sprintf("\"%s\" is already locked to team %d", name, teamIdx+1)
+			} else {
+				response = fmt.Sprintf("\"%s\" is not locked", name)
+			}
+			return false
+		}
+		record.Teams[teamIdx][playerIdx].Locked = locked
+		return true
+	})
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	if !ok {
+		rsp.InteractionRespond(session, interaction, "teams has not yet been called")
+		return
+	}
+	if response != "" {
+		rsp.InteractionRespond(session, interaction, response)
+		return
+	}
+
+	if locked {
+		rsp.InteractionRespondf(session, interaction, "Locked \"%s\" to team %d, they will stay on it when /redo is called", name, teamIdx+1)
+	} else {
+		rsp.InteractionRespondf(session, interaction, "Unlocked \"%s\" from team %d", name, teamIdx+1)
+	}
+}
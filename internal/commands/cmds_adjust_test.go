@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"fmt"
+	"testing"
+)
+
+// getTestRecord returns teams of the given sizes in which every player has the same skill
+func getTestRecord(sizes ...int) TeamsRecord {
+	record := TeamsRecord{Optimal: true}
+	for teamIdx, size := range sizes {
+		team := []TeamsRecordPlayer{}
+		for i := 0; i < size; i++ {
+			team = append(team, TeamsRecordPlayer{ID: fmt.Sprintf("%d-%d", teamIdx, i), Skill: 5 + teamIdx%2})
+		}
+		record.Teams = append(record.Teams, team)
+	}
+	return record
+}
+
+func TestUpdateSkillGapAfterMove(t *testing.T) {
+	record := getTestRecord(5, 5)
+	// every player on the second team is one stronger, so a 6/4 split has a gap between averages
+	record.Teams[0] = append(record.Teams[0], record.Teams[1][0])
+	record.Teams[1] = record.Teams[1][1:]
+	record.updateSkillGap()
+	if record.SkillGap == 0 || record.Optimal {
+		t.Errorf("skill gap %.2f and optimal %t after moving a player, want a gap and not optimal", record.SkillGap, record.Optimal)
+	}
+
+	// teams created with sizes far apart still only play against teams of a similar size
+	record = getTestRecord(6, 3, 3)
+	record.Config.TeamSizes = []int{6, 3, 3}
+	for i := range record.Teams[0] {
+		record.Teams[0][i].Skill = 9
+	}
+	record.Teams[1] = append(record.Teams[1], record.Teams[2][0])
+	record.Teams[2] = record.Teams[2][1:]
+	record.updateSkillGap()
+	if record.SkillGap != 0.75 {
+		t.Errorf("skill gap %.2f between teams of the created sizes 3 and 3, want 0.75", record.SkillGap)
+	}
+}
@@ -0,0 +1,114 @@
+package commands
+
+// This file handles the commands server managers use to configure spike on their server, such as
+// the channels it responds to commands in
+
+import (
+	"fmt"
+
+	dg "github.com/bwmarrin/discordgo"
+	rsp "github.com/philflip12/spikebot/internal/responder"
+	log "github.com/sirupsen/logrus"
+)
+
+func cmdConfig(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options
+	groupName := options[0].Name
+
+	switch groupName {
+	case "channels":
+		cmdConfigChannels(session, interaction, data)
+	}
+}
+
+func cmdConfigChannels(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options[0].Options
+	subCommandName := options[0].Name
+
+	switch subCommandName {
+	case "add":
+		setChannelAllowed(session, interaction, data, true)
+	case "remove":
+		setChannelAllowed(session, interaction, data, false)
+	case "all":
+		setAllChannelsAllowed(session, interaction, data)
+	case "show":
+		showChannels(session, interaction, data)
+	}
+}
+
+func setChannelAllowed(session *dg.Session, interaction *dg.InteractionCreate, data *serverData, allowed bool) {
+	options := interaction.ApplicationCommandData().Options[0].Options[0].Options
+	channelID := options[0].ChannelValue(nil).ID
+
+	changed, err := data.SetChannelAllowed(channelID, allowed)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	settings, err := data.GetSettings()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	var response string
+	switch {
+	case allowed && !changed:
+		response = fmt.Sprintf("Spike already responds to commands in <#%s>", channelID)
+	case allowed:
+		response = fmt.Sprintf("Spike now responds to commands in <#%s>", channelID)
+	case !changed:
+		response = fmt.Sprintf("<#%s> was not one of the channels spike responds in", channelID)
+	default:
+		response = fmt.Sprintf("Spike no longer responds to commands in <#%s>", channelID)
+	}
+	rsp.InteractionRespondf(session, interaction, "%s\n%s", response, getChannelsString(settings))
+}
+
+func setAllChannelsAllowed(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options[0].Options[0].Options
+	allowed := options[0].BoolValue()
+
+	if err := data.SetAllChannelsAllowed(allowed); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	settings, err := data.GetSettings()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	rsp.InteractionRespond(session, interaction, getChannelsString(settings))
+}
+
+func showChannels(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	settings, err := data.GetSettings()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	rsp.InteractionRespond(session, interaction, getChannelsString(settings))
+}
+
+// getChannelsString describes the channels spike responds to commands in
+func getChannelsString(settings Settings) string {
+	if settings.AllChannels {
+		return "Spike responds to commands in every channel, use /config channels all to only respond in the added channels"
+	}
+	if len(settings.ChannelIDs) == 0 {
+		return "Spike does not respond to commands in any channel, use /config channels add to choose channels"
+	}
+	str := "Spike responds to commands in:"
+	for _, channelID := range settings.ChannelIDs {
+		str = fmt.Sprintf("%s\n\t<#%s>", str, channelID)
+	}
+	return str
+}
@@ -0,0 +1,249 @@
+package commands
+
+// This file handles the constraints which keep pairs of players on the same team, or on different
+// teams, whenever teams are created
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	dg "github.com/bwmarrin/discordgo"
+	rsp "github.com/philflip12/spikebot/internal/responder"
+	log "github.com/sirupsen/logrus"
+)
+
+func cmdConstraint(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options
+	subCommandName := options[0].Name
+
+	switch subCommandName {
+	case "together":
+		addConstraint(session, interaction, data, constraintTogether)
+	case "apart":
+		addConstraint(session, interaction, data, constraintApart)
+	case "remove":
+		removeConstraint(session, interaction, data)
+	case "show_all":
+		showAllConstraints(session, interaction, data)
+	}
+}
+
+// getMentionedPlayer returns the ID and name of the member or guest selected in a mentionable option
+func getMentionedPlayer(
+	session *dg.Session,
+	interaction *dg.InteractionCreate,
+	data *serverData,
+	option *dg.ApplicationCommandInteractionDataOption,
+) (userID, name string, err error) {
+	id := option.Value.(string)
+	resolved := interaction.ApplicationCommandData().Resolved
+	if resolved != nil && resolved.Roles[id] != nil {
+		player, ok, err := data.GetPlayer("g" + id)
+		if err != nil {
+			return "", "", err
+		}
+		if !ok {
+			return "", "", fmt.Errorf("role \"%s\" does not represent a guest", resolved.Roles[id].Name)
+		}
+		return "g" + id, player.Name, nil
+	}
+
+	name, err = getUserName(data, interaction.GuildID, id, session)
+	return id, name, err
+}
+
+// getMentionedPair returns the IDs and names of the two players selected for a constraint
+func getMentionedPair(
+	session *dg.Session,
+	interaction *dg.InteractionCreate,
+	data *serverData,
+) (userIDs [2]string, names [2]string, err error) {
+	options := interaction.ApplicationCommandData().Options[0].Options
+	for i := range userIDs {
+		userIDs[i], names[i], err = getMentionedPlayer(session, interaction, data, options[i])
+		if err != nil {
+			return userIDs, names, err
+		}
+	}
+	if userIDs[0] == userIDs[1] {
+		return userIDs, names, errors.New("a constraint must be between two different players")
+	}
+	return userIDs, names, nil
+}
+
+func addConstraint(session *dg.Session, interaction *dg.InteractionCreate, data *serverData, kind string) {
+	userIDs, names, err := getMentionedPair(session, interaction, data)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	if err := data.AddTeamConstraint(TeamConstraint{Kind: kind, UserIDs: userIDs}); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	rsp.InteractionRespond(session, interaction, getConstraintString(kind, names))
+}
+
+func removeConstraint(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	userIDs, names, err := getMentionedPair(session, interaction, data)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	removed, err := data.RemoveTeamConstraint(userIDs[0], userIDs[1])
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	if !removed {
+		rsp.InteractionRespondf(session, interaction, "There is no constraint between \"%s\" and \"%s\"", names[0], names[1])
+		return
+	}
+	rsp.InteractionRespondf(session, interaction, "Removed the constraint between \"%s\" and \"%s\"", names[0], names[1])
+}
+
+func showAllConstraints(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	constraints, err := data.GetTeamConstraints()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	if len(constraints) == 0 {
+		rsp.InteractionRespond(session, interaction, "There are no team constraints")
+		return
+	}
+
+	players, err := data.GetPlayers()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	str := "Team Constraints:\n```"
+	for _, constraint := range constraints {
+		var names [2]string
+		for i, userID := range constraint.UserIDs {
+			names[i] = players[userID].Name
+			if names[i] == "" {
+				names[i] = "unknown player"
+			}
+		}
+		str = fmt.Sprintf("%s\n%s", str, getConstraintString(constraint.Kind, names))
+	}
+	str = fmt.Sprintf("%s\n```", str)
+
+	rsp.InteractionRespond(session, interaction, str)
+}
+
+func getConstraintString(kind string, names [2]string) string {
+	if kind == constraintTogether {
+		return fmt.Sprintf("\"%s\" and \"%s\" must be on the same team", names[0], names[1])
+	}
+	return fmt.Sprintf("\"%s\" and \"%s\" must be on different teams", names[0], names[1])
+}
+
+// getPlayingConstraints returns the constraints between players who are both playing
+func getPlayingConstraints(players []Player, constraints []TeamConstraint) []TeamConstraint {
+	playing := make(map[string]struct{}, len(players))
+	for _, player := range players {
+		playing[player.ID] = struct{}{}
+	}
+	return slices.DeleteFunc(slices.Clone(constraints), func(constraint TeamConstraint) bool {
+		_, okA := playing[constraint.UserIDs[0]]
+		_, okB := playing[constraint.UserIDs[1]]
+		return !okA || !okB
+	})
+}
+
+// getConstraintPairs converts the constraints between the players into pairs of indices into the
+// player list
+func getConstraintPairs(players []Player, constraints []TeamConstraint) (together, apart [][2]int) {
+	index := make(map[string]int, len(players))
+	for i, player := range players {
+		index[player.ID] = i
+	}
+	for _, constraint := range constraints {
+		pair := [2]int{index[constraint.UserIDs[0]], index[constraint.UserIDs[1]]}
+		if constraint.Kind == constraintTogether {
+			together = append(together, pair)
+		} else {
+			apart = append(apart, pair)
+		}
+	}
+	return together, apart
+}
+
+// getInfeasibleError explains why no teams meeting the constraints were found. The locked players
+// and balanced positions are blamed if they cannot be kept to on their own, and otherwise the most
+// recently added team constraint whose removal would allow teams to be created. lockConstraints
+// keep the locked players on their teams and are never blamed as team constraints. The search for
+// the cause takes at most timeLimit in total.
+func getInfeasibleError(
+	players []Player,
+	lockConstraints []TeamConstraint,
+	constraints []TeamConstraint,
+	rules balanceRules,
+	teamSizes []int,
+	proven bool,
+	timeLimit time.Duration,
+) error {
+	if !proven {
+		return errors.New("No teams meeting the team constraints could be found in time")
+	}
+
+	deadline := time.Now().Add(timeLimit)
+	// feasible reports whether teams can be created which meet the constraints, decided is false if
+	// that could not be found out before the deadline
+	feasible := func(constraints []TeamConstraint) (feasible, decided bool) {
+		rules.together, rules.apart = getConstraintPairs(players, constraints)
+		// any skill gap is accepted, so the search stops at the first arrangement found
+		assignment, _, proven := newBalancer(players, rules, teamSizes, math.MaxFloat64, time.Until(deadline)).balance()
+		return assignment != nil, assignment != nil || proven
+	}
+
+	if ok, decided := feasible(lockConstraints); decided && !ok {
+		switch {
+		case len(lockConstraints) == 0:
+			return errors.New("No teams can be created with the positions balanced")
+		case rules.positions != nil:
+			return errors.New("No teams can be created which keep the locked players on their teams with the positions balanced")
+		default:
+			return errors.New("No teams can be created which keep the locked players on their teams")
+		}
+	}
+
+	for i := len(constraints) - 1; i >= 0; i-- {
+		without := slices.Delete(slices.Clone(constraints), i, i+1)
+		ok, decided := feasible(append(slices.Clone(lockConstraints), without...))
+		if !decided {
+			break
+		}
+		if !ok {
+			continue
+		}
+
+		var names [2]string
+		for _, player := range players {
+			if player.ID == constraints[i].UserIDs[0] {
+				names[0] = player.Name
+			} else if player.ID == constraints[i].UserIDs[1] {
+				names[1] = player.Name
+			}
+		}
+		return fmt.Errorf("No teams can be created while %s", getConstraintString(constraints[i].Kind, names))
+	}
+	return errors.New("No teams can be created which meet all of the team constraints")
+}
@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInfeasibleError(t *testing.T) {
+	players := getTestPlayers(6, 5)
+	for i := range players {
+		players[i].Name = players[i].ID
+	}
+	together := func(a, b string) TeamConstraint {
+		return TeamConstraint{Kind: constraintTogether, UserIDs: [2]string{a, b}}
+	}
+	apart := func(a, b string) TeamConstraint {
+		return TeamConstraint{Kind: constraintApart, UserIDs: [2]string{a, b}}
+	}
+
+	tests := []struct {
+		name        string
+		constraints []TeamConstraint
+		locked      map[string]int
+		want        string
+	}{{
+		name:        "the most recent constraint is blamed",
+		constraints: []TeamConstraint{together("p0", "p1"), together("p1", "p2"), apart("p0", "p2")},
+		want:        `No teams can be created while "p0" and "p2" must be on different teams`,
+	}, {
+		name:        "locked players are never blamed",
+		constraints: []TeamConstraint{apart("p0", "p1")},
+		locked:      map[string]int{"p0": 0, "p1": 0},
+		want:        `No teams can be created while "p0" and "p1" must be on different teams`,
+	}, {
+		name:        "a constraint against the locks is blamed",
+		constraints: []TeamConstraint{together("p0", "p1"), apart("p2", "p3")},
+		locked:      map[string]int{"p0": 0, "p1": 1},
+		want:        `No teams can be created while "p0" and "p1" must be on the same team`,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := TeamsConfig{NumTeams: 2, MaxSkillGap: 1}
+			_, err := createTeams(players, test.constraints, nil, config, test.locked, time.Second)
+			if err == nil || err.Error() != test.want {
+				t.Errorf("error %v, want %s", err, test.want)
+			}
+		})
+	}
+}
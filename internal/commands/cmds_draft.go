@@ -0,0 +1,438 @@
+package commands
+
+// This file handles captain drafts, an alternative to /teams create in which captains take turns
+// picking their teammates from the playing group using select menus on the draft message
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	dg "github.com/bwmarrin/discordgo"
+	rsp "github.com/philflip12/spikebot/internal/responder"
+	"github.com/philflip12/spikebot/pkg/atomic"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	draftPrefix = "draft_"
+	// the custom ID of each select menu is draftPickID followed by the number of the menu
+	draftPickID = draftPrefix + "pick_"
+)
+
+// how long a captain has to pick before the best available player is picked for them
+const draftTurnTimeout = time.Minute
+
+// the most options a discord select menu can hold, and the most menus a message can hold
+const (
+	maxSelectOptions = 25
+	maxSelectMenus   = 5
+)
+
+// the most captains which can be chosen when starting a draft
+const maxDraftCaptains = 6
+
+// the draft running on each server, if any
+var drafts = atomic.NewAtomicMap[string, *draft]()
+
+type draft struct {
+	mutex     sync.Mutex
+	session   *dg.Session
+	data      *serverData
+	guildID   string
+	channelID string
+	messageID string
+	// the user who started the draft, who may pick for any captain
+	starterID string
+	// the players on each team, starting with the team's captain, in the order they were picked
+	teams [][]Player
+	// the players not yet picked from strongest to weakest
+	available []Player
+	// the number of picks made so far
+	pick  int
+	timer *time.Timer
+}
+
+func cmdDraft(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options
+	subCommandName := options[0].Name
+
+	switch subCommandName {
+	case "start":
+		cmdDraftStart(session, interaction, data)
+	case "cancel":
+		cancelDraft(session, interaction)
+	}
+}
+
+func cmdDraftStart(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	numTeams := 0
+	captainIDs := []string{}
+	for _, option := range interaction.ApplicationCommandData().Options[0].Options {
+		if option.Name == "teams" {
+			numTeams = int(option.IntValue())
+			continue
+		}
+		userID, _, err := getMentionedPlayer(session, interaction, data, option)
+		if err != nil {
+			log.Error(err)
+			rsp.InteractionRespond(session, interaction, err.Error())
+			return
+		}
+		captainIDs = append(captainIDs, userID)
+	}
+
+	startDraft(session, interaction, data, numTeams, captainIDs)
+}
+
+// startDraft posts a draft message for the playing group. Captains not chosen in captainIDs are
+// filled in with the strongest remaining players.
+func startDraft(session *dg.Session, interaction *dg.InteractionCreate, data *serverData, numTeams int, captainIDs []string) {
+	players, err := data.GetPlaying()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	if err := validateTeams(data, players, numTeams); err != nil {
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	d, err := newDraft(players, numTeams, captainIDs)
+	if err != nil {
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	d.session = session
+	d.data = data
+	d.guildID = interaction.GuildID
+	d.channelID = interaction.ChannelID
+	d.starterID = interaction.Member.User.ID
+
+	started := false
+	drafts.WithLock(func(m map[string]*draft) {
+		if _, ok := m[interaction.GuildID]; !ok {
+			m[interaction.GuildID] = d
+			started = true
+			// the draft keeps using the data after the interaction, until it is stopped
+			data.acquire()
+		}
+	})
+	if !started {
+		rsp.InteractionRespond(session, interaction, "A draft is already running, use /draft cancel to stop it")
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.isDone() {
+		d.finish()
+		rsp.InteractionRespond(session, interaction, d.messageContent())
+		return
+	}
+
+	err = session.InteractionRespond(interaction.Interaction, &dg.InteractionResponse{
+		Type: dg.InteractionResponseChannelMessageWithSource,
+		Data: &dg.InteractionResponseData{
+			Content:    d.messageContent(),
+			Components: d.pickMenus(),
+		},
+	})
+	if err != nil {
+		log.Error(err)
+		d.stop()
+		return
+	}
+	message, err := session.InteractionResponse(interaction.Interaction)
+	if err != nil {
+		log.Error(err)
+		d.stop()
+		return
+	}
+	d.messageID = message.ID
+	d.startTurn()
+}
+
+func newDraft(players []Player, numTeams int, captainIDs []string) (*draft, error) {
+	if len(captainIDs) > numTeams {
+		return nil, fmt.Errorf("%d captains were chosen for %d teams", len(captainIDs), numTeams)
+	}
+
+	available := append([]Player{}, players...)
+	sort.SliceStable(available, func(i, j int) bool {
+		return available[i].Skill > available[j].Skill
+	})
+
+	captains := make([]Player, 0, numTeams)
+	for i, captainID := range captainIDs {
+		if slices.Contains(captainIDs[:i], captainID) {
+			return nil, errors.New("a player cannot captain more than one team")
+		}
+		index := -1
+		for i, player := range available {
+			if player.ID == captainID {
+				index = i
+			}
+		}
+		if index == -1 {
+			return nil, errors.New("every captain must be in the playing group")
+		}
+		captains = append(captains, available[index])
+		available = append(available[:index], available[index+1:]...)
+	}
+	for len(captains) < numTeams {
+		captains = append(captains, available[0])
+		available = available[1:]
+	}
+
+	// the weakest captain picks first
+	sort.SliceStable(captains, func(i, j int) bool {
+		return captains[i].Skill < captains[j].Skill
+	})
+	teams := make([][]Player, numTeams)
+	for i, captain := range captains {
+		teams[i] = []Player{captain}
+	}
+	return &draft{teams: teams, available: available}, nil
+}
+
+// picker returns the team whose captain is picking. Each round of picks runs in the opposite
+// order to the round before it.
+func (d *draft) picker() int {
+	round, turn := d.pick/len(d.teams), d.pick%len(d.teams)
+	if round%2 == 1 {
+		return len(d.teams) - 1 - turn
+	}
+	return turn
+}
+
+func (d *draft) isDone() bool {
+	return len(d.available) == 0
+}
+
+// makePick moves an available player onto the picking team
+func (d *draft) makePick(index int) {
+	team := d.picker()
+	d.teams[team] = append(d.teams[team], d.available[index])
+	d.available = append(d.available[:index], d.available[index+1:]...)
+	d.pick++
+}
+
+// startTurn starts the timer which picks for the current captain if they run out of time
+func (d *draft) startTurn() {
+	pick := d.pick
+	d.timer = time.AfterFunc(draftTurnTimeout, func() {
+		d.autoPick(pick)
+	})
+}
+
+// autoPick picks the best available player for the captain of the given pick if they have not
+// picked yet
+func (d *draft) autoPick(pick int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.pick != pick || drafts.Read(d.guildID) != d {
+		return
+	}
+
+	d.makePick(0)
+	components := d.pickMenus()
+	if d.isDone() {
+		d.finish()
+		components = []dg.MessageComponent{}
+	} else {
+		d.startTurn()
+	}
+
+	content := d.messageContent()
+	_, err := d.session.ChannelMessageEditComplex(&dg.MessageEdit{
+		ID:         d.messageID,
+		Channel:    d.channelID,
+		Content:    &content,
+		Components: &components,
+	})
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// stop ends the draft without saving the teams
+func (d *draft) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	drafts.WithLock(func(m map[string]*draft) {
+		if m[d.guildID] == d {
+			delete(m, d.guildID)
+			d.data.release()
+		}
+	})
+}
+
+// finish ends the draft and saves the teams so that matches between them can be reported and
+// /redo can run the draft again with the same captains
+func (d *draft) finish() {
+	captainIDs := make([]string, len(d.teams))
+	for i, team := range d.teams {
+		captainIDs[i] = team[0].ID
+	}
+	config := TeamsConfig{
+		NumTeams:      len(d.teams),
+		MaxSkillGap:   getTeamsDefaults(d.guildID).MaxSkillGap,
+		DraftCaptains: captainIDs,
+	}
+	if err := saveTeams(d.data, d.getTeams(), config); err != nil {
+		log.Error(err)
+	}
+	// the draft holds on to the server data until it is stopped, so it is only stopped once the
+	// teams are saved
+	d.stop()
+}
+
+// getTeams returns the teams in the order their captains picked
+func (d *draft) getTeams() Teams {
+	teams := Teams{teams: make([]*Team, len(d.teams))}
+	minSkill, maxSkill := math.Inf(1), math.Inf(-1)
+	for i, members := range d.teams {
+		team := &Team{players: make([]*Player, len(members))}
+		sum := 0
+		for j := range members {
+			team.players[j] = &members[j]
+			sum += members[j].Skill
+		}
+		team.skill = float64(sum) / float64(len(members))
+		minSkill = math.Min(minSkill, team.skill)
+		maxSkill = math.Max(maxSkill, team.skill)
+		teams.teams[i] = team
+	}
+	teams.skillGap = maxSkill - minSkill
+	return teams
+}
+
+func (d *draft) messageContent() string {
+	teams := d.getTeams()
+	if d.isDone() {
+		return fmt.Sprintf("Draft complete:%s", teams.String())
+	}
+
+	captain := d.teams[d.picker()][0]
+	return fmt.Sprintf("Captain draft, pick %d of %d:%s\n**%s** is picking, the best available player is picked for them <t:%d:R>",
+		d.pick+1, d.pick+len(d.available), teams.String(), captain.Name, time.Now().Add(draftTurnTimeout).Unix())
+}
+
+// pickMenus returns the select menus listing the available players from strongest to weakest
+func (d *draft) pickMenus() []dg.MessageComponent {
+	numMenus := min((len(d.available)+maxSelectOptions-1)/maxSelectOptions, maxSelectMenus)
+	menus := make([]dg.MessageComponent, 0, numMenus)
+	for menu := 0; menu < numMenus; menu++ {
+		players := d.available[menu*maxSelectOptions : min((menu+1)*maxSelectOptions, len(d.available))]
+		options := make([]dg.SelectMenuOption, len(players))
+		for i, player := range players {
+			options[i] = dg.SelectMenuOption{
+				Label: fmt.Sprintf("%s (%d)", player.Name, player.Skill),
+				Value: player.ID,
+			}
+		}
+		placeholder := "Pick a player"
+		if numMenus > 1 {
+			placeholder = fmt.Sprintf("Pick a player (%d/%d)", menu+1, numMenus)
+		}
+		menus = append(menus, dg.ActionsRow{
+			Components: []dg.MessageComponent{dg.SelectMenu{
+				CustomID:    draftPickID + strconv.Itoa(menu),
+				Placeholder: placeholder,
+				Options:     options,
+			}},
+		})
+	}
+	return menus
+}
+
+// onDraftPick is called when a user picks a player from one of the select menus of a draft message
+func onDraftPick(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	d, ok := drafts.ReadSafe(interaction.GuildID)
+	if !ok {
+		rsp.InteractionRespondEphemeral(session, interaction, "This draft is no longer running")
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.messageID != interaction.Message.ID {
+		rsp.InteractionRespondEphemeral(session, interaction, "This draft is no longer running")
+		return
+	}
+
+	captain := d.teams[d.picker()][0]
+	userID := interaction.Member.User.ID
+	if userID != captain.ID && userID != d.starterID {
+		rsp.InteractionRespondEphemeral(session, interaction, fmt.Sprintf("It is %s's turn to pick", captain.Name))
+		return
+	}
+
+	pickedID := interaction.MessageComponentData().Values[0]
+	index := -1
+	for i, player := range d.available {
+		if player.ID == pickedID {
+			index = i
+		}
+	}
+	if index == -1 {
+		rsp.InteractionRespondEphemeral(session, interaction, "That player has already been picked")
+		return
+	}
+
+	d.timer.Stop()
+	d.makePick(index)
+	components := d.pickMenus()
+	if d.isDone() {
+		d.finish()
+		components = []dg.MessageComponent{}
+	} else {
+		d.startTurn()
+	}
+
+	err := session.InteractionRespond(interaction.Interaction, &dg.InteractionResponse{
+		Type: dg.InteractionResponseUpdateMessage,
+		Data: &dg.InteractionResponseData{
+			Content:    d.messageContent(),
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+func cancelDraft(session *dg.Session, interaction *dg.InteractionCreate) {
+	d, ok := drafts.ReadSafe(interaction.GuildID)
+	if !ok {
+		rsp.InteractionRespond(session, interaction, "No draft is running")
+		return
+	}
+
+	d.mutex.Lock()
+	d.stop()
+	messageID := d.messageID
+	d.mutex.Unlock()
+
+	content := "Draft cancelled"
+	components := []dg.MessageComponent{}
+	_, err := session.ChannelMessageEditComplex(&dg.MessageEdit{
+		ID:         messageID,
+		Channel:    d.channelID,
+		Content:    &content,
+		Components: &components,
+	})
+	if err != nil {
+		log.Error(err)
+	}
+	rsp.InteractionRespond(session, interaction, "Cancelled the draft")
+}
@@ -4,6 +4,7 @@ package commands
 
 import (
 	"fmt"
+	"slices"
 	"sort"
 
 	dg "github.com/bwmarrin/discordgo"
@@ -74,7 +75,8 @@ func createGuest(session *dg.Session, interaction *dg.InteractionCreate, data *s
 		response = fmt.Sprintf("%s with skill rank %d", response, skill)
 	}
 
-	if err := data.AddPlayingUsers(guestID); err != nil {
+	waitlisted, err := data.AddPlayingUsers(guestID)
+	if err != nil {
 		log.Error(err)
 		errStr := fmt.Sprintf("%s\nEncountered error adding guest %q to playing group: %v", response, guestName, err)
 		rsp.InteractionRespond(session, interaction, errStr)
@@ -88,6 +90,10 @@ func createGuest(session *dg.Session, interaction *dg.InteractionCreate, data *s
 		return
 	}
 
+	if len(waitlisted) > 0 {
+		rsp.InteractionRespondf(session, interaction, "%s\nThe playing group is full, added guest %q to the waitlist%s", response, guestName, numPlayingStr)
+		return
+	}
 	rsp.InteractionRespondf(session, interaction, "%s\nAdded guest %q to playing group%s", response, guestName, numPlayingStr)
 }
 
@@ -225,7 +231,8 @@ func addGuestsToPlaying(session *dg.Session, interaction *dg.InteractionCreate,
 		}
 	}
 
-	if err := data.AddPlayingUsers(guestIDs...); err != nil {
+	waitlisted, err := data.AddPlayingUsers(guestIDs...)
+	if err != nil {
 		log.Error(err)
 		rsp.InteractionRespondf(session, interaction, err.Error())
 		return
@@ -237,6 +244,13 @@ func addGuestsToPlaying(session *dg.Session, interaction *dg.InteractionCreate,
 		rsp.InteractionRespond(session, interaction, err.Error())
 		return
 	}
+	waitlistStr, err := getWaitlistChangesString(data, waitlisted, nil)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	numPlayingStr = fmt.Sprintf("%s%s", numPlayingStr, waitlistStr)
 
 	response := ""
 	if len(invalidRoles) != 0 {
@@ -278,11 +292,33 @@ func removeGuestsFromPlaying(session *dg.Session, interaction *dg.InteractionCre
 		}
 	}
 
-	if err := data.RemovePlayingUsers(guestIDs...); err != nil {
+	removed, promoted, err := data.RemovePlayingUsers(guestIDs...)
+	if err != nil {
 		log.Error(err)
 		rsp.InteractionRespondf(session, interaction, err.Error())
 		return
 	}
+	notPlaying := slices.DeleteFunc(slices.Clone(guestIDs), func(guestID string) bool {
+		return slices.Contains(removed, guestID)
+	})
+	slices.Sort(notPlaying)
+	var removedNames, notPlayingNames []string
+	for _, id := range removed {
+		removedNames = append(removedNames, players[id].Name)
+	}
+	for _, id := range slices.Compact(notPlaying) {
+		notPlayingNames = append(notPlayingNames, players[id].Name)
+	}
+
+	response := ""
+	if len(invalidRoles) != 0 {
+		response = "One or more roles did not represent a guest\n\n"
+	}
+	response += getRemovedFromPlayingString("guest ", "guests", removedNames, notPlayingNames)
+	if len(removed) == 0 {
+		rsp.InteractionRespond(session, interaction, response)
+		return
+	}
 
 	numPlayingStr, err := getNumPlayingString(data)
 	if err != nil {
@@ -290,21 +326,13 @@ func removeGuestsFromPlaying(session *dg.Session, interaction *dg.InteractionCre
 		rsp.InteractionRespond(session, interaction, err.Error())
 		return
 	}
-
-	response := ""
-	if len(invalidRoles) != 0 {
-		response = "One or more roles did not represent a guest\n\n"
-	}
-	if len(guestIDs) == 1 {
-		response = fmt.Sprintf("%sRemoved guest %q from playing%s", response, players[guestIDs[0]].Name, numPlayingStr)
-	} else if len(guestIDs) > 1 {
-		response = fmt.Sprintf("%sRemoved guests from playing:", response)
-		for _, id := range guestIDs {
-			response = fmt.Sprintf("%s\n\t%s", response, players[id].Name)
-		}
-		response = fmt.Sprintf("%s%s", response, numPlayingStr)
+	waitlistStr, err := getWaitlistChangesString(data, nil, promoted)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
 	}
-	rsp.InteractionRespond(session, interaction, response)
+	rsp.InteractionRespondf(session, interaction, "%s%s%s", response, numPlayingStr, waitlistStr)
 }
 
 func setGuestSkill(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
@@ -312,6 +340,7 @@ func setGuestSkill(session *dg.Session, interaction *dg.InteractionCreate, data
 	roleID := options[0].RoleValue(nil, "").ID
 	skill := int(options[1].IntValue())
 	guestID := "g" + roleID
+	edit := getSkillEdit(interaction, getOptionalString(options, 2))
 
 	player, ok, err := data.GetPlayer(guestID)
 	if err != nil {
@@ -324,7 +353,7 @@ func setGuestSkill(session *dg.Session, interaction *dg.InteractionCreate, data
 		return
 	}
 
-	if err := data.SetPlayerSkill(guestID, skill); err != nil {
+	if err := data.SetPlayerSkill(guestID, skill, edit); err != nil {
 		log.Error(err)
 		rsp.InteractionRespondf(session, interaction, err.Error())
 		return
@@ -338,6 +367,7 @@ func increaseGuestSkill(session *dg.Session, interaction *dg.InteractionCreate,
 	roleID := options[0].RoleValue(nil, "").ID
 	difference := int(options[1].IntValue())
 	guestID := "g" + roleID
+	edit := getSkillEdit(interaction, getOptionalString(options, 2))
 
 	player, ok, err := data.GetPlayer(guestID)
 	if err != nil {
@@ -350,7 +380,7 @@ func increaseGuestSkill(session *dg.Session, interaction *dg.InteractionCreate,
 		return
 	}
 
-	prevSkill, newSkill, err := data.ModifyPlayerSkill(guestID, difference)
+	prevSkill, newSkill, err := data.ModifyPlayerSkill(guestID, difference, edit)
 	if err != nil {
 		log.Error(err)
 		rsp.InteractionRespondf(session, interaction, err.Error())
@@ -365,6 +395,7 @@ func decreaseGuestSkill(session *dg.Session, interaction *dg.InteractionCreate,
 	roleID := options[0].RoleValue(nil, "").ID
 	difference := int(options[1].IntValue())
 	guestID := "g" + roleID
+	edit := getSkillEdit(interaction, getOptionalString(options, 2))
 
 	player, ok, err := data.GetPlayer(guestID)
 	if err != nil {
@@ -377,7 +408,7 @@ func decreaseGuestSkill(session *dg.Session, interaction *dg.InteractionCreate,
 		return
 	}
 
-	prevSkill, newSkill, err := data.ModifyPlayerSkill(guestID, -difference)
+	prevSkill, newSkill, err := data.ModifyPlayerSkill(guestID, -difference, edit)
 	if err != nil {
 		log.Error(err)
 		rsp.InteractionRespondf(session, interaction, err.Error())
@@ -406,6 +437,66 @@ func showGuestSkill(session *dg.Session, interaction *dg.InteractionCreate, data
 	rsp.InteractionRespondf(session, interaction, "Guest %q has a skill rank of %d", player.Name, player.Skill)
 }
 
+func showGuestSkillHistory(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options[0].Options[0].Options
+	roleID := options[0].RoleValue(nil, "").ID
+	guestID := "g" + roleID
+
+	player, ok, err := data.GetPlayer(guestID)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespondf(session, interaction, err.Error())
+		return
+	}
+	if !ok {
+		rsp.InteractionRespondf(session, interaction, "Role selected does not represent a guest")
+		return
+	}
+
+	entries, err := data.GetSkillHistory(guestID)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	if len(entries) == 0 {
+		rsp.InteractionRespondf(session, interaction, "Guest %q has no skill rank changes", player.Name)
+		return
+	}
+	rsp.InteractionRespondf(session, interaction, "Skill rank history of guest %q:\n%s", player.Name, skillHistoryString(entries))
+}
+
+func revertGuestSkill(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options[0].Options[0].Options
+	roleID := options[0].RoleValue(nil, "").ID
+	guestID := "g" + roleID
+	entryNum := 1
+	if len(options) > 1 {
+		entryNum = int(options[1].IntValue())
+	}
+
+	player, ok, err := data.GetPlayer(guestID)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespondf(session, interaction, err.Error())
+		return
+	}
+	if !ok {
+		rsp.InteractionRespondf(session, interaction, "Role selected does not represent a guest")
+		return
+	}
+
+	reverted, err := data.RevertSkillChange(guestID, entryNum, getSkillEdit(interaction, revertReason(entryNum)))
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	rsp.InteractionRespondf(session, interaction, "Reverted guest %q skill rank change from %d to %d, skill rank is now %d", player.Name, reverted.Before, reverted.After, reverted.Before)
+}
+
 func showAllGuests(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
 	players, err := data.GetPlayers()
 	if err != nil {
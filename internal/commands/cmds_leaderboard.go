@@ -0,0 +1,265 @@
+package commands
+
+// This file handles ranking the players by their rating, win rate or attendance over a window of
+// time, such as the current season
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	dg "github.com/bwmarrin/discordgo"
+	rsp "github.com/philflip12/spikebot/internal/responder"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	leaderboardRating     = "rating"
+	leaderboardWinRate    = "win_rate"
+	leaderboardAttendance = "attendance"
+)
+
+const (
+	windowSeason  = "season"
+	window30Days  = "30_days"
+	windowAllTime = "all_time"
+)
+
+// the number of players shown on a leaderboard when no count is given
+const defaultLeaderboardCount = 10
+
+// the longest name shown in a standings table before it is cut short
+const standingsNameWidth = 20
+
+func cmdLeaderboard(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	metric := leaderboardRating
+	window := ""
+	count := defaultLeaderboardCount
+	for _, option := range interaction.ApplicationCommandData().Options {
+		switch option.Name {
+		case "metric":
+			metric = option.StringValue()
+		case "window":
+			window = option.StringValue()
+		case "count":
+			count = int(option.IntValue())
+		}
+	}
+
+	seasons, err := data.GetSeasons()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	season, seasonRunning := getCurrentSeason(seasons)
+	// the leaderboard covers the running season unless another window is chosen
+	if window == "" {
+		window = windowAllTime
+		if seasonRunning {
+			window = windowSeason
+		}
+	}
+
+	var since time.Time
+	var windowName string
+	switch window {
+	case windowSeason:
+		if !seasonRunning {
+			rsp.InteractionRespond(session, interaction, "There is no season running, use /season start to begin one")
+			return
+		}
+		since = season.Start
+		windowName = season.Name
+	case window30Days:
+		since = time.Now().AddDate(0, 0, -30)
+		windowName = "the last 30 days"
+	default:
+		windowName = "all time"
+	}
+
+	standings, err := getStandings(data, since)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	// players are ranked by how much their rating rose within a window rather than by their rating
+	windowed := !since.IsZero()
+	standings = sortStandings(standings, metric, windowed)
+	if len(standings) == 0 {
+		rsp.InteractionRespondf(session, interaction, "Nobody is ranked over %s", windowName)
+		return
+	}
+	standings = standings[:min(count, len(standings))]
+
+	metricName := "rating"
+	if windowed {
+		metricName = "rating gained"
+	}
+	switch metric {
+	case leaderboardWinRate:
+		metricName = "win rate"
+	case leaderboardAttendance:
+		metricName = "attendance"
+	}
+	rsp.InteractionRespondf(session, interaction, "Top players by %s over %s:\n%s", metricName, windowName, getStandingsString(standings, windowed))
+}
+
+// getStandings returns the rating of each player along with their rating change, results and
+// attendance since the given time. Over all time every ranked player is included, otherwise only the players who
+// attended or played a match in the window are.
+func getStandings(data *serverData, since time.Time) ([]Standing, error) {
+	players, err := data.GetPlayers()
+	if err != nil {
+		return nil, err
+	}
+	matches, err := data.GetMatches(since)
+	if err != nil {
+		return nil, err
+	}
+	attendance, err := data.GetAttendance(since)
+	if err != nil {
+		return nil, err
+	}
+
+	standings := map[string]*Standing{}
+	getStanding := func(userID string) *Standing {
+		player, ok := players[userID]
+		if !ok {
+			return nil
+		}
+		if standings[userID] == nil {
+			standings[userID] = &Standing{
+				UserID: userID,
+				Name:   player.Name,
+				Skill:  player.Skill,
+				Rating: player.getRating().Mu,
+			}
+		}
+		return standings[userID]
+	}
+
+	if since.IsZero() {
+		for userID, player := range players {
+			if player.Skill >= 0 {
+				getStanding(userID)
+			}
+		}
+	}
+	for _, match := range matches {
+		for userID, change := range match.RatingChanges {
+			if standing := getStanding(userID); standing != nil {
+				standing.RatingChange += change
+			}
+		}
+		for _, userID := range match.Winners {
+			if standing := getStanding(userID); standing != nil {
+				standing.Wins++
+			}
+		}
+		for _, userID := range match.Losers {
+			if standing := getStanding(userID); standing != nil {
+				standing.Losses++
+			}
+		}
+	}
+	for _, entry := range attendance {
+		if standing := getStanding(entry.UserID); standing != nil {
+			standing.Sessions++
+		}
+	}
+
+	standingList := make([]Standing, 0, len(standings))
+	for _, standing := range standings {
+		standingList = append(standingList, *standing)
+	}
+	return standingList, nil
+}
+
+// winRate returns the fraction of matches won, 0 if no matches were played
+func (s Standing) winRate() float64 {
+	if s.Wins+s.Losses == 0 {
+		return 0
+	}
+	return float64(s.Wins) / float64(s.Wins+s.Losses)
+}
+
+// sortStandings orders the standings by the metric, best first. Players who have not played a
+// match are left out of the win rate ranking, and players who have not attended a session are left
+// out of the attendance ranking. Ties, and the rating ranking itself, are decided by the rating
+// change if the standings cover a window of time, or else by the rating.
+func sortStandings(standings []Standing, metric string, windowed bool) []Standing {
+	ranked := []Standing{}
+	for _, standing := range standings {
+		switch {
+		case metric == leaderboardWinRate && standing.Wins+standing.Losses == 0:
+		case metric == leaderboardAttendance && standing.Sessions == 0:
+		default:
+			ranked = append(ranked, standing)
+		}
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		switch metric {
+		case leaderboardWinRate:
+			if a.winRate() != b.winRate() {
+				return a.winRate() > b.winRate()
+			}
+			if a.Wins != b.Wins {
+				return a.Wins > b.Wins
+			}
+		case leaderboardAttendance:
+			if a.Sessions != b.Sessions {
+				return a.Sessions > b.Sessions
+			}
+		}
+		if windowed && a.RatingChange != b.RatingChange {
+			return a.RatingChange > b.RatingChange
+		}
+		if a.Rating != b.Rating {
+			return a.Rating > b.Rating
+		}
+		return a.Name < b.Name
+	})
+	return ranked
+}
+
+// getStandingsString returns the standings as a table in the order given, with the rating change
+// of each player if the standings cover a window of time
+func getStandingsString(standings []Standing, windowed bool) string {
+	nameWidth := len("Name")
+	for _, standing := range standings {
+		nameWidth = max(nameWidth, min(utf8.RuneCountInString(standing.Name), standingsNameWidth))
+	}
+
+	str := fmt.Sprintf("```\n  #  %-*s  Skill  Rating", nameWidth, "Name")
+	if windowed {
+		str = fmt.Sprintf("%s  Change", str)
+	}
+	str = fmt.Sprintf("%s  W-L      Win%%  Sessions", str)
+	for rank, standing := range standings {
+		name := truncateName(standing.Name, standingsNameWidth)
+		record := fmt.Sprintf("%d-%d", standing.Wins, standing.Losses)
+		winRate := "-"
+		if standing.Wins+standing.Losses > 0 {
+			winRate = fmt.Sprintf("%.0f%%", 100*standing.winRate())
+		}
+		str = fmt.Sprintf("%s\n%3d  %-*s  %5d  %6.1f", str, rank+1, nameWidth, name, standing.Skill, standing.Rating)
+		if windowed {
+			str = fmt.Sprintf("%s  %+6.1f", str, standing.RatingChange)
+		}
+		str = fmt.Sprintf("%s  %-7s  %4s  %8d", str, record, winRate, standing.Sessions)
+	}
+	return fmt.Sprintf("%s\n```", str)
+}
+
+// truncateName cuts the name short to at most width characters
+func truncateName(name string, width int) string {
+	if utf8.RuneCountInString(name) <= width {
+		return name
+	}
+	return string([]rune(name)[:width])
+}
@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestStandingsRatingChange(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, data *serverData) {
+		for _, id := range []string{"a", "b", "c"} {
+			if err := data.SaveGuest(id, id, 5, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		recordMatches := func(matches ...Match) {
+			for _, match := range matches {
+				if _, _, err := data.RecordMatch(match, SkillEdit{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		start := time.Now()
+		recordMatches(
+			Match{Time: start.Add(-2 * time.Hour), Winners: []string{"a"}, Losers: []string{"c"}},
+			Match{Time: start.Add(-time.Hour), Winners: []string{"a"}, Losers: []string{"c"}},
+		)
+		before, err := data.GetPlayers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		recordMatches(
+			Match{Time: start.Add(time.Hour), Winners: []string{"b"}, Losers: []string{"a"}},
+			Match{Time: start.Add(2 * time.Hour), Winners: []string{"c"}, Losers: []string{"b"}},
+		)
+		after, err := data.GetPlayers()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		standings, err := getStandings(data, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		standings = sortStandings(standings, leaderboardRating, true)
+		if len(standings) != 3 {
+			t.Fatalf("standings %+v, want every player", standings)
+		}
+		for i, standing := range standings {
+			want := after[standing.UserID].getRating().Mu - before[standing.UserID].getRating().Mu
+			if math.Abs(standing.RatingChange-want) > skillEpsilon {
+				t.Errorf("%s rating change %g, want %g", standing.UserID, standing.RatingChange, want)
+			}
+			if i > 0 && standings[i-1].RatingChange < standing.RatingChange {
+				t.Errorf("%s is ranked below %s but gained more rating", standing.UserID, standings[i-1].UserID)
+			}
+		}
+
+		// over all time the players are ranked by their rating
+		standings, err = getStandings(data, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		standings = sortStandings(standings, leaderboardRating, false)
+		for i := 1; i < len(standings); i++ {
+			if standings[i-1].Rating < standings[i].Rating {
+				t.Errorf("%s is ranked below %s but has a higher rating", standings[i].UserID, standings[i-1].UserID)
+			}
+		}
+	})
+}
+
+func TestTruncateName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"short", "short"},
+		{"exactly", "exactly"},
+		{"much too long", "much to"},
+		{"ÅÄÖåäöÆØ", "ÅÄÖåäöÆ"},
+	}
+	for _, test := range tests {
+		if got := truncateName(test.name, 7); got != test.want {
+			t.Errorf("truncateName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package commands
+
+// This file handles reporting the results of matches played between the last generated teams
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	dg "github.com/bwmarrin/discordgo"
+	rsp "github.com/philflip12/spikebot/internal/responder"
+	log "github.com/sirupsen/logrus"
+)
+
+func cmdMatch(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options
+	subCommandName := options[0].Name
+
+	switch subCommandName {
+	case "report":
+		reportMatch(session, interaction, data)
+	}
+}
+
+func reportMatch(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	record, ok, err := getLastTeamsRecord(data)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	if !ok {
+		rsp.InteractionRespond(session, interaction, "teams has not yet been called")
+		return
+	}
+	teams := record.teamIDs()
+
+	winner, loser, scores := 0, 0, 0
+	match := Match{Time: time.Now(), InteractionID: interaction.ID}
+	for _, option := range interaction.ApplicationCommandData().Options[0].Options {
+		switch option.Name {
+		case "winner":
+			winner = int(option.IntValue())
+		case "loser":
+			loser = int(option.IntValue())
+		case "winner_score":
+			match.WinnerScore = int(option.IntValue())
+			scores++
+		case "loser_score":
+			match.LoserScore = int(option.IntValue())
+			scores++
+		}
+	}
+
+	if loser == 0 {
+		if len(teams) != 2 {
+			rsp.InteractionRespondf(session, interaction, "The losing team must be given when there are %d teams", len(teams))
+			return
+		}
+		loser = 3 - winner
+	}
+	if winner > len(teams) || loser > len(teams) {
+		rsp.InteractionRespondf(session, interaction, "Team numbers must be between 1 and %d", len(teams))
+		return
+	}
+	if winner == loser {
+		rsp.InteractionRespond(session, interaction, "A team cannot play against itself")
+		return
+	}
+	if scores == 1 {
+		rsp.InteractionRespond(session, interaction, "The scores of both teams must be given, or neither")
+		return
+	}
+	if scores == 2 && match.WinnerScore <= match.LoserScore {
+		rsp.InteractionRespond(session, interaction, "The winning team's score must be higher than the losing team's score")
+		return
+	}
+	match.Winners = teams[winner-1]
+	match.Losers = teams[loser-1]
+
+	winners, losers, err := data.RecordMatch(match, getSkillEdit(interaction, "match result"))
+	if errors.Is(err, errRepeatedMatch) {
+		rsp.InteractionRespond(session, interaction, "This report was already recorded, it is only recorded once")
+		return
+	}
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	response := fmt.Sprintf("Team %d beat Team %d", winner, loser)
+	if match.WinnerScore != 0 || match.LoserScore != 0 {
+		response = fmt.Sprintf("%s %d-%d", response, match.WinnerScore, match.LoserScore)
+	}
+	response = fmt.Sprintf("%s\n```%s\n%s\n```", response, skillChangesString(winners), skillChangesString(losers))
+	rsp.InteractionRespond(session, interaction, response)
+}
+
+func skillChangesString(changes []SkillChange) string {
+	longestName := 0
+	for _, change := range changes {
+		if len(change.Name) > longestName {
+			longestName = len(change.Name)
+		}
+	}
+
+	str := ""
+	for _, change := range changes {
+		str = fmt.Sprintf("%s\n%s%s  %2d -> %2d", str, change.Name, strings.Repeat(" ", longestName-len(change.Name)), change.Before, change.After)
+	}
+	return str
+}
@@ -0,0 +1,350 @@
+package commands
+
+// This file handles restricting commands to members with certain roles or discord permissions, and
+// the commands server managers use to configure those restrictions
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	dg "github.com/bwmarrin/discordgo"
+	rsp "github.com/philflip12/spikebot/internal/responder"
+	log "github.com/sirupsen/logrus"
+)
+
+// the discord permission needed to configure command permissions, so that a misconfiguration can
+// never lock the server out of spike
+const managePermissionsPermission = dg.PermissionManageServer
+
+// rules applied to commands which are meant for server managers until a rule is configured for them
+var defaultPermissionRules = map[string]PermissionRule{
+	"skill set":            {Permissions: dg.PermissionManageServer},
+	"skill increase":       {Permissions: dg.PermissionManageServer},
+	"skill decrease":       {Permissions: dg.PermissionManageServer},
+	"skill revert":         {Permissions: dg.PermissionManageServer},
+	"skill guest set":      {Permissions: dg.PermissionManageServer},
+	"skill guest increase": {Permissions: dg.PermissionManageServer},
+	"skill guest decrease": {Permissions: dg.PermissionManageServer},
+	"skill guest revert":   {Permissions: dg.PermissionManageServer},
+	"playing clear":        {Permissions: dg.PermissionManageServer},
+	"guest delete":         {Permissions: dg.PermissionManageServer},
+	"require_signatures":   {Permissions: dg.PermissionManageServer},
+	"season start":         {Permissions: dg.PermissionManageServer},
+	"season end":           {Permissions: dg.PermissionManageServer},
+	"match report":         {Permissions: dg.PermissionManageServer},
+	"tournament report":    {Permissions: dg.PermissionManageServer},
+	"teams swap":           {Permissions: dg.PermissionManageServer},
+	"teams move":           {Permissions: dg.PermissionManageServer},
+}
+
+// discord permissions which may be required by a command, keyed by the value of their choice
+var permissionChoices = []struct {
+	value      string
+	name       string
+	permission int64
+}{
+	{"administrator", "Administrator", dg.PermissionAdministrator},
+	{"manage_server", "Manage Server", dg.PermissionManageServer},
+	{"manage_roles", "Manage Roles", dg.PermissionManageRoles},
+	{"manage_channels", "Manage Channels", dg.PermissionManageChannels},
+	{"manage_messages", "Manage Messages", dg.PermissionManageMessages},
+	{"moderate_members", "Timeout Members", dg.PermissionModerateMembers},
+	{"kick_members", "Kick Members", dg.PermissionKickMembers},
+}
+
+func permissionOptionChoices() []*dg.ApplicationCommandOptionChoice {
+	choices := make([]*dg.ApplicationCommandOptionChoice, len(permissionChoices))
+	for i, choice := range permissionChoices {
+		choices[i] = &dg.ApplicationCommandOptionChoice{Name: choice.name, Value: choice.value}
+	}
+	return choices
+}
+
+// getCommandPath returns the name of the command followed by the subcommand group and subcommand
+// used, such as "skill guest set"
+func getCommandPath(data dg.ApplicationCommandInteractionData) string {
+	path := data.Name
+	options := data.Options
+	for len(options) > 0 {
+		option := options[0]
+		if option.Type != dg.ApplicationCommandOptionSubCommandGroup && option.Type != dg.ApplicationCommandOptionSubCommand {
+			break
+		}
+		path = fmt.Sprintf("%s %s", path, option.Name)
+		options = option.Options
+	}
+	return path
+}
+
+// getPermissionRule returns the rule of the most specific configured path containing the command
+func getPermissionRule(permissions map[string]PermissionRule, commandPath string) (PermissionRule, bool) {
+	for path := commandPath; ; {
+		if rule, ok := permissions[path]; ok {
+			return rule, true
+		}
+		index := strings.LastIndex(path, " ")
+		if index == -1 {
+			return PermissionRule{}, false
+		}
+		path = path[:index]
+	}
+}
+
+// resolvePermissionRule returns the rule restricting the command, which is the rule of the most
+// specific configured path containing it, or else its default rule. isDefault is true for a default
+// rule, and ok is false if anyone may use the command.
+func resolvePermissionRule(permissions map[string]PermissionRule, commandPath string) (rule PermissionRule, isDefault, ok bool) {
+	if rule, ok := getPermissionRule(permissions, commandPath); ok {
+		return rule, false, true
+	}
+	rule, ok = getPermissionRule(defaultPermissionRules, commandPath)
+	return rule, ok, ok
+}
+
+func (r PermissionRule) allows(member *dg.Member) bool {
+	if member == nil {
+		return false
+	}
+	if member.Permissions&dg.PermissionAdministrator != 0 {
+		return true
+	}
+	if r.Permissions != 0 && member.Permissions&r.Permissions == r.Permissions {
+		return true
+	}
+	for _, roleID := range member.Roles {
+		if slices.Contains(r.RoleIDs, roleID) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCommandPermission returns the reason the member who created the interaction may not run the
+// command, or an empty string if they may
+func checkCommandPermission(interaction *dg.InteractionCreate, data *serverData) (rejection string, err error) {
+	commandPath := getCommandPath(interaction.ApplicationCommandData())
+	if name := interaction.ApplicationCommandData().Name; name == "permissions" || name == "config" {
+		if interaction.Member == nil || interaction.Member.Permissions&(managePermissionsPermission|dg.PermissionAdministrator) == 0 {
+			return fmt.Sprintf("You need the Manage Server permission to use /%s", commandPath), nil
+		}
+		return "", nil
+	}
+
+	settings, err := data.GetSettings()
+	if err != nil {
+		return "", err
+	}
+	rule, _, ok := resolvePermissionRule(settings.Permissions, commandPath)
+	if !ok || rule.allows(interaction.Member) {
+		return "", nil
+	}
+	return fmt.Sprintf("You do not have permission to use /%s", commandPath), nil
+}
+
+// getCommandPaths returns every command path which permissions may be configured for
+func getCommandPaths() map[string]struct{} {
+	paths := map[string]struct{}{}
+	var addPaths func(path string, options []*dg.ApplicationCommandOption)
+	addPaths = func(path string, options []*dg.ApplicationCommandOption) {
+		paths[path] = struct{}{}
+		for _, option := range options {
+			if option.Type == dg.ApplicationCommandOptionSubCommandGroup || option.Type == dg.ApplicationCommandOptionSubCommand {
+				addPaths(fmt.Sprintf("%s %s", path, option.Name), option.Options)
+			}
+		}
+	}
+	for _, command := range CommandList {
+		if command.Name != "permissions" && command.Name != "config" {
+			addPaths(command.Name, command.Options)
+		}
+	}
+	return paths
+}
+
+// parseCommandPath normalizes a command path entered by a user, such as "/skill  guest set"
+func parseCommandPath(command string) (string, error) {
+	path := strings.Join(strings.Fields(strings.TrimPrefix(strings.TrimSpace(command), "/")), " ")
+	if _, ok := getCommandPaths()[path]; !ok {
+		return "", fmt.Errorf("'%s' is not a command which permissions can be set for", command)
+	}
+	return path, nil
+}
+
+func cmdPermissions(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options
+	subCommandName := options[0].Name
+
+	switch subCommandName {
+	case "require_role":
+		requireRole(session, interaction, data)
+	case "require_permission":
+		requirePermission(session, interaction, data)
+	case "reset":
+		resetPermissions(session, interaction, data)
+	case "show":
+		showPermissions(session, interaction, data)
+	}
+}
+
+// getConfiguredRule returns the parsed command path from the first option of the subcommand along
+// with the rule currently configured for exactly that path
+func getConfiguredRule(data *serverData, options []*dg.ApplicationCommandInteractionDataOption) (string, PermissionRule, error) {
+	path, err := parseCommandPath(options[0].StringValue())
+	if err != nil {
+		return "", PermissionRule{}, err
+	}
+	settings, err := data.GetSettings()
+	if err != nil {
+		return "", PermissionRule{}, err
+	}
+	return path, settings.Permissions[path], nil
+}
+
+func requireRole(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options[0].Options
+	path, rule, err := getConfiguredRule(data, options)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	role := options[1].RoleValue(nil, interaction.GuildID)
+
+	if !slices.Contains(rule.RoleIDs, role.ID) {
+		rule.RoleIDs = append(slices.Clone(rule.RoleIDs), role.ID)
+		if err := data.SetCommandPermission(path, rule); err != nil {
+			log.Error(err)
+			rsp.InteractionRespond(session, interaction, err.Error())
+			return
+		}
+	}
+
+	rsp.InteractionRespondf(session, interaction, "Members with the \"%s\" role may now use /%s", getRoleName(session, interaction.GuildID, role.ID), path)
+}
+
+func requirePermission(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options[0].Options
+	path, rule, err := getConfiguredRule(data, options)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	value := options[1].StringValue()
+	name := ""
+	for _, choice := range permissionChoices {
+		if choice.value == value {
+			rule.Permissions = choice.permission
+			name = choice.name
+		}
+	}
+
+	if err := data.SetCommandPermission(path, rule); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	rsp.InteractionRespondf(session, interaction, "Members with the %s permission may now use /%s", name, path)
+}
+
+func resetPermissions(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options[0].Options
+	path, err := parseCommandPath(options[0].StringValue())
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	if err := data.SetCommandPermission(path, PermissionRule{}); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	settings, err := data.GetSettings()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	response := fmt.Sprintf("Removed the permission requirements of /%s", path)
+	if _, isDefault, ok := resolvePermissionRule(settings.Permissions, path); !ok {
+		response = fmt.Sprintf("%s, anyone may now use it", response)
+	} else if isDefault {
+		response = fmt.Sprintf("%s, it is restricted by default until a rule is set", response)
+	}
+	rsp.InteractionRespond(session, interaction, response)
+}
+
+func showPermissions(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	settings, err := data.GetSettings()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	rules := maps.Clone(settings.Permissions)
+	if rules == nil {
+		rules = map[string]PermissionRule{}
+	}
+	defaults := map[string]bool{}
+	for path, rule := range defaultPermissionRules {
+		if _, ok := getPermissionRule(settings.Permissions, path); !ok {
+			rules[path] = rule
+			defaults[path] = true
+		}
+	}
+	if len(rules) == 0 {
+		rsp.InteractionRespond(session, interaction, "No command permissions are set, anyone may use every command")
+		return
+	}
+
+	paths := make([]string, 0, len(rules))
+	for path := range rules {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	response := "Command Permissions:\n```"
+	for _, path := range paths {
+		rule := rules[path]
+		allowed := []string{}
+		for _, roleID := range rule.RoleIDs {
+			allowed = append(allowed, fmt.Sprintf("\"%s\" role", getRoleName(session, interaction.GuildID, roleID)))
+		}
+		for _, choice := range permissionChoices {
+			if rule.Permissions == choice.permission {
+				allowed = append(allowed, fmt.Sprintf("%s permission", choice.name))
+			}
+		}
+		if defaults[path] {
+			allowed = append(allowed, "by default until a rule is set")
+		}
+		response = fmt.Sprintf("%s\n/%s\n\t%s", response, path, strings.Join(allowed, "\n\t"))
+	}
+	response = fmt.Sprintf("%s\n```", response)
+	rsp.InteractionRespond(session, interaction, response)
+}
+
+// getRoleName returns the name of a role, or its ID if the role has been deleted
+func getRoleName(session *dg.Session, guildID, roleID string) string {
+	if role, err := session.State.Role(guildID, roleID); err == nil {
+		return role.Name
+	}
+	roles, err := session.GuildRoles(guildID)
+	if err != nil {
+		return roleID
+	}
+	for _, role := range roles {
+		if role.ID == roleID {
+			return role.Name
+		}
+	}
+	return roleID
+}
@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"testing"
+
+	dg "github.com/bwmarrin/discordgo"
+)
+
+func TestDefaultPermissionRulesAreCommands(t *testing.T) {
+	paths := getCommandPaths()
+	for path := range defaultPermissionRules {
+		if _, ok := paths[path]; !ok {
+			t.Errorf("default permission rule for /%s, which is not a command", path)
+		}
+	}
+}
+
+func TestResolvePermissionRule(t *testing.T) {
+	organizers := PermissionRule{RoleIDs: []string{"10"}}
+	guestManagers := PermissionRule{RoleIDs: []string{"11"}}
+	permissions := map[string]PermissionRule{
+		"skill":        organizers,
+		"guest":        organizers,
+		"guest create": guestManagers,
+	}
+
+	tests := []struct {
+		path      string
+		wantRole  string
+		isDefault bool
+		ok        bool
+	}{
+		// a rule applies to the subcommands of its command
+		{path: "skill set", wantRole: "10", ok: true},
+		{path: "skill guest revert", wantRole: "10", ok: true},
+		// and the rule of a subcommand to only that subcommand
+		{path: "guest create", wantRole: "11", ok: true},
+		{path: "guest delete", wantRole: "10", ok: true},
+		// commands meant for server managers are restricted until a rule is configured for them
+		{path: "playing clear", isDefault: true, ok: true},
+		{path: "require_signatures", isDefault: true, ok: true},
+		{path: "season start", isDefault: true, ok: true},
+		{path: "match report", isDefault: true, ok: true},
+		{path: "tournament report", isDefault: true, ok: true},
+		{path: "teams swap", isDefault: true, ok: true},
+		{path: "teams move", isDefault: true, ok: true},
+		{path: "playing add", ok: false},
+		{path: "season show", ok: false},
+	}
+	for _, test := range tests {
+		rule, isDefault, ok := resolvePermissionRule(permissions, test.path)
+		if ok != test.ok || isDefault != test.isDefault {
+			t.Errorf("/%s: ok %t and default %t, want %t and %t", test.path, ok, isDefault, test.ok, test.isDefault)
+			continue
+		}
+		if test.wantRole != "" && (len(rule.RoleIDs) != 1 || rule.RoleIDs[0] != test.wantRole) {
+			t.Errorf("/%s: roles %v, want [%s]", test.path, rule.RoleIDs, test.wantRole)
+		}
+		if test.isDefault && rule.Permissions != dg.PermissionManageServer {
+			t.Errorf("/%s: default permissions %d, want Manage Server", test.path, rule.Permissions)
+		}
+	}
+}
+
+func TestDefaultPermissionRulesDenyMembers(t *testing.T) {
+	member := &dg.Member{Roles: []string{"10"}, Permissions: dg.PermissionSendMessages | dg.PermissionUseSlashCommands}
+	admin := &dg.Member{Permissions: dg.PermissionAdministrator}
+	paths := []string{"skill set", "match report", "tournament report", "teams swap", "teams move"}
+	for _, path := range paths {
+		rule, _, ok := resolvePermissionRule(map[string]PermissionRule{}, path)
+		if !ok {
+			t.Errorf("/%s: no default rule", path)
+			continue
+		}
+		if rule.allows(member) {
+			t.Errorf("/%s: allows a member who does not manage the server", path)
+		}
+		if !rule.allows(admin) {
+			t.Errorf("/%s: denies an administrator", path)
+		}
+	}
+	// a configured rule replaces the default
+	rule, _, _ := resolvePermissionRule(map[string]PermissionRule{"match": {RoleIDs: []string{"10"}}}, "match report")
+	if !rule.allows(member) {
+		t.Errorf("/match report: denies a member with the configured role")
+	}
+}
+
+func TestPermissionRuleAllows(t *testing.T) {
+	rule := PermissionRule{RoleIDs: []string{"10"}, Permissions: dg.PermissionManageServer | dg.PermissionManageRoles}
+	tests := []struct {
+		name   string
+		member *dg.Member
+		want   bool
+	}{
+		{"no member", nil, false},
+		{"no role or permission", &dg.Member{Roles: []string{"11"}}, false},
+		{"one of the roles", &dg.Member{Roles: []string{"11", "10"}}, true},
+		{"some of the permissions", &dg.Member{Permissions: dg.PermissionManageServer}, false},
+		{"all of the permissions", &dg.Member{Permissions: dg.PermissionManageServer | dg.PermissionManageRoles}, true},
+		{"administrator", &dg.Member{Permissions: dg.PermissionAdministrator}, true},
+	}
+	for _, test := range tests {
+		if got := rule.allows(test.member); got != test.want {
+			t.Errorf("%s: allows %t, want %t", test.name, got, test.want)
+		}
+	}
+}
@@ -4,7 +4,10 @@ package commands
 
 import (
 	"fmt"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
 
 	dg "github.com/bwmarrin/discordgo"
 	rsp "github.com/philflip12/spikebot/internal/responder"
@@ -20,6 +23,8 @@ func cmdPlay(session *dg.Session, interaction *dg.InteractionCreate, data *serve
 		addToPlaying(session, interaction, data)
 	case "remove":
 		removeFromPlaying(session, interaction, data)
+	case "leave":
+		leavePlaying(session, interaction, data)
 	case "clear":
 		clearPlaying(session, interaction, data)
 	case "show_all":
@@ -51,7 +56,8 @@ func addToPlaying(session *dg.Session, interaction *dg.InteractionCreate, data *
 		return
 	}
 
-	if err := data.AddPlayingUsers(userIDs...); err != nil {
+	waitlisted, err := data.AddPlayingUsers(userIDs...)
+	if err != nil {
 		log.Error(err)
 		rsp.InteractionRespond(session, interaction, err.Error())
 		return
@@ -63,6 +69,13 @@ func addToPlaying(session *dg.Session, interaction *dg.InteractionCreate, data *
 		rsp.InteractionRespond(session, interaction, err.Error())
 		return
 	}
+	waitlistStr, err := getWaitlistChangesString(data, waitlisted, nil)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	numPlayingStr = fmt.Sprintf("%s%s", numPlayingStr, waitlistStr)
 
 	if len(names) == 1 {
 		rsp.InteractionRespondf(session, interaction, "Added \"%s\" to playing%s", names[0], numPlayingStr)
@@ -84,18 +97,35 @@ func removeFromPlaying(session *dg.Session, interaction *dg.InteractionCreate, d
 		userIDs[i] = options[i].UserValue(nil).ID
 	}
 
-	names, err := getUserNames(data, interaction.GuildID, userIDs, session)
+	removed, promoted, err := data.RemovePlayingUsers(userIDs...)
 	if err != nil {
 		log.Error(err)
 		rsp.InteractionRespond(session, interaction, err.Error())
 		return
 	}
+	notPlaying := slices.DeleteFunc(slices.Clone(userIDs), func(userID string) bool {
+		return slices.Contains(removed, userID)
+	})
+	slices.Sort(notPlaying)
+	notPlaying = slices.Compact(notPlaying)
 
-	if err := data.RemovePlayingUsers(userIDs...); err != nil {
+	removedNames, err := getUserNames(data, interaction.GuildID, removed, session)
+	if err != nil {
 		log.Error(err)
 		rsp.InteractionRespond(session, interaction, err.Error())
 		return
 	}
+	notPlayingNames, err := getUserNames(data, interaction.GuildID, notPlaying, session)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	response := getRemovedFromPlayingString("", "users", removedNames, notPlayingNames)
+	if len(removed) == 0 {
+		rsp.InteractionRespond(session, interaction, response)
+		return
+	}
 
 	numPlayingStr, err := getNumPlayingString(data)
 	if err != nil {
@@ -103,17 +133,83 @@ func removeFromPlaying(session *dg.Session, interaction *dg.InteractionCreate, d
 		rsp.InteractionRespond(session, interaction, err.Error())
 		return
 	}
+	waitlistStr, err := getWaitlistChangesString(data, nil, promoted)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	rsp.InteractionRespondf(session, interaction, "%s%s%s", response, numPlayingStr, waitlistStr)
+}
 
-	if len(names) == 1 {
-		rsp.InteractionRespondf(session, interaction, "Removed \"%s\" from playing%s", names[0], numPlayingStr)
+// getRemovedFromPlayingString lists the users who were removed from playing followed by those who
+// were not playing to begin with. A single removed user is named after the kind, such as "guest ",
+// and several are listed under the plural, such as "guests"
+func getRemovedFromPlayingString(kind, plural string, removedNames, notPlayingNames []string) string {
+	response := ""
+	switch len(removedNames) {
+	case 0:
+	case 1:
+		response = fmt.Sprintf("Removed %s%q from playing", kind, removedNames[0])
+	default:
+		response = fmt.Sprintf("Removed %s from playing:", plural)
+		for _, name := range removedNames {
+			response = fmt.Sprintf("%s\n\t%s", response, name)
+		}
+	}
+	if response != "" && len(notPlayingNames) > 0 {
+		response += "\n"
+	}
+	switch len(notPlayingNames) {
+	case 0:
+	case 1:
+		response = fmt.Sprintf("%s%q was not playing", response, notPlayingNames[0])
+	default:
+		quoted := make([]string, len(notPlayingNames))
+		for i, name := range notPlayingNames {
+			quoted[i] = strconv.Quote(name)
+		}
+		response = fmt.Sprintf("%sNot playing: %s", response, strings.Join(quoted, ", "))
+	}
+	return response
+}
+
+// leavePlaying removes the user who sent the command from the playing group or waitlist
+func leavePlaying(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	userID := interaction.Member.User.ID
+
+	name, err := getUserName(data, interaction.GuildID, userID, session)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
 		return
 	}
-	response := "Removed users from playing:"
-	for i := range names {
-		response = fmt.Sprintf("%s\n\t%s", response, names[i])
+
+	removed, promoted, err := data.RemovePlayingUsers(userID)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
 	}
-	response = fmt.Sprintf("%s%s", response, numPlayingStr)
-	rsp.InteractionRespond(session, interaction, response)
+	if len(removed) == 0 {
+		rsp.InteractionRespondf(session, interaction, "\"%s\" was not playing", name)
+		return
+	}
+
+	numPlayingStr, err := getNumPlayingString(data)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	waitlistStr, err := getWaitlistChangesString(data, nil, promoted)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	rsp.InteractionRespondf(session, interaction, "\"%s\" left playing%s%s", name, numPlayingStr, waitlistStr)
 }
 
 func clearPlaying(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
@@ -148,5 +244,19 @@ func showPlaying(session *dg.Session, interaction *dg.InteractionCreate, data *s
 	}
 	str = fmt.Sprintf("%s\n```", str)
 
+	waitlist, err := data.GetWaitlist()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	if len(waitlist) > 0 {
+		str = fmt.Sprintf("%s%d on the waitlist:\n```", str, len(waitlist))
+		for i, player := range waitlist {
+			str = fmt.Sprintf("%s\n%2d. %2d %s", str, i+1, player.Skill, player.Name)
+		}
+		str = fmt.Sprintf("%s\n```", str)
+	}
+
 	rsp.InteractionRespond(session, interaction, str)
 }
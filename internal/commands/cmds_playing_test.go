@@ -0,0 +1,31 @@
+package commands
+
+import "testing"
+
+func TestRemovedFromPlayingString(t *testing.T) {
+	tests := []struct {
+		name             string
+		kind, plural     string
+		removed, missing []string
+		want             string
+	}{
+		{"one removed", "", "users", []string{"Ann"}, nil, `Removed "Ann" from playing`},
+		{"one guest removed", "guest ", "guests", []string{"Ann"}, nil, `Removed guest "Ann" from playing`},
+		{"several removed", "", "users", []string{"Ann", "Bob"}, nil, "Removed users from playing:\n\tAnn\n\tBob"},
+		{"one not playing", "", "users", nil, []string{"Cat"}, `"Cat" was not playing`},
+		{"several not playing", "guest ", "guests", nil, []string{"Cat", "Dan"}, `Not playing: "Cat", "Dan"`},
+		{
+			"removed and not playing", "", "users", []string{"Ann", "Bob"}, []string{"Cat"},
+			"Removed users from playing:\n\tAnn\n\tBob\n\"Cat\" was not playing",
+		},
+		{
+			"guest removed and guests not playing", "guest ", "guests", []string{"Ann"}, []string{"Cat", "Dan"},
+			"Removed guest \"Ann\" from playing\nNot playing: \"Cat\", \"Dan\"",
+		},
+	}
+	for _, test := range tests {
+		if got := getRemovedFromPlayingString(test.kind, test.plural, test.removed, test.missing); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package commands
+
+// This file handles the positions players prefer to play, which teams can be balanced by so that
+// every team gets its share of each position
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	dg "github.com/bwmarrin/discordgo"
+	rsp "github.com/philflip12/spikebot/internal/responder"
+	log "github.com/sirupsen/logrus"
+)
+
+// positionNames are the positions a player may choose, in the order they are shown
+var positionNames = []string{"setter", "hitter", "middle", "libero"}
+
+func positionChoices() []*dg.ApplicationCommandOptionChoice {
+	choices := make([]*dg.ApplicationCommandOptionChoice, len(positionNames))
+	for i, name := range positionNames {
+		choices[i] = &dg.ApplicationCommandOptionChoice{Name: name, Value: name}
+	}
+	return choices
+}
+
+// getPositionIndex returns the index of the position in positionNames, or -1 for no position
+func getPositionIndex(position string) int {
+	for i, name := range positionNames {
+		if name == position {
+			return i
+		}
+	}
+	return -1
+}
+
+// getBalancePositions returns the index of the position each player is balanced as, or -1 for
+// players without a position. When too few players have a position as their primary position for
+// every team to get one, players with it as their secondary position fill in, as long as doing so
+// does not leave their primary position short.
+func getBalancePositions(players []Player, numTeams int) []int {
+	positions := make([]int, len(players))
+	counts := make([]int, len(positionNames))
+	for i, player := range players {
+		positions[i] = getPositionIndex(player.Position)
+		if positions[i] >= 0 {
+			counts[positions[i]]++
+		}
+	}
+
+	for position := range positionNames {
+		for i, player := range players {
+			if counts[position] >= numTeams {
+				break
+			}
+			current := positions[i]
+			if getPositionIndex(player.SecondaryPosition) != position || current == position {
+				continue
+			}
+			if current >= 0 && counts[current] <= numTeams {
+				continue
+			}
+			if current >= 0 {
+				counts[current]--
+			}
+			positions[i] = position
+			counts[position]++
+		}
+	}
+	return positions
+}
+
+// getPositionsString returns the positions of a player for display, such as "setter/hitter"
+func getPositionsString(player Player) string {
+	if player.SecondaryPosition == "" {
+		return player.Position
+	}
+	return fmt.Sprintf("%s/%s", player.Position, player.SecondaryPosition)
+}
+
+func cmdPosition(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options
+	subCommandName := options[0].Name
+
+	switch subCommandName {
+	case "set":
+		setPosition(session, interaction, data)
+	case "clear":
+		clearPosition(session, interaction, data)
+	case "show_all":
+		showAllPositions(session, interaction, data)
+	case "guest":
+		options = options[0].Options
+		subCommandName := options[0].Name
+		switch subCommandName {
+		case "set":
+			setGuestPosition(session, interaction, data)
+		case "clear":
+			clearGuestPosition(session, interaction, data)
+		}
+	}
+}
+
+// getPositionOptions returns the primary and secondary positions chosen in the options following
+// the player option
+func getPositionOptions(options []*dg.ApplicationCommandInteractionDataOption) (primary, secondary string, err error) {
+	primary = options[1].StringValue()
+	secondary = getOptionalString(options, 2)
+	if secondary == primary {
+		return "", "", errors.New("the secondary position cannot be the same as the primary position")
+	}
+	return primary, secondary, nil
+}
+
+func setPosition(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options[0].Options
+	// Passing nil to UserValue avoids an extra API query.
+	userID := options[0].UserValue(nil).ID
+
+	primary, secondary, err := getPositionOptions(options)
+	if err != nil {
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	name, err := getUserName(data, interaction.GuildID, userID, session)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	if err := data.SetPlayerPositions(userID, primary, secondary); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	rsp.InteractionRespondf(session, interaction, "Set \"%s\" position to %s", name, getPositionsString(Player{Position: primary, SecondaryPosition: secondary}))
+}
+
+func clearPosition(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options[0].Options
+	// Passing nil to UserValue avoids an extra API query.
+	userID := options[0].UserValue(nil).ID
+
+	name, err := getUserName(data, interaction.GuildID, userID, session)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	if err := data.SetPlayerPositions(userID, "", ""); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	rsp.InteractionRespondf(session, interaction, "Cleared the position of \"%s\"", name)
+}
+
+func setGuestPosition(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options[0].Options[0].Options
+	roleID := options[0].RoleValue(nil, "").ID
+	guestID := "g" + roleID
+
+	primary, secondary, err := getPositionOptions(options)
+	if err != nil {
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	player, ok, err := data.GetPlayer(guestID)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	if !ok {
+		rsp.InteractionRespond(session, interaction, "Role selected does not represent a guest")
+		return
+	}
+
+	if err := data.SetPlayerPositions(guestID, primary, secondary); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	rsp.InteractionRespondf(session, interaction, "Set %q position to %s", player.Name, getPositionsString(Player{Position: primary, SecondaryPosition: secondary}))
+}
+
+func clearGuestPosition(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options[0].Options[0].Options
+	roleID := options[0].RoleValue(nil, "").ID
+	guestID := "g" + roleID
+
+	player, ok, err := data.GetPlayer(guestID)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	if !ok {
+		rsp.InteractionRespond(session, interaction, "Role selected does not represent a guest")
+		return
+	}
+
+	if err := data.SetPlayerPositions(guestID, "", ""); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	rsp.InteractionRespondf(session, interaction, "Cleared the position of %q", player.Name)
+}
+
+func showAllPositions(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	players, err := data.GetPlayers()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	playerList := make([]Player, 0, len(players))
+	longestName := 0
+	for _, player := range players {
+		if player.Position == "" {
+			continue
+		}
+		playerList = append(playerList, player)
+		longestName = max(longestName, len(player.Name))
+	}
+	if len(playerList) == 0 {
+		rsp.InteractionRespond(session, interaction, "No players have a position")
+		return
+	}
+
+	sort.Slice(playerList, func(i, j int) bool {
+		positionI, positionJ := getPositionIndex(playerList[i].Position), getPositionIndex(playerList[j].Position)
+		if positionI != positionJ {
+			return positionI < positionJ
+		}
+		return playerList[i].Name < playerList[j].Name
+	})
+
+	str := "All Positions:\n```"
+	for _, player := range playerList {
+		str = fmt.Sprintf("%s\n%s%s  %s", str, player.Name, strings.Repeat(" ", longestName-len(player.Name)), getPositionsString(player))
+	}
+	str = fmt.Sprintf("%s\n```", str)
+
+	rsp.InteractionRespond(session, interaction, str)
+}
@@ -0,0 +1,360 @@
+package commands
+
+// This file handles scheduling the last created teams onto the courts when there are more teams
+// than courts, either as a round robin or as king of the court where the winners stay on
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	dg "github.com/bwmarrin/discordgo"
+	rsp "github.com/philflip12/spikebot/internal/responder"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	scheduleRoundRobin = "round_robin"
+	scheduleKing       = "king_of_the_court"
+)
+
+// the length of each game in minutes when none is given
+const defaultGameLength = 15
+
+func cmdSchedule(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options
+	subCommandName := options[0].Name
+
+	switch subCommandName {
+	case "create":
+		createSchedule(session, interaction, data)
+	case "next":
+		nextScheduleRound(session, interaction, data)
+	case "show":
+		showSchedule(session, interaction, data)
+	}
+}
+
+func createSchedule(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	schedule := Schedule{GameLength: defaultGameLength}
+	for _, option := range interaction.ApplicationCommandData().Options[0].Options {
+		switch option.Name {
+		case "format":
+			schedule.Format = option.StringValue()
+		case "courts":
+			schedule.Courts = int(option.IntValue())
+		case "game_length":
+			schedule.GameLength = int(option.IntValue())
+		}
+	}
+
+	record, ok, err := getLastTeamsRecord(data)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	if !ok {
+		rsp.InteractionRespond(session, interaction, "teams has not yet been called")
+		return
+	}
+
+	schedule.TeamsTime = record.Time
+	schedule.NumTeams = len(record.Teams)
+	if schedule.NumTeams < 2 {
+		rsp.InteractionRespond(session, interaction, "At least 2 teams are needed to make a schedule")
+		return
+	}
+	// every court needs two teams to play on it
+	schedule.Courts = min(schedule.Courts, schedule.NumTeams/2)
+	if schedule.Format == scheduleKing {
+		schedule.Rounds = [][][2]int{{}}
+		for court := 0; court < schedule.Courts; court++ {
+			schedule.Rounds[0] = append(schedule.Rounds[0], [2]int{2*court + 1, 2*court + 2})
+		}
+		for team := 2*schedule.Courts + 1; team <= schedule.NumTeams; team++ {
+			schedule.Queue = append(schedule.Queue, team)
+		}
+	} else {
+		schedule.Rounds = getRoundRobinRounds(schedule.NumTeams, schedule.Courts)
+	}
+
+	if err := data.SaveSchedule(schedule); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	rsp.InteractionRespond(session, interaction, getScheduleString(schedule))
+}
+
+// getRoundRobinRounds pairs every team against every other team once using the circle method, then
+// splits the matches of each pairing round into rounds of at most one match per court
+func getRoundRobinRounds(numTeams, courts int) [][][2]int {
+	// team 0 is a bye, which the team paired against it sits out
+	circle := make([]int, 0, numTeams+1)
+	for team := 1; team <= numTeams; team++ {
+		circle = append(circle, team)
+	}
+	if len(circle)%2 == 1 {
+		circle = append(circle, 0)
+	}
+
+	rounds := [][][2]int{}
+	for pairing := 0; pairing < len(circle)-1; pairing++ {
+		matches := [][2]int{}
+		for i := 0; i < len(circle)/2; i++ {
+			teamA, teamB := circle[i], circle[len(circle)-1-i]
+			if teamA != 0 && teamB != 0 {
+				matches = append(matches, [2]int{min(teamA, teamB), max(teamA, teamB)})
+			}
+		}
+		for len(matches) > 0 {
+			count := min(courts, len(matches))
+			rounds = append(rounds, matches[:count])
+			matches = matches[count:]
+		}
+		// the first team stays in place while the others rotate around it
+		last := circle[len(circle)-1]
+		copy(circle[2:], circle[1:len(circle)-1])
+		circle[1] = last
+	}
+	return rounds
+}
+
+// getCurrentSchedule returns the saved schedule, responding to the interaction if there is none or
+// the teams have been created again since it was made
+func getCurrentSchedule(
+	session *dg.Session,
+	interaction *dg.InteractionCreate,
+	data *serverData,
+) (Schedule, TeamsRecord, bool) {
+	schedule, ok, err := data.GetSchedule()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return Schedule{}, TeamsRecord{}, false
+	}
+	if !ok {
+		rsp.InteractionRespond(session, interaction, "There is no schedule, use /schedule create to make one")
+		return Schedule{}, TeamsRecord{}, false
+	}
+
+	record, ok, err := getLastTeamsRecord(data)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return Schedule{}, TeamsRecord{}, false
+	}
+	if !ok || !record.Time.Equal(schedule.TeamsTime) || len(record.Teams) != schedule.NumTeams {
+		rsp.InteractionRespond(session, interaction, "The teams have been created again since the schedule was made, use /schedule create to make a new one")
+		return Schedule{}, TeamsRecord{}, false
+	}
+	return schedule, record, true
+}
+
+func nextScheduleRound(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	winners := []int{}
+	for _, option := range interaction.ApplicationCommandData().Options[0].Options {
+		switch option.Name {
+		case "winners":
+			var err error
+			winners, err = parseTeamNumbers(option.StringValue())
+			if err != nil {
+				rsp.InteractionRespond(session, interaction, err.Error())
+				return
+			}
+		}
+	}
+
+	schedule, record, ok := getCurrentSchedule(session, interaction, data)
+	if !ok {
+		return
+	}
+
+	if schedule.Format == scheduleKing {
+		if err := schedule.advanceKing(winners); err != nil {
+			rsp.InteractionRespond(session, interaction, err.Error())
+			return
+		}
+	} else {
+		if len(winners) > 0 {
+			rsp.InteractionRespond(session, interaction, "Winners are only needed for king of the court")
+			return
+		}
+		if schedule.Round == len(schedule.Rounds)-1 {
+			rsp.InteractionRespond(session, interaction, "The round robin is complete, every team has played every other team")
+			return
+		}
+		schedule.Round++
+	}
+
+	if err := data.SaveSchedule(schedule); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	rsp.InteractionRespond(session, interaction, getMatchupsString(schedule, record))
+}
+
+// parseTeamNumbers parses a comma separated list of team numbers, such as "1,3"
+func parseTeamNumbers(str string) ([]int, error) {
+	teams := []int{}
+	for _, field := range strings.Split(str, ",") {
+		team, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || team < 1 {
+			return nil, fmt.Errorf("\"%s\" is not a valid team number, team numbers must be separated by commas", strings.TrimSpace(field))
+		}
+		teams = append(teams, team)
+	}
+	return teams, nil
+}
+
+// advanceKing starts the next king of the court round. The winner on each court stays on, and the
+// loser goes to the back of the queue while the team at the front of the queue takes their place.
+func (schedule *Schedule) advanceKing(winners []int) error {
+	current := schedule.Rounds[schedule.Round]
+	if len(current) == 0 {
+		return errors.New("The schedule has no matches, use /schedule create to make a new one")
+	}
+	if len(winners) != len(current) {
+		return fmt.Errorf("The winner of each of the %d courts must be given", len(current))
+	}
+
+	next := make([][2]int, len(current))
+	for court, match := range current {
+		winner := -1
+		for _, team := range winners {
+			if team == match[0] || team == match[1] {
+				if winner != -1 {
+					return fmt.Errorf("Only one of teams %d and %d can win on court %d", match[0], match[1], court+1)
+				}
+				winner = team
+			}
+		}
+		if winner == -1 {
+			return fmt.Errorf("The winner of team %d and team %d on court %d was not given", match[0], match[1], court+1)
+		}
+		loser := match[0]
+		if loser == winner {
+			loser = match[1]
+		}
+		next[court][0] = winner
+		schedule.Queue = append(schedule.Queue, loser)
+	}
+	for court := range next {
+		next[court][1] = schedule.Queue[0]
+		schedule.Queue = slices.Delete(schedule.Queue, 0, 1)
+	}
+
+	schedule.Rounds = append(schedule.Rounds, next)
+	schedule.Round++
+	return nil
+}
+
+func showSchedule(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	schedule, _, ok := getCurrentSchedule(session, interaction, data)
+	if !ok {
+		return
+	}
+	rsp.InteractionRespond(session, interaction, getScheduleString(schedule))
+}
+
+// getScheduleString returns the schedule as a table of the matches on each court in each round,
+// with the round being played marked
+func getScheduleString(schedule Schedule) string {
+	format := "Round robin"
+	if schedule.Format == scheduleKing {
+		format = "King of the court"
+	}
+	str := fmt.Sprintf("%s, %d teams on %d courts, %d minute games:\n```", format, schedule.NumTeams, schedule.Courts, schedule.GameLength)
+
+	str = fmt.Sprintf("%s\n   Round  Start", str)
+	for court := 1; court <= schedule.Courts; court++ {
+		str = fmt.Sprintf("%s  Court %-3d", str, court)
+	}
+	str = fmt.Sprintf("%s  Sitting out", str)
+
+	for roundIdx, round := range schedule.Rounds {
+		marker := " "
+		if roundIdx == schedule.Round {
+			marker = ">"
+		}
+		start := roundIdx * schedule.GameLength
+		str = fmt.Sprintf("%s\n%s  %5d  %2d:%02d", str, marker, roundIdx+1, start/60, start%60)
+		for court := 0; court < schedule.Courts; court++ {
+			if court < len(round) {
+				str = fmt.Sprintf("%s  %-9s", str, fmt.Sprintf("%d v %d", round[court][0], round[court][1]))
+			} else {
+				str = fmt.Sprintf("%s  %-9s", str, "")
+			}
+		}
+		str = fmt.Sprintf("%s  %s", str, joinTeamNumbers(getSittingOut(schedule, roundIdx)))
+	}
+	str = fmt.Sprintf("%s\n```", str)
+
+	if schedule.Format == scheduleKing && len(schedule.Queue) > 0 {
+		str = fmt.Sprintf("%s\nUp next: %s", str, joinTeamNumbers(schedule.Queue))
+	}
+	return str
+}
+
+// getSittingOut returns the team numbers not playing in a round, in the order they play next
+func getSittingOut(schedule Schedule, roundIdx int) []int {
+	if schedule.Format == scheduleKing && roundIdx == schedule.Round {
+		return schedule.Queue
+	}
+	playing := map[int]bool{}
+	for _, match := range schedule.Rounds[roundIdx] {
+		playing[match[0]] = true
+		playing[match[1]] = true
+	}
+	sittingOut := []int{}
+	for team := 1; team <= schedule.NumTeams; team++ {
+		if !playing[team] {
+			sittingOut = append(sittingOut, team)
+		}
+	}
+	return sittingOut
+}
+
+func joinTeamNumbers(teams []int) string {
+	strs := make([]string, len(teams))
+	for i, team := range teams {
+		strs[i] = strconv.Itoa(team)
+	}
+	return strings.Join(strs, ", ")
+}
+
+// getMatchupsString announces the matches of the round being played, naming the players of each team
+func getMatchupsString(schedule Schedule, record TeamsRecord) string {
+	round := schedule.Rounds[schedule.Round]
+	str := fmt.Sprintf("**Round %d**", schedule.Round+1)
+	if schedule.Format == scheduleRoundRobin {
+		str = fmt.Sprintf("%s of %d", str, len(schedule.Rounds))
+	}
+	str = fmt.Sprintf("%s is starting:", str)
+	for court, match := range round {
+		str = fmt.Sprintf("%s\nCourt %d: %s vs %s", str, court+1, getTeamNames(record, match[0]), getTeamNames(record, match[1]))
+	}
+	if sittingOut := getSittingOut(schedule, schedule.Round); len(sittingOut) > 0 {
+		strs := make([]string, len(sittingOut))
+		for i, team := range sittingOut {
+			strs[i] = getTeamNames(record, team)
+		}
+		str = fmt.Sprintf("%s\nSitting out: %s", str, strings.Join(strs, ", "))
+	}
+	return str
+}
+
+// getTeamNames describes a team by its number and the names of its players
+func getTeamNames(record TeamsRecord, team int) string {
+	names := make([]string, len(record.Teams[team-1]))
+	for i, player := range record.Teams[team-1] {
+		names[i] = player.Name
+	}
+	return fmt.Sprintf("Team %d (%s)", team, strings.Join(names, ", "))
+}
@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRoundRobinRounds(t *testing.T) {
+	for numTeams := 2; numTeams <= 9; numTeams++ {
+		for courts := 1; courts <= 3; courts++ {
+			t.Run(fmt.Sprintf("%d teams on %d courts", numTeams, courts), func(t *testing.T) {
+				rounds := getRoundRobinRounds(numTeams, courts)
+				meetings := map[[2]int]int{}
+				for r, round := range rounds {
+					if len(round) == 0 || len(round) > courts {
+						t.Errorf("round %d has %d matches, want 1 to %d", r+1, len(round), courts)
+					}
+					playing := map[int]bool{}
+					for _, match := range round {
+						for _, team := range match {
+							if team < 1 || team > numTeams {
+								t.Fatalf("round %d has team %d", r+1, team)
+							}
+							if playing[team] {
+								t.Errorf("team %d plays twice in round %d", team, r+1)
+							}
+							playing[team] = true
+						}
+						meetings[match]++
+					}
+				}
+
+				for a := 1; a <= numTeams; a++ {
+					for b := a + 1; b <= numTeams; b++ {
+						if count := meetings[[2]int{a, b}]; count != 1 {
+							t.Errorf("teams %d and %d meet %d times, want once", a, b, count)
+						}
+					}
+				}
+				if want := numTeams * (numTeams - 1) / 2; len(meetings) != want {
+					t.Errorf("%d pairings, want %d", len(meetings), want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package commands
+
+// This file handles starting and ending seasons, which archive the standings of the players when
+// they end and can move every skill rank back toward the mean for a fresh start
+
+import (
+	"fmt"
+	"time"
+
+	dg "github.com/bwmarrin/discordgo"
+	rsp "github.com/philflip12/spikebot/internal/responder"
+	log "github.com/sirupsen/logrus"
+)
+
+func cmdSeason(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options
+	subCommandName := options[0].Name
+
+	switch subCommandName {
+	case "start":
+		startSeason(session, interaction, data)
+	case "end":
+		endSeason(session, interaction, data)
+	case "show":
+		showSeason(session, interaction, data)
+	case "list":
+		listSeasons(session, interaction, data)
+	}
+}
+
+// getCurrentSeason returns the running season, ok is false if no season is running
+func getCurrentSeason(seasons []Season) (season Season, ok bool) {
+	if len(seasons) == 0 || !seasons[len(seasons)-1].End.IsZero() {
+		return Season{}, false
+	}
+	return seasons[len(seasons)-1], true
+}
+
+func startSeason(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	seasons, err := data.GetSeasons()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	if current, ok := getCurrentSeason(seasons); ok {
+		rsp.InteractionRespondf(session, interaction, "%s is already running, use /season end to finish it first", current.Name)
+		return
+	}
+
+	season := Season{Number: len(seasons) + 1, Start: time.Now()}
+	season.Name = fmt.Sprintf("Season %d", season.Number)
+	for _, option := range interaction.ApplicationCommandData().Options[0].Options {
+		switch option.Name {
+		case "name":
+			season.Name = option.StringValue()
+		}
+	}
+
+	if err := data.SaveSeason(season); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	rsp.InteractionRespondf(session, interaction, "Started %s, results from now on count toward its standings", season.Name)
+}
+
+func endSeason(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	resetPercent := 0
+	for _, option := range interaction.ApplicationCommandData().Options[0].Options {
+		switch option.Name {
+		case "reset":
+			resetPercent = int(option.IntValue())
+		}
+	}
+
+	seasons, err := data.GetSeasons()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	season, ok := getCurrentSeason(seasons)
+	if !ok {
+		rsp.InteractionRespond(session, interaction, "There is no season running, use /season start to begin one")
+		return
+	}
+
+	standings, err := getStandings(data, season.Start)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	season.Standings = sortStandings(standings, leaderboardRating, true)
+	season.End = time.Now()
+	if err := data.SaveSeason(season); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	str := fmt.Sprintf("Ended %s, the final standings are:\n%s", season.Name, getStandingsString(season.Standings, true))
+	if len(season.Standings) == 0 {
+		str = fmt.Sprintf("Ended %s, nobody played during it", season.Name)
+	}
+	if resetPercent > 0 {
+		reason := fmt.Sprintf("%s reset", season.Name)
+		changes, err := data.SoftResetSkills(float64(resetPercent)/100, getSkillEdit(interaction, reason))
+		if err != nil {
+			log.Error(err)
+			rsp.InteractionRespond(session, interaction, err.Error())
+			return
+		}
+		moved := 0
+		for _, change := range changes {
+			if change.Before != change.After {
+				moved++
+			}
+		}
+		str = fmt.Sprintf("%s\nMoved every skill rank %d%% of the way toward the mean, %d changed", str, resetPercent, moved)
+	}
+	rsp.InteractionRespond(session, interaction, str)
+}
+
+func showSeason(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	seasons, err := data.GetSeasons()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	if len(seasons) == 0 {
+		rsp.InteractionRespond(session, interaction, "No seasons have been played, use /season start to begin one")
+		return
+	}
+
+	// the running season is shown unless another is chosen, or else the last one played
+	season := seasons[len(seasons)-1]
+	for _, option := range interaction.ApplicationCommandData().Options[0].Options {
+		switch option.Name {
+		case "number":
+			number := int(option.IntValue())
+			if number > len(seasons) {
+				rsp.InteractionRespondf(session, interaction, "Season numbers must be between 1 and %d", len(seasons))
+				return
+			}
+			season = seasons[number-1]
+		}
+	}
+
+	standings := season.Standings
+	if season.End.IsZero() {
+		standings, err = getStandings(data, season.Start)
+		if err != nil {
+			log.Error(err)
+			rsp.InteractionRespond(session, interaction, err.Error())
+			return
+		}
+		standings = sortStandings(standings, leaderboardRating, true)
+	}
+
+	str := fmt.Sprintf("%s, %s:", season.Name, getSeasonDates(season))
+	if len(standings) == 0 {
+		rsp.InteractionRespondf(session, interaction, "%s\nNobody has played yet", str)
+		return
+	}
+	rsp.InteractionRespondf(session, interaction, "%s\n%s", str, getStandingsString(standings, true))
+}
+
+func listSeasons(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	seasons, err := data.GetSeasons()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	if len(seasons) == 0 {
+		rsp.InteractionRespond(session, interaction, "No seasons have been played, use /season start to begin one")
+		return
+	}
+
+	str := "Seasons:\n```"
+	for _, season := range seasons {
+		str = fmt.Sprintf("%s\n%2d  %s, %s", str, season.Number, season.Name, getSeasonDates(season))
+		if len(season.Standings) > 0 {
+			str = fmt.Sprintf("%s, won by %s", str, season.Standings[0].Name)
+		}
+	}
+	str = fmt.Sprintf("%s\n```", str)
+	rsp.InteractionRespond(session, interaction, str)
+}
+
+// getSeasonDates describes when a season started and ended
+func getSeasonDates(season Season) string {
+	if season.End.IsZero() {
+		return fmt.Sprintf("running since %s", season.Start.Local().Format(dateFmt))
+	}
+	return fmt.Sprintf("%s to %s", season.Start.Local().Format(dateFmt), season.End.Local().Format(dateFmt))
+}
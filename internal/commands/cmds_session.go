@@ -0,0 +1,241 @@
+package commands
+
+// This file handles commands for configuring the playing session, such as its player capacity, and
+// the sign-up messages players use to join it themselves
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	dg "github.com/bwmarrin/discordgo"
+	rsp "github.com/philflip12/spikebot/internal/responder"
+	log "github.com/sirupsen/logrus"
+)
+
+func cmdSession(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options
+	subCommandName := options[0].Name
+
+	switch subCommandName {
+	case "open":
+		openSession(session, interaction, data)
+	case "capacity":
+		setSessionCapacity(session, interaction, data)
+	case "close":
+		closeSession(session, interaction, data)
+	}
+}
+
+const defaultSignUpTitle = "Sign-ups are open!"
+
+const (
+	rsvpPrefix  = "rsvp_"
+	rsvpInID    = rsvpPrefix + "in"
+	rsvpOutID   = rsvpPrefix + "out"
+	rsvpMaybeID = rsvpPrefix + "maybe"
+)
+
+var rsvpButtons = []dg.MessageComponent{dg.ActionsRow{
+	Components: []dg.MessageComponent{dg.Button{
+		Label:    "I'm in",
+		Style:    dg.SuccessButton,
+		CustomID: rsvpInID,
+	}, dg.Button{
+		Label:    "I'm out",
+		Style:    dg.DangerButton,
+		CustomID: rsvpOutID,
+	}, dg.Button{
+		Label:    "Maybe",
+		Style:    dg.SecondaryButton,
+		CustomID: rsvpMaybeID,
+	}},
+}}
+
+// openSession posts a sign-up message with buttons players can use to join or leave the playing
+// group themselves
+func openSession(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options[0].Options
+	title := defaultSignUpTitle
+	if len(options) > 0 {
+		title = options[0].StringValue()
+	}
+
+	roster, err := getRosterString(data, fmt.Sprintf("**%s**", title))
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	err = session.InteractionRespond(interaction.Interaction, &dg.InteractionResponse{
+		Type: dg.InteractionResponseChannelMessageWithSource,
+		Data: &dg.InteractionResponseData{
+			Content:    roster,
+			Components: rsvpButtons,
+		},
+	})
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// onRSVP is called when a user clicks one of the buttons on a sign-up message. The message is
+// updated with the new roster and any players promoted from the waitlist are announced.
+func onRSVP(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	userID := interaction.Member.User.ID
+	if _, err := getUserName(data, interaction.GuildID, userID, session); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	var promoted []string
+	var err error
+	switch interaction.MessageComponentData().CustomID {
+	case rsvpInID:
+		_, err = data.AddPlayingUsers(userID)
+	case rsvpOutID:
+		_, promoted, err = data.RemovePlayingUsers(userID)
+	case rsvpMaybeID:
+		promoted, err = data.MarkPlayingMaybe(userID)
+	}
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	// the first line of a sign-up message is its title
+	title, _, _ := strings.Cut(interaction.Message.Content, "\n")
+	roster, err := getRosterString(data, title)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	err = session.InteractionRespond(interaction.Interaction, &dg.InteractionResponse{
+		Type: dg.InteractionResponseUpdateMessage,
+		Data: &dg.InteractionResponseData{
+			Content:    roster,
+			Components: rsvpButtons,
+		},
+	})
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	waitlistStr, err := getWaitlistChangesString(data, nil, promoted)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if waitlistStr != "" {
+		if _, err := session.ChannelMessageSend(interaction.ChannelID, strings.TrimSpace(waitlistStr)); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// getRosterString lists the playing group, waitlist and maybe list below the title of a sign-up
+// message
+func getRosterString(data *serverData, title string) (string, error) {
+	settings, err := data.GetSettings()
+	if err != nil {
+		return "", err
+	}
+	playing, err := data.GetPlaying()
+	if err != nil {
+		return "", err
+	}
+	waitlist, err := data.GetWaitlist()
+	if err != nil {
+		return "", err
+	}
+	maybe, err := data.GetMaybe()
+	if err != nil {
+		return "", err
+	}
+
+	playingHeader := fmt.Sprintf("In (%d)", len(playing))
+	if settings.MaxPlayers > 0 {
+		playingHeader = fmt.Sprintf("In (%d/%d)", len(playing), settings.MaxPlayers)
+	}
+	str := title
+	str = fmt.Sprintf("%s%s", str, rosterSectionString(playingHeader, playing))
+	if len(waitlist) > 0 {
+		str = fmt.Sprintf("%s%s", str, rosterSectionString(fmt.Sprintf("Waitlist (%d)", len(waitlist)), waitlist))
+	}
+	if len(maybe) > 0 {
+		str = fmt.Sprintf("%s%s", str, rosterSectionString(fmt.Sprintf("Maybe (%d)", len(maybe)), maybe))
+	}
+	return str, nil
+}
+
+func rosterSectionString(header string, players []Player) string {
+	str := fmt.Sprintf("\n\n**%s**", header)
+	for i, player := range players {
+		str = fmt.Sprintf("%s\n%d. %s", str, i+1, player.Name)
+	}
+	return str
+}
+
+func setSessionCapacity(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options[0].Options
+	maxPlayers := int(options[0].IntValue())
+
+	promoted, err := data.SetMaxPlayers(maxPlayers)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	numPlayingStr, err := getNumPlayingString(data)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	waitlistStr, err := getWaitlistChangesString(data, nil, promoted)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	if maxPlayers == 0 {
+		rsp.InteractionRespondf(session, interaction, "Removed the playing group size limit%s%s", numPlayingStr, waitlistStr)
+		return
+	}
+	rsp.InteractionRespondf(session, interaction, "Set the playing group size limit to %d%s%s", maxPlayers, numPlayingStr, waitlistStr)
+}
+
+// closeSession records the attendance of everyone in the playing group. Players already counted
+// for the session, such as when teams were created, are not counted again.
+func closeSession(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	players, err := data.GetPlaying()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	if len(players) == 0 {
+		rsp.InteractionRespond(session, interaction, "The playing group is empty")
+		return
+	}
+
+	userIDs := make([]string, len(players))
+	for i, player := range players {
+		userIDs[i] = player.ID
+	}
+	if err := data.RecordAttendance(userIDs, time.Now()); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	rsp.InteractionRespondf(session, interaction, "Closed the session, recorded the attendance of %d players", len(players))
+}
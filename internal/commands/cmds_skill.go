@@ -5,12 +5,16 @@ package commands
 import (
 	"fmt"
 	"sort"
+	"strconv"
 
 	dg "github.com/bwmarrin/discordgo"
 	rsp "github.com/philflip12/spikebot/internal/responder"
 	log "github.com/sirupsen/logrus"
 )
 
+// format of the timestamps shown in a player's skill history
+const historyTimeFmt = "06-01-02 15:04"
+
 func cmdSkill(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
 	options := interaction.ApplicationCommandData().Options
 	subCommandName := options[0].Name
@@ -26,6 +30,10 @@ func cmdSkill(session *dg.Session, interaction *dg.InteractionCreate, data *serv
 		showSkill(session, interaction, data)
 	case "show_all":
 		showAllSkill(session, interaction, data)
+	case "history":
+		showSkillHistory(session, interaction, data)
+	case "revert":
+		revertSkill(session, interaction, data)
 	case "guest":
 		options = options[0].Options
 		subCommandName := options[0].Name
@@ -38,6 +46,10 @@ func cmdSkill(session *dg.Session, interaction *dg.InteractionCreate, data *serv
 			decreaseGuestSkill(session, interaction, data)
 		case "show":
 			showGuestSkill(session, interaction, data)
+		case "history":
+			showGuestSkillHistory(session, interaction, data)
+		case "revert":
+			revertGuestSkill(session, interaction, data)
 		}
 	}
 }
@@ -47,6 +59,7 @@ func setSkill(session *dg.Session, interaction *dg.InteractionCreate, data *serv
 	// Passing nil to UserValue avoids an extra API query.
 	userID := options[0].UserValue(nil).ID
 	skill := int(options[1].IntValue())
+	edit := getSkillEdit(interaction, getOptionalString(options, 2))
 
 	name, err := getUserName(data, interaction.GuildID, userID, session)
 	if err != nil {
@@ -55,7 +68,7 @@ func setSkill(session *dg.Session, interaction *dg.InteractionCreate, data *serv
 		return
 	}
 
-	if err := data.SetPlayerSkill(userID, skill); err != nil {
+	if err := data.SetPlayerSkill(userID, skill, edit); err != nil {
 		log.Error(err)
 		rsp.InteractionRespond(session, interaction, err.Error())
 		return
@@ -69,6 +82,7 @@ func increaseSkill(session *dg.Session, interaction *dg.InteractionCreate, data
 	// Passing nil to UserValue avoids an extra API query.
 	userID := options[0].UserValue(nil).ID
 	difference := int(options[1].IntValue())
+	edit := getSkillEdit(interaction, getOptionalString(options, 2))
 
 	name, err := getUserName(data, interaction.GuildID, userID, session)
 	if err != nil {
@@ -77,7 +91,7 @@ func increaseSkill(session *dg.Session, interaction *dg.InteractionCreate, data
 		return
 	}
 
-	prevSkill, newSkill, err := data.ModifyPlayerSkill(userID, difference)
+	prevSkill, newSkill, err := data.ModifyPlayerSkill(userID, difference, edit)
 	if err != nil {
 		log.Error(err)
 		rsp.InteractionRespond(session, interaction, err.Error())
@@ -92,6 +106,7 @@ func decreaseSkill(session *dg.Session, interaction *dg.InteractionCreate, data
 	// Passing nil to UserValue avoids an extra API query.
 	userID := options[0].UserValue(nil).ID
 	difference := int(options[1].IntValue())
+	edit := getSkillEdit(interaction, getOptionalString(options, 2))
 
 	name, err := getUserName(data, interaction.GuildID, userID, session)
 	if err != nil {
@@ -100,7 +115,7 @@ func decreaseSkill(session *dg.Session, interaction *dg.InteractionCreate, data
 		return
 	}
 
-	prevSkill, newSkill, err := data.ModifyPlayerSkill(userID, -difference)
+	prevSkill, newSkill, err := data.ModifyPlayerSkill(userID, -difference, edit)
 	if err != nil {
 		log.Error(err)
 		rsp.InteractionRespond(session, interaction, err.Error())
@@ -157,3 +172,70 @@ func showAllSkill(session *dg.Session, interaction *dg.InteractionCreate, data *
 
 	rsp.InteractionRespond(session, interaction, str)
 }
+
+func showSkillHistory(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options[0].Options
+	// Passing nil to UserValue avoids an extra API query.
+	userID := options[0].UserValue(nil).ID
+
+	name, err := getUserName(data, interaction.GuildID, userID, session)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	entries, err := data.GetSkillHistory(userID)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	if len(entries) == 0 {
+		rsp.InteractionRespondf(session, interaction, "\"%s\" has no skill rank changes", name)
+		return
+	}
+	rsp.InteractionRespondf(session, interaction, "Skill rank history of \"%s\":\n%s", name, skillHistoryString(entries))
+}
+
+func revertSkill(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options[0].Options
+	// Passing nil to UserValue avoids an extra API query.
+	userID := options[0].UserValue(nil).ID
+	entryNum := 1
+	if len(options) > 1 {
+		entryNum = int(options[1].IntValue())
+	}
+
+	name, err := getUserName(data, interaction.GuildID, userID, session)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	reverted, err := data.RevertSkillChange(userID, entryNum, getSkillEdit(interaction, revertReason(entryNum)))
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	rsp.InteractionRespondf(session, interaction, "Reverted \"%s\" skill rank change from %d to %d, skill rank is now %d", name, reverted.Before, reverted.After, reverted.Before)
+}
+
+func revertReason(entryNum int) string {
+	return "revert of change " + strconv.Itoa(entryNum)
+}
+
+func skillHistoryString(entries []SkillHistoryEntry) string {
+	str := "```"
+	for i, entry := range entries {
+		str = fmt.Sprintf("%s\n%2d  %s  %2d -> %2d  by %s", str, i+1, entry.Time.Local().Format(historyTimeFmt), entry.Before, entry.After, entry.ActorName)
+		if entry.Reason != "" {
+			str = fmt.Sprintf("%s: %s", str, entry.Reason)
+		}
+	}
+	return fmt.Sprintf("%s\n```", str)
+}
@@ -0,0 +1,72 @@
+package commands
+
+// This file handles showing the attendance and match results recorded for each player
+
+import (
+	"fmt"
+
+	dg "github.com/bwmarrin/discordgo"
+	rsp "github.com/philflip12/spikebot/internal/responder"
+	log "github.com/sirupsen/logrus"
+)
+
+// format of the dates shown in stats and seasons
+const dateFmt = "Jan 2, 2006"
+
+func cmdStats(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options
+	userID, name, err := getMentionedPlayer(session, interaction, data, options[0])
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	players, err := data.GetPlayers()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	stats := players[userID].Stats
+	if stats.Sessions == 0 && stats.Wins+stats.Losses == 0 {
+		rsp.InteractionRespondf(session, interaction, "\"%s\" has not played yet", name)
+		return
+	}
+
+	// a session streak is only still going if the player attended the latest session
+	lastSession := stats.LastPlayed
+	for _, player := range players {
+		if player.Stats.LastPlayed.After(lastSession) {
+			lastSession = player.Stats.LastPlayed
+		}
+	}
+	sessionStreak := stats.SessionStreak
+	if !isSameSession(stats.LastPlayed, lastSession) {
+		sessionStreak = 0
+	}
+
+	str := fmt.Sprintf("Stats of \"%s\":\n```", name)
+	str = fmt.Sprintf("%s\nSessions attended  %d", str, stats.Sessions)
+	if !stats.LastPlayed.IsZero() {
+		str = fmt.Sprintf("%s\nLast played        %s", str, stats.LastPlayed.Local().Format(dateFmt))
+	}
+	str = fmt.Sprintf("%s\nSession streak     %d, longest %d", str, sessionStreak, stats.LongestSessionStreak)
+
+	matches := stats.Wins + stats.Losses
+	str = fmt.Sprintf("%s\nMatches            %d won, %d lost", str, stats.Wins, stats.Losses)
+	if matches > 0 {
+		str = fmt.Sprintf("%s\nWin rate           %.0f%%", str, 100*float64(stats.Wins)/float64(matches))
+	}
+	switch {
+	case stats.MatchStreak > 0:
+		str = fmt.Sprintf("%s\nMatch streak       won %d", str, stats.MatchStreak)
+	case stats.MatchStreak < 0:
+		str = fmt.Sprintf("%s\nMatch streak       lost %d", str, -stats.MatchStreak)
+	}
+	str = fmt.Sprintf("%s\nLongest win streak %d", str, stats.LongestWinStreak)
+	str = fmt.Sprintf("%s\n```", str)
+
+	rsp.InteractionRespond(session, interaction, str)
+}
@@ -3,10 +3,10 @@ package commands
 import (
 	"errors"
 	"fmt"
-	"math/rand"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	dg "github.com/bwmarrin/discordgo"
@@ -14,34 +14,138 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// the default largest allowable skill gap between the strongest and weakest created teams.
-const defaultTeamsMaxSkillGap = float64(1)
+// DefaultTeamsMaxSkillGap is the largest allowable skill gap between the strongest and weakest
+// created teams on servers which do not set their own.
+const DefaultTeamsMaxSkillGap = float64(1)
 const teamGenTimeLimit = 100 * time.Millisecond
 
+// the skill gap worth the same as one repeated teammate pairing for each point of repeat penalty
+const repeatPenaltyScale = 0.1
+
+// TeamsDefaults holds the options /teams create uses on a server when they are not given
+type TeamsDefaults struct {
+	MaxSkillGap      float64
+	RepeatPenalty    int
+	BalancePositions bool
+}
+
+var (
+	teamsDefaults       = map[string]TeamsDefaults{}
+	sharedTeamsDefaults = TeamsDefaults{MaxSkillGap: DefaultTeamsMaxSkillGap}
+)
+
+// SetTeamsDefaults sets the options /teams create uses on the server when they are not given.
+// It should not be called after adding handles which create teams.
+func SetTeamsDefaults(serverID string, defaults TeamsDefaults) {
+	teamsDefaults[serverID] = defaults
+}
+
+// SetSharedTeamsDefaults sets the options /teams create uses on servers without defaults of their
+// own. It should not be called after adding handles which create teams.
+func SetSharedTeamsDefaults(defaults TeamsDefaults) {
+	sharedTeamsDefaults = defaults
+}
+
+// getTeamsDefaults returns the options /teams create uses on the server when they are not given
+func getTeamsDefaults(serverID string) TeamsDefaults {
+	if defaults, ok := teamsDefaults[serverID]; ok {
+		return defaults
+	}
+	return sharedTeamsDefaults
+}
+
+func cmdTeams(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options
+	subCommandName := options[0].Name
+
+	switch subCommandName {
+	case "create":
+		cmdTeamsCreate(session, interaction, data)
+	case "show":
+		showTeams(session, interaction, data)
+	case "history":
+		showTeamsHistory(session, interaction, data)
+	case "swap":
+		swapTeamPlayers(session, interaction, data)
+	case "move":
+		moveTeamPlayer(session, interaction, data)
+	case "lock":
+		lockTeamPlayer(session, interaction, data, true)
+	case "unlock":
+		lockTeamPlayer(session, interaction, data, false)
+	}
+}
+
 func cmdRedoTeams(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
-	numTeams, maxSkillGap, err := getLastTeamsOptions(interaction.GuildID)
+	record, ok, err := getLastTeamsRecord(data)
 	if err != nil {
+		log.Error(err)
 		rsp.InteractionRespond(session, interaction, err.Error())
 		return
 	}
+	if !ok {
+		rsp.InteractionRespond(session, interaction, "teams has not yet been called")
+		return
+	}
 
-	cmdTeamsSubCall(session, interaction, data, numTeams, maxSkillGap)
+	config := record.Config
+	if config.DraftCaptains != nil {
+		startDraft(session, interaction, data, config.NumTeams, config.DraftCaptains)
+		return
+	}
+	cmdTeamsSubCall(session, interaction, data, config, record.getLocked())
 }
 
-func cmdTeams(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
-	options := interaction.ApplicationCommandData().Options
-	numTeams := int(options[0].IntValue())
-	maxSkillGap := defaultTeamsMaxSkillGap
-	if len(options) > 1 {
-		maxSkillGap = float64(options[1].IntValue())
+func cmdTeamsCreate(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	defaults := getTeamsDefaults(interaction.GuildID)
+	config := TeamsConfig{
+		MaxSkillGap:      defaults.MaxSkillGap,
+		RepeatPenalty:    defaults.RepeatPenalty,
+		BalancePositions: defaults.BalancePositions,
+	}
+	for _, option := range interaction.ApplicationCommandData().Options[0].Options {
+		switch option.Name {
+		case "count":
+			config.NumTeams = int(option.IntValue())
+		case "max_skill_gap":
+			config.MaxSkillGap = float64(option.IntValue())
+		case "balance_positions":
+			config.BalancePositions = option.BoolValue()
+		case "repeat_penalty":
+			config.RepeatPenalty = int(option.IntValue())
+		case "sizes":
+			teamSizes, err := parseTeamSizes(option.StringValue())
+			if err != nil {
+				rsp.InteractionRespond(session, interaction, err.Error())
+				return
+			}
+			config.TeamSizes = teamSizes
+		case "max_team_size":
+			config.MaxTeamSize = int(option.IntValue())
+		case "objective":
+			config.Objective = option.StringValue()
+		case "top_count":
+			config.TopCount = int(option.IntValue())
+		}
 	}
 
-	updateLastTeamsOptions(interaction.GuildID, numTeams, maxSkillGap)
+	if err := checkTeamsConfig(config); err != nil {
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
 
-	cmdTeamsSubCall(session, interaction, data, numTeams, maxSkillGap)
+	cmdTeamsSubCall(session, interaction, data, config, nil)
 }
 
-func cmdTeamsSubCall(session *dg.Session, interaction *dg.InteractionCreate, data *serverData, numTeams int, maxSkillGap float64) {
+// cmdTeamsSubCall creates and saves teams. locked holds the index of the team each locked player
+// must stay on, keyed by their userID.
+func cmdTeamsSubCall(
+	session *dg.Session,
+	interaction *dg.InteractionCreate,
+	data *serverData,
+	config TeamsConfig,
+	locked map[string]int,
+) {
 	players, err := data.GetPlaying()
 	if err != nil {
 		log.Error(err)
@@ -49,107 +153,356 @@ func cmdTeamsSubCall(session *dg.Session, interaction *dg.InteractionCreate, dat
 		return
 	}
 
-	if err := validateTeams(data, players, numTeams); err != nil {
+	teamSizes, err := getConfigTeamSizes(len(players), config)
+	if err != nil {
 		rsp.InteractionRespond(session, interaction, err.Error())
 		return
 	}
+	maxSkillGap := getObjectiveMaxSkillGap(config.MaxSkillGap, config.Objective, teamSizes)
 
-	teams := createTeams(players, numTeams, maxSkillGap, teamGenTimeLimit)
+	history, err := data.GetTeamsHistory()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	benchSize := len(players)
+	for _, size := range teamSizes {
+		benchSize -= size
+	}
+	players, bench := getBench(players, benchSize, history, locked)
+
+	if err := validateTeams(data, players, len(teamSizes)); err != nil {
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	constraints, err := data.GetTeamConstraints()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	rosters, err := data.GetRosters()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	teams, err := createTeams(players, constraints, rosters, config, locked, teamGenTimeLimit)
+	if err != nil {
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	for i := range bench {
+		teams.bench = append(teams.bench, &bench[i])
+	}
+	if err := saveTeams(data, teams, config); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
 
 	if teams.skillGap <= maxSkillGap {
 		str := fmt.Sprintf("Teams found:%s", teams.String())
 		rsp.InteractionRespond(session, interaction, str)
+	} else if teams.optimal {
+		str := fmt.Sprintf("No arrangement meets the max %s of %g. Best option:%s", getSkillGapLabel(config.Objective), maxSkillGap, teams.String())
+		rsp.InteractionRespond(session, interaction, str)
 	} else {
 		str := fmt.Sprintf("No valid team. Best option:%s", teams.String())
 		rsp.InteractionRespond(session, interaction, str)
 	}
 }
 
+// createTeams splits the players into teams. An error is returned if the team constraints between
+// the players cannot be met. rosters are the teams of earlier sessions, whose teammate pairings
+// are avoided if config has a repeat penalty. Players in locked stay on the team at their index.
+// Every player is placed on a team, so the bench must already have been left out of players.
 func createTeams(
 	players []Player,
-	numTeams int,
-	maxSkillGap float64,
+	constraints []TeamConstraint,
+	rosters []Roster,
+	config TeamsConfig,
+	locked map[string]int,
 	timeLimit time.Duration,
-) Teams {
-	// put an upper time limit on shuffling for good teams
-	deadline := time.Now().Add(timeLimit)
-
-	// loop variables
-	bestArrangementDiff := float64(100)
-	bestArrangement := make([]int, len(players))
-	bestAverages := make([]float64, numTeams)
-	arrangement := make([]int, len(players))
-	averages := make([]float64, numTeams)
-	for i := range arrangement {
-		arrangement[i] = i
+) (Teams, error) {
+	teamSizes, err := getConfigTeamSizes(len(players), config)
+	if err != nil {
+		return Teams{}, err
 	}
-	teamSizes := make([]int, numTeams)
-	for teamIdx := 0; teamIdx < numTeams; teamIdx++ {
-		if len(players)%numTeams > teamIdx {
-			teamSizes[teamIdx] = len(players)/numTeams + 1
-		} else {
-			teamSizes[teamIdx] = len(players) / numTeams
-		}
+	numTeams := len(teamSizes)
+
+	rules := balanceRules{}
+	if config.BalancePositions {
+		rules.positions = getBalancePositions(players, numTeams)
+	}
+	lockConstraints := getLockConstraints(players, locked)
+	constraints = getPlayingConstraints(players, constraints)
+	rules.together, rules.apart = getConstraintPairs(players, append(slices.Clone(lockConstraints), constraints...))
+
+	maxSkillGap := getObjectiveMaxSkillGap(config.MaxSkillGap, config.Objective, teamSizes)
+	balancer := newBalancer(players, rules, teamSizes, maxSkillGap, timeLimit).
+		withObjective(config.Objective, getTopCount(config, numTeams))
+	repeats := getTeammateRepeats(players, rosters)
+	if config.RepeatPenalty > 0 {
+		balancer.withRepeatPenalty(repeats, float64(config.RepeatPenalty)*repeatPenaltyScale)
+	}
+	assignment, skillGap, optimal := balancer.balance()
+	if assignment == nil {
+		return Teams{}, getInfeasibleError(players, lockConstraints, constraints, rules, teamSizes, optimal, timeLimit)
 	}
 
-	// shuffle until time runs our or a good solution is found
-	for {
-		rand.Shuffle(len(arrangement), func(i, j int) {
-			arrangement[i], arrangement[j] = arrangement[j], arrangement[i]
+	teams := Teams{
+		skillGap:    skillGap,
+		optimal:     optimal,
+		teams:       make([]*Team, numTeams),
+		objective:   getObjective(config),
+		topCount:    getTopCount(config, numTeams),
+		showMetrics: true,
+	}
+	if config.RepeatPenalty > 0 {
+		teams.showRepeats = true
+		for i := range players {
+			for j := i + 1; j < len(players); j++ {
+				if assignment[i] == assignment[j] {
+					teams.repeats += repeats[i][j]
+				}
+			}
+		}
+	}
+	if rules.positions != nil {
+		teams.positions = make(map[string]string, len(players))
+		for playerIdx, position := range rules.positions {
+			if position >= 0 {
+				teams.positions[players[playerIdx].ID] = positionNames[position]
+			}
+		}
+	}
+	sums := make([]int, numTeams)
+	for teamIdx := range teams.teams {
+		teams.teams[teamIdx] = &Team{players: make([]*Player, 0, teamSizes[teamIdx])}
+	}
+	for playerIdx, teamIdx := range assignment {
+		team := teams.teams[teamIdx]
+		team.players = append(team.players, &players[playerIdx])
+		sums[teamIdx] += players[playerIdx].Skill
+	}
+	for teamIdx, team := range teams.teams {
+		team.skill = float64(sums[teamIdx]) / float64(teamSizes[teamIdx])
+		sort.SliceStable(team.players, func(i, j int) bool {
+			return team.players[i].Skill > team.players[j].Skill
 		})
-
-		maxAverage := float64(0)
-		minAverage := float64(99)
-		playerIdx := 0
-		for teamIdx := 0; teamIdx < numTeams; teamIdx++ {
-			sum := 0
-			for teammateIdx := 0; teammateIdx < teamSizes[teamIdx]; teammateIdx++ {
-				sum += players[arrangement[playerIdx]].Skill
-				playerIdx++
+	}
+	// teams of the sizes given explicitly are listed from largest to smallest, since only teams of
+	// similar sizes play each other
+	sort.SliceStable(teams.teams, func(i, j int) bool {
+		sizeI, sizeJ := len(teams.teams[i].players), len(teams.teams[j].players)
+		if config.TeamSizes != nil && sizeI != sizeJ {
+			return sizeI > sizeJ
+		}
+		return teams.teams[i].skill > teams.teams[j].skill
+	})
+	if len(locked) > 0 {
+		teams.teams = arrangeLockedTeams(teams.teams, locked)
+		teams.locked = make(map[string]bool, len(locked))
+		for _, player := range players {
+			if _, ok := locked[player.ID]; ok {
+				teams.locked[player.ID] = true
 			}
-			average := float64(sum) / float64(teamSizes[teamIdx])
-			averages[teamIdx] = average
-			if average > float64(maxAverage) {
-				maxAverage = average
+		}
+	}
+
+	return teams, nil
+}
+
+// getLockConstraints returns constraints which keep the playing locked players together with those
+// locked to the same team, and apart from those locked to other teams
+func getLockConstraints(players []Player, locked map[string]int) []TeamConstraint {
+	var constraints []TeamConstraint
+	// the first playing player locked to each team
+	firstLocked := map[int]string{}
+	for _, player := range players {
+		teamIdx, ok := locked[player.ID]
+		if !ok {
+			continue
+		}
+		if first, ok := firstLocked[teamIdx]; ok {
+			constraints = append(constraints, TeamConstraint{Kind: constraintTogether, UserIDs: [2]string{first, player.ID}})
+			continue
+		}
+		for _, first := range firstLocked {
+			constraints = append(constraints, TeamConstraint{Kind: constraintApart, UserIDs: [2]string{first, player.ID}})
+		}
+		firstLocked[teamIdx] = player.ID
+	}
+	return constraints
+}
+
+// arrangeLockedTeams moves the teams with locked players to the index they are locked to, keeping
+// the order of the other teams
+func arrangeLockedTeams(teams []*Team, locked map[string]int) []*Team {
+	arranged := make([]*Team, len(teams))
+	unlocked := make([]*Team, 0, len(teams))
+	for _, team := range teams {
+		teamIdx := -1
+		for _, player := range team.players {
+			if idx, ok := locked[player.ID]; ok {
+				teamIdx = idx
+				break
 			}
-			if average < minAverage {
-				minAverage = average
+		}
+		if teamIdx >= 0 && teamIdx < len(arranged) && arranged[teamIdx] == nil {
+			arranged[teamIdx] = team
+		} else {
+			unlocked = append(unlocked, team)
+		}
+	}
+	for teamIdx := range arranged {
+		if arranged[teamIdx] == nil {
+			arranged[teamIdx] = unlocked[0]
+			unlocked = unlocked[1:]
+		}
+	}
+	return arranged
+}
+
+// getTeammateRepeats returns the number of rosters in which each pair of players were teammates,
+// indexed by the player list
+func getTeammateRepeats(players []Player, rosters []Roster) [][]int {
+	index := make(map[string]int, len(players))
+	repeats := make([][]int, len(players))
+	for i, player := range players {
+		index[player.ID] = i
+		repeats[i] = make([]int, len(players))
+	}
+	for _, roster := range rosters {
+		for _, team := range roster.Teams {
+			for a, userIDA := range team {
+				for _, userIDB := range team[a+1:] {
+					i, okA := index[userIDA]
+					j, okB := index[userIDB]
+					if okA && okB {
+						repeats[i][j]++
+						repeats[j][i]++
+					}
+				}
 			}
 		}
-		averageDiff := maxAverage - minAverage
-		if averageDiff < bestArrangementDiff {
-			bestArrangementDiff = averageDiff
-			copy(bestArrangement, arrangement)
-			copy(bestAverages, averages)
+	}
+	return repeats
+}
+
+// parseTeamSizes parses a comma separated list of team sizes, such as "6,6,4,4"
+func parseTeamSizes(str string) ([]int, error) {
+	fields := strings.Split(str, ",")
+	teamSizes := make([]int, len(fields))
+	for i, field := range fields {
+		size, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || size < 1 {
+			return nil, fmt.Errorf("\"%s\" is not a valid team size, sizes must be whole numbers separated by commas", strings.TrimSpace(field))
+		}
+		teamSizes[i] = size
+	}
+	if len(teamSizes) < 2 {
+		return nil, errors.New("at least 2 team sizes must be given")
+	}
+	return teamSizes, nil
+}
+
+// checkTeamsConfig ensures that the options given to /teams create describe the teams exactly once
+func checkTeamsConfig(config TeamsConfig) error {
+	if config.TeamSizes != nil && config.MaxTeamSize > 0 {
+		return errors.New("sizes and max_team_size cannot both be given")
+	}
+	if config.TeamSizes != nil && config.NumTeams > 0 && config.NumTeams != len(config.TeamSizes) {
+		return fmt.Errorf("%d team sizes were given for %d teams", len(config.TeamSizes), config.NumTeams)
+	}
+	if config.NumTeams == 0 && config.TeamSizes == nil && config.MaxTeamSize == 0 {
+		return errors.New("one of count, sizes or max_team_size must be given")
+	}
+	return nil
+}
+
+// getConfigTeamSizes returns the size of each team created from the players. The sizes add up to at
+// most numPlayers, and any players left over sit out on the bench.
+func getConfigTeamSizes(numPlayers int, config TeamsConfig) ([]int, error) {
+	if config.TeamSizes != nil {
+		total := 0
+		for _, size := range config.TeamSizes {
+			total += size
 		}
-		if averageDiff <= maxSkillGap {
-			break
+		if total > numPlayers {
+			return nil, fmt.Errorf("%d players not enough to make teams of %d players in total", numPlayers, total)
 		}
-		if time.Until(deadline) < 0 {
-			break
+		return slices.Clone(config.TeamSizes), nil
+	}
+
+	numTeams := config.NumTeams
+	if config.MaxTeamSize > 0 {
+		if numTeams == 0 {
+			numTeams = max(2, (numPlayers+config.MaxTeamSize-1)/config.MaxTeamSize)
 		}
+		numPlayers = min(numPlayers, numTeams*config.MaxTeamSize)
 	}
+	if numPlayers < numTeams {
+		return nil, fmt.Errorf("%d players not enough to make %d teams", numPlayers, numTeams)
+	}
+	return getTeamSizes(numPlayers, numTeams), nil
+}
 
-	playerIdx := 0
-	teams := Teams{
-		skillGap: bestArrangementDiff,
-		teams:    make([]*Team, numTeams),
+// getBench picks the players who sit out when there are more players than room on the teams. The
+// players who sat out in the fewest of the remembered teams sit out first, then those who joined
+// the playing group last. Locked players never sit out.
+func getBench(players []Player, benchSize int, history []TeamsRecord, locked map[string]int) (playing, bench []Player) {
+	if benchSize <= 0 {
+		return players, nil
 	}
-	for teamIdx := 0; teamIdx < numTeams; teamIdx++ {
-		team := &Team{}
-		team.skill = bestAverages[teamIdx]
-		team.players = make([]*Player, teamSizes[teamIdx])
-		for teammateIdx := 0; teammateIdx < teamSizes[teamIdx]; teammateIdx++ {
-			team.players[teammateIdx] = &players[bestArrangement[playerIdx]]
-			playerIdx++
+
+	benched := map[string]int{}
+	for _, record := range history {
+		for _, player := range record.Bench {
+			benched[player.ID]++
 		}
-		teams.teams[teamIdx] = team
 	}
-	sort.Slice(teams.teams, func(i, j int) bool {
-		return teams.teams[i].skill > teams.teams[j].skill
+
+	candidates := make([]int, 0, len(players))
+	for i := len(players) - 1; i >= 0; i-- {
+		if _, ok := locked[players[i].ID]; !ok {
+			candidates = append(candidates, i)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return benched[players[candidates[i]].ID] < benched[players[candidates[j]].ID]
 	})
 
-	return teams
+	sitting := make(map[int]bool, benchSize)
+	for _, i := range candidates[:min(benchSize, len(candidates))] {
+		sitting[i] = true
+	}
+	for i, player := range players {
+		if sitting[i] {
+			bench = append(bench, player)
+		} else {
+			playing = append(playing, player)
+		}
+	}
+	return playing, bench
+}
+
+// getTeamSizes splits the players as evenly as possible, with the larger teams first
+func getTeamSizes(numPlayers, numTeams int) []int {
+	teamSizes := make([]int, numTeams)
+	for teamIdx := 0; teamIdx < numTeams; teamIdx++ {
+		if numPlayers%numTeams > teamIdx {
+			teamSizes[teamIdx] = numPlayers/numTeams + 1
+		} else {
+			teamSizes[teamIdx] = numPlayers / numTeams
+		}
+	}
+	return teamSizes
 }
 
 type Team struct {
@@ -159,7 +512,23 @@ type Team struct {
 
 type Teams struct {
 	skillGap float64
-	teams    []*Team
+	// whether no arrangement of the players could have a smaller skill gap
+	optimal bool
+	teams   []*Team
+	// the position each player was balanced as keyed by their ID, nil if positions were not balanced
+	positions map[string]string
+	// the number of teammate pairings repeated from earlier sessions, shown if they were avoided
+	repeats     int
+	showRepeats bool
+	// the userIDs of the players who stay on their team when the teams are created again
+	locked map[string]bool
+	// the players who sit out because the teams are full
+	bench []*Player
+	// the objective the teams were balanced by, "" if they were not balanced automatically
+	objective string
+	// the number of strongest players whose split between the teams is shown
+	topCount    int
+	showMetrics bool
 }
 
 func (teams *Teams) String() string {
@@ -171,59 +540,327 @@ func (teams *Teams) String() string {
 			}
 		}
 	}
+	for _, player := range teams.bench {
+		longestName = max(longestName, len(player.Name))
+	}
 
 	teamsStr := "```"
 	for teamIdx, team := range teams.teams {
 		teamsStr = fmt.Sprintf("%s\nTeam %d %s %.2f", teamsStr, teamIdx+1, strings.Repeat(".", longestName+1), team.skill)
 		for _, teammate := range team.players {
-			teamsStr = fmt.Sprintf("%s\n\t%s%s  %d", teamsStr, teammate.Name, strings.Repeat(" ", longestName-len(teammate.Name)), teammate.Skill)
+			teamsStr = fmt.Sprintf("%s\n\t%s%s  %2d", teamsStr, teammate.Name, strings.Repeat(" ", longestName-len(teammate.Name)), teammate.Skill)
+			if position, ok := teams.positions[teammate.ID]; ok {
+				teamsStr = fmt.Sprintf("%s  %s", teamsStr, position)
+			}
+			if teams.locked[teammate.ID] {
+				teamsStr = fmt.Sprintf("%s  locked", teamsStr)
+			}
+		}
+	}
+	if len(teams.bench) > 0 {
+		teamsStr = fmt.Sprintf("%s\nBench", teamsStr)
+		for _, player := range teams.bench {
+			teamsStr = fmt.Sprintf("%s\n\t%s%s  %2d", teamsStr, player.Name, strings.Repeat(" ", longestName-len(player.Name)), player.Skill)
 		}
 	}
 	teamsStr = fmt.Sprintf("%s\n```", teamsStr)
+	if teams.showRepeats {
+		teamsStr = fmt.Sprintf("%s\nRepeated teammate pairings: %d", teamsStr, teams.repeats)
+	}
+	if teams.showMetrics {
+		teamsStr = fmt.Sprintf("%s\n%s", teamsStr, teams.metricsString())
+	}
 	return teamsStr
 }
 
-var lastTeamsOptions map[string]*teamsOptions
+// metricsString describes how balanced the teams are by the measure of each objective, with the
+// objective the teams were balanced by in bold
+func (teams *Teams) metricsString() string {
+	numTeams := len(teams.teams)
+	sizes := make([]int, numTeams)
+	averages := make([]float64, numTeams)
+	totals := make([]float64, numTeams)
+	spreads := make([]float64, numTeams)
+	allSkills := []int{}
+	for teamIdx, team := range teams.teams {
+		skills := make([]int, len(team.players))
+		for playerIdx, player := range team.players {
+			skills[playerIdx] = player.Skill
+			totals[teamIdx] += float64(player.Skill)
+		}
+		allSkills = append(allSkills, skills...)
+		sizes[teamIdx] = len(skills)
+		if len(skills) > 0 {
+			averages[teamIdx] = totals[teamIdx] / float64(len(skills))
+		}
+		spreads[teamIdx] = getSkillSpread(skills)
+	}
+	if len(allSkills) == 0 {
+		return ""
+	}
+
+	// players tied with the weakest of the strongest players also count as one of them
+	threshold := getTopThreshold(allSkills, teams.topCount)
+	topCounts := make([]string, numTeams)
+	numTop := 0
+	for teamIdx, team := range teams.teams {
+		count := 0
+		for _, player := range team.players {
+			if player.Skill >= threshold {
+				count++
+			}
+		}
+		topCounts[teamIdx] = strconv.Itoa(count)
+		numTop += count
+	}
+
+	metrics := []struct {
+		objective string
+		str       string
+	}{
+		{objectiveAverage, fmt.Sprintf("average gap %.2f", getSkillGap(averages, sizes))},
+		{objectiveTotal, fmt.Sprintf("total gap %g", getSkillGap(totals, sizes))},
+		{objectiveVariance, fmt.Sprintf("spread gap %.2f", getSkillGap(spreads, sizes))},
+		{objectiveTop, fmt.Sprintf("top %d split %s", numTop, strings.Join(topCounts, "/"))},
+	}
+	str := "Metrics:"
+	for i, metric := range metrics {
+		if i > 0 {
+			str = fmt.Sprintf("%s,", str)
+		}
+		if metric.objective == teams.objective {
+			str = fmt.Sprintf("%s **%s**", str, metric.str)
+		} else {
+			str = fmt.Sprintf("%s %s", str, metric.str)
+		}
+	}
+	return str
+}
+
+// getObjective returns the objective teams created with the config are balanced by, "" if they
+// were drafted
+func getObjective(config TeamsConfig) string {
+	if config.DraftCaptains != nil {
+		return ""
+	}
+	if config.Objective == "" {
+		return objectiveAverage
+	}
+	return config.Objective
+}
+
+// getTopCount returns the number of strongest players split evenly between the teams, one per team
+// unless the config gives a count
+func getTopCount(config TeamsConfig, numTeams int) int {
+	if config.TopCount > 0 {
+		return config.TopCount
+	}
+	return numTeams
+}
+
+// saveTeams remembers the teams so that they can be shown again, matches between them can be
+// reported, and their teammate pairings can be avoided in later sessions
+func saveTeams(data *serverData, teams Teams, config TeamsConfig) error {
+	record := teams.record(config, time.Now())
+	if err := data.SaveTeams(record); err != nil {
+		return err
+	}
+	if err := data.SaveRoster(Roster{Time: record.Time, Teams: record.teamIDs()}); err != nil {
+		return err
+	}
+	// everyone in the playing group attended the session, including those on the bench
+	attending := []string{}
+	for _, team := range record.teamIDs() {
+		attending = append(attending, team...)
+	}
+	for _, player := range record.Bench {
+		attending = append(attending, player.ID)
+	}
+	return data.RecordAttendance(attending, record.Time)
+}
+
+// getLastTeamsRecord returns the most recently generated teams, ok is false if none are remembered
+func getLastTeamsRecord(data *serverData) (record TeamsRecord, ok bool, err error) {
+	history, err := data.GetTeamsHistory()
+	if err != nil || len(history) == 0 {
+		return TeamsRecord{}, false, err
+	}
+	return history[0], true, nil
+}
 
-func setLastTeamsOptionsServerIDs(serverIDs []string) {
-	lastTeamsOptions = make(map[string]*teamsOptions, len(serverIDs))
-	for _, serverID := range serverIDs {
-		lastTeamsOptions[serverID] = &teamsOptions{}
+// record returns the teams as they are displayed, for saving
+func (teams *Teams) record(config TeamsConfig, createdAt time.Time) TeamsRecord {
+	record := TeamsRecord{
+		Time:     createdAt,
+		Config:   config,
+		SkillGap: teams.skillGap,
+		Optimal:  teams.optimal,
+		Repeats:  teams.repeats,
+		Teams:    make([][]TeamsRecordPlayer, len(teams.teams)),
 	}
+	for teamIdx, team := range teams.teams {
+		record.Teams[teamIdx] = make([]TeamsRecordPlayer, len(team.players))
+		for playerIdx, player := range team.players {
+			record.Teams[teamIdx][playerIdx] = TeamsRecordPlayer{
+				ID:       player.ID,
+				Name:     player.Name,
+				Skill:    player.Skill,
+				Position: teams.positions[player.ID],
+				Locked:   teams.locked[player.ID],
+			}
+		}
+	}
+	for _, player := range teams.bench {
+		record.Bench = append(record.Bench, TeamsRecordPlayer{ID: player.ID, Name: player.Name, Skill: player.Skill})
+	}
+	return record
 }
 
-type teamsOptions struct {
-	mutex       sync.Mutex
-	isSet       bool
-	numTeams    int
-	maxSkillGap float64
+// getRecordTeams returns the saved teams in the form they were displayed in
+func getRecordTeams(record TeamsRecord) Teams {
+	teams := Teams{
+		skillGap:    record.SkillGap,
+		optimal:     record.Optimal,
+		teams:       make([]*Team, len(record.Teams)),
+		repeats:     record.Repeats,
+		showRepeats: record.Config.RepeatPenalty > 0,
+		objective:   getObjective(record.Config),
+		topCount:    getTopCount(record.Config, len(record.Teams)),
+		showMetrics: true,
+		locked:      map[string]bool{},
+	}
+	if record.Config.BalancePositions {
+		teams.positions = map[string]string{}
+	}
+	for teamIdx, members := range record.Teams {
+		team := &Team{players: make([]*Player, len(members))}
+		sum := 0
+		for playerIdx, member := range members {
+			team.players[playerIdx] = &Player{ID: member.ID, Name: member.Name, Skill: member.Skill}
+			sum += member.Skill
+			if teams.positions != nil && member.Position != "" {
+				teams.positions[member.ID] = member.Position
+			}
+			if member.Locked {
+				teams.locked[member.ID] = true
+			}
+		}
+		if len(members) > 0 {
+			team.skill = float64(sum) / float64(len(members))
+		}
+		teams.teams[teamIdx] = team
+	}
+	for _, player := range record.Bench {
+		teams.bench = append(teams.bench, &Player{ID: player.ID, Name: player.Name, Skill: player.Skill})
+	}
+	return teams
 }
 
-func updateLastTeamsOptions(guildID string, numTeams int, maxSkillGap float64) {
-	options := lastTeamsOptions[guildID]
-	options.mutex.Lock()
-	options.updateOptions(numTeams, maxSkillGap)
-	options.mutex.Unlock()
+// teamIDs returns the userIDs of each team in the order they were displayed
+func (record TeamsRecord) teamIDs() [][]string {
+	teamIDs := make([][]string, len(record.Teams))
+	for teamIdx, team := range record.Teams {
+		teamIDs[teamIdx] = make([]string, len(team))
+		for playerIdx, player := range team {
+			teamIDs[teamIdx][playerIdx] = player.ID
+		}
+	}
+	return teamIDs
 }
 
-func getLastTeamsOptions(guildID string) (numTeams int, maxSkillGap float64, err error) {
-	options := lastTeamsOptions[guildID]
-	options.mutex.Lock()
-	defer options.mutex.Unlock()
-	return options.getOptions()
+// getLocked returns the index of the team each locked player is on, keyed by their userID
+func (record TeamsRecord) getLocked() map[string]int {
+	locked := map[string]int{}
+	for teamIdx, team := range record.Teams {
+		for _, player := range team {
+			if player.Locked {
+				locked[player.ID] = teamIdx
+			}
+		}
+	}
+	return locked
 }
 
-func (t *teamsOptions) updateOptions(numTeams int, maxSkillGap float64) {
-	t.isSet = true
-	t.numTeams = numTeams
-	t.maxSkillGap = maxSkillGap
+func showTeams(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	entryNum := 1
+	if options := interaction.ApplicationCommandData().Options[0].Options; len(options) > 0 {
+		entryNum = int(options[0].IntValue())
+	}
+
+	history, err := data.GetTeamsHistory()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	if len(history) == 0 {
+		rsp.InteractionRespond(session, interaction, "teams has not yet been called")
+		return
+	}
+	if entryNum > len(history) {
+		rsp.InteractionRespondf(session, interaction, "Entry number must be between 1 and %d", len(history))
+		return
+	}
+
+	record := history[entryNum-1]
+	teams := getRecordTeams(record)
+	rsp.InteractionRespondf(session, interaction, "Teams created <t:%d:R>:%s", record.Time.Unix(), teams.String())
+}
+
+func showTeamsHistory(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	history, err := data.GetTeamsHistory()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	if len(history) == 0 {
+		rsp.InteractionRespond(session, interaction, "teams has not yet been called")
+		return
+	}
+
+	str := "Recently Created Teams:\n```"
+	for i, record := range history {
+		str = fmt.Sprintf("%s\n%2d  %s  %s %.2f  %s", str, i+1, record.Time.Local().Format(historyTimeFmt), getSkillGapLabel(record.Config.Objective), record.SkillGap, getTeamsConfigString(record))
+	}
+	str = fmt.Sprintf("%s\n```", str)
+
+	rsp.InteractionRespond(session, interaction, str)
 }
 
-func (t *teamsOptions) getOptions() (numTeams int, maxSkillGap float64, err error) {
-	if !t.isSet {
-		return 0, 0, errors.New("teams has not yet been called")
+// getTeamsConfigString describes how a set of teams was created, such as "3 teams, max gap 1"
+func getTeamsConfigString(record TeamsRecord) string {
+	config := record.Config
+	if config.DraftCaptains != nil {
+		return fmt.Sprintf("%d teams, drafted", len(record.Teams))
+	}
+	str := fmt.Sprintf("%d teams, max gap %g", len(record.Teams), config.MaxSkillGap)
+	if config.TeamSizes != nil {
+		sizes := make([]string, len(config.TeamSizes))
+		for i, size := range config.TeamSizes {
+			sizes[i] = strconv.Itoa(size)
+		}
+		str = fmt.Sprintf("%s, sizes %s", str, strings.Join(sizes, ","))
+	}
+	if config.MaxTeamSize > 0 {
+		str = fmt.Sprintf("%s, max size %d", str, config.MaxTeamSize)
+	}
+	if config.Objective != "" && config.Objective != objectiveAverage {
+		str = fmt.Sprintf("%s, objective %s", str, config.Objective)
+	}
+	if config.TopCount > 0 {
+		str = fmt.Sprintf("%s, top %d", str, config.TopCount)
+	}
+	if len(record.Bench) > 0 {
+		str = fmt.Sprintf("%s, %d benched", str, len(record.Bench))
+	}
+	if config.BalancePositions {
+		str = fmt.Sprintf("%s, positions balanced", str)
+	}
+	if config.RepeatPenalty > 0 {
+		str = fmt.Sprintf("%s, repeat penalty %d", str, config.RepeatPenalty)
 	}
-	return t.numTeams, t.maxSkillGap, nil
+	return str
 }
 
 // Ensure that all playing users have a skill rank set and have signed if required
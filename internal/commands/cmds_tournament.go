@@ -0,0 +1,293 @@
+package commands
+
+// This file handles running a tournament between the last created teams, recording the results of
+// its matches and showing the state of the bracket
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	dg "github.com/bwmarrin/discordgo"
+	rsp "github.com/philflip12/spikebot/internal/responder"
+	log "github.com/sirupsen/logrus"
+)
+
+// the defaults for pool play when the options are not given
+const (
+	defaultTournamentPools   = 2
+	defaultTournamentAdvance = 2
+)
+
+func cmdTournament(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	options := interaction.ApplicationCommandData().Options
+	subCommandName := options[0].Name
+
+	switch subCommandName {
+	case "create":
+		createTournament(session, interaction, data)
+	case "report":
+		reportTournamentMatch(session, interaction, data)
+	case "show":
+		showTournament(session, interaction, data)
+	case "cancel":
+		cancelTournament(session, interaction, data)
+	}
+}
+
+func createTournament(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	var format string
+	numPools := defaultTournamentPools
+	advance := defaultTournamentAdvance
+	for _, option := range interaction.ApplicationCommandData().Options[0].Options {
+		switch option.Name {
+		case "format":
+			format = option.StringValue()
+		case "pools":
+			numPools = int(option.IntValue())
+		case "advance":
+			advance = int(option.IntValue())
+		}
+	}
+
+	record, ok, err := getLastTeamsRecord(data)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	if !ok {
+		rsp.InteractionRespond(session, interaction, "teams has not yet been called")
+		return
+	}
+	if len(record.Teams) < 2 {
+		rsp.InteractionRespond(session, interaction, "A tournament needs at least 2 teams")
+		return
+	}
+
+	// the strongest team is the top seed
+	teams := getRecordTeams(record)
+	entrants := make([]TournamentEntrant, len(teams.teams))
+	for teamIdx, team := range teams.teams {
+		entrants[teamIdx] = TournamentEntrant{TeamNumber: teamIdx + 1, Skill: team.skill}
+		for _, player := range team.players {
+			entrants[teamIdx].Players = append(entrants[teamIdx].Players, player.Name)
+		}
+	}
+	sort.SliceStable(entrants, func(i, j int) bool {
+		return entrants[i].Skill > entrants[j].Skill
+	})
+
+	tournament := newTournament(format, entrants, numPools, advance)
+	if err := data.SaveTournament(tournament); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	rsp.InteractionRespond(session, interaction, getTournamentString(tournament))
+}
+
+// getCurrentTournament returns the saved tournament, responding to the interaction if there is none
+func getCurrentTournament(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) (Tournament, bool) {
+	tournament, ok, err := data.GetTournament()
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return Tournament{}, false
+	}
+	if !ok {
+		rsp.InteractionRespond(session, interaction, "There is no tournament, use /tournament create to start one")
+		return Tournament{}, false
+	}
+	return tournament, true
+}
+
+func reportTournamentMatch(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	var matchNum, winnerTeam int
+	var scores [2]int
+	for _, option := range interaction.ApplicationCommandData().Options[0].Options {
+		switch option.Name {
+		case "match":
+			matchNum = int(option.IntValue())
+		case "winner":
+			winnerTeam = int(option.IntValue())
+		case "winner_score":
+			scores[0] = int(option.IntValue())
+		case "loser_score":
+			scores[1] = int(option.IntValue())
+		}
+	}
+	if scores[0] < scores[1] {
+		rsp.InteractionRespond(session, interaction, "The winner's score cannot be less than the loser's score")
+		return
+	}
+
+	tournament, ok := getCurrentTournament(session, interaction, data)
+	if !ok {
+		return
+	}
+
+	if matchNum > len(tournament.Matches) {
+		rsp.InteractionRespondf(session, interaction, "Match numbers must be between 1 and %d", len(tournament.Matches))
+		return
+	}
+	match := &tournament.Matches[matchNum-1]
+	if match.Winner != tournamentTBD {
+		rsp.InteractionRespondf(session, interaction, "Match %d has already been decided", matchNum)
+		return
+	}
+	if !match.isReady() {
+		rsp.InteractionRespondf(session, interaction, "Match %d cannot be played until the matches before it are decided", matchNum)
+		return
+	}
+	winnerSide := -1
+	for side, entrant := range match.Entrants {
+		if tournament.Entrants[entrant].TeamNumber == winnerTeam {
+			winnerSide = side
+		}
+	}
+	if winnerSide == -1 {
+		rsp.InteractionRespondf(session, interaction, "Team %d is not playing in match %d", winnerTeam, matchNum)
+		return
+	}
+
+	match.Winner = match.Entrants[winnerSide]
+	match.Scores[winnerSide], match.Scores[1-winnerSide] = scores[0], scores[1]
+	tournament.resolve()
+
+	if err := data.SaveTournament(tournament); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+
+	str := fmt.Sprintf("Team %d won match %d", winnerTeam, matchNum)
+	if champion, ok := tournament.getChampion(); ok {
+		str = fmt.Sprintf("%s, %s are the champions!", str, getEntrantNames(tournament.Entrants[champion]))
+	}
+	rsp.InteractionRespondf(session, interaction, "%s\n%s", str, getTournamentString(tournament))
+}
+
+func showTournament(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	tournament, ok := getCurrentTournament(session, interaction, data)
+	if !ok {
+		return
+	}
+	rsp.InteractionRespond(session, interaction, getTournamentString(tournament))
+}
+
+func cancelTournament(session *dg.Session, interaction *dg.InteractionCreate, data *serverData) {
+	if _, ok := getCurrentTournament(session, interaction, data); !ok {
+		return
+	}
+	if err := data.SaveTournament(Tournament{}); err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(session, interaction, err.Error())
+		return
+	}
+	rsp.InteractionRespond(session, interaction, "Cancelled the tournament")
+}
+
+// getTournamentString returns the seeds, the pool standings and every match of the tournament,
+// grouped by bracket and round
+func getTournamentString(t Tournament) string {
+	format := "Single elimination"
+	switch t.Format {
+	case tournamentDouble:
+		format = "Double elimination"
+	case tournamentPools:
+		format = "Pool play"
+	}
+	str := fmt.Sprintf("%s, %d teams:\n```\nSeeds", format, len(t.Entrants))
+	for seed, entrant := range t.Entrants {
+		str = fmt.Sprintf("%s\n %2d  %s", str, seed+1, getEntrantNames(entrant))
+	}
+
+	if t.Format == tournamentPools {
+		for poolIdx, standings := range t.getPoolStandings() {
+			str = fmt.Sprintf("%s\n\nPool %c, top %d advance", str, 'A'+poolIdx, t.Advance)
+			for _, standing := range standings {
+				str = fmt.Sprintf("%s\n  [%d] Team %-3d %d-%d  %+d", str, standing.Entrant+1, t.Entrants[standing.Entrant].TeamNumber, standing.Wins, standing.Losses, standing.PointDiff)
+			}
+		}
+	}
+
+	heading := ""
+	for matchIdx, match := range t.Matches {
+		// matches between two byes are never played
+		if match.Entrants[0] == tournamentBye && match.Entrants[1] == tournamentBye {
+			continue
+		}
+		if h := getMatchHeading(t, match); h != heading {
+			heading = h
+			str = fmt.Sprintf("%s\n\n%s", str, heading)
+		}
+		str = fmt.Sprintf("%s\n  M%-3d %-12s vs %-12s", str, matchIdx+1, getMatchSide(t, match, 0), getMatchSide(t, match, 1))
+		switch {
+		case match.Winner >= 0 && match.loser() == tournamentBye:
+			str = fmt.Sprintf("%s  bye", str)
+		case match.Winner >= 0:
+			str = fmt.Sprintf("%s  Team %d won", str, t.Entrants[match.Winner].TeamNumber)
+			if match.Scores != [2]int{} {
+				winnerSide := 0
+				if match.Winner == match.Entrants[1] {
+					winnerSide = 1
+				}
+				str = fmt.Sprintf("%s %d-%d", str, match.Scores[winnerSide], match.Scores[1-winnerSide])
+			}
+		case match.isReady():
+			str = fmt.Sprintf("%s  ready", str)
+		}
+	}
+	str = fmt.Sprintf("%s\n```", str)
+
+	if champion, ok := t.getChampion(); ok {
+		str = fmt.Sprintf("%s\nChampions: %s", str, getEntrantNames(t.Entrants[champion]))
+	} else if t.Format == tournamentPools && t.Final == -1 {
+		str = fmt.Sprintf("%s\nThe bracket is created once every pool match is decided", str)
+	}
+	return str
+}
+
+// getMatchHeading names the bracket and round of a match
+func getMatchHeading(t Tournament, match TournamentMatch) string {
+	switch match.Bracket {
+	case bracketPool:
+		return fmt.Sprintf("Pool %c round %d", 'A'+match.Pool, match.Round)
+	case bracketLosers:
+		return fmt.Sprintf("Losers bracket round %d", match.Round)
+	case bracketFinal:
+		if match.Round > 1 {
+			return "Grand final reset"
+		}
+		return "Grand final"
+	default:
+		if t.Format == tournamentDouble {
+			return fmt.Sprintf("Winners bracket round %d", match.Round)
+		}
+		return fmt.Sprintf("Bracket round %d", match.Round)
+	}
+}
+
+// getMatchSide describes one side of a match by the seed and number of its team, or by the match
+// which decides it
+func getMatchSide(t Tournament, match TournamentMatch, side int) string {
+	switch entrant := match.Entrants[side]; entrant {
+	case tournamentBye:
+		return "bye"
+	case tournamentTBD:
+		source := match.Sources[side]
+		if source.Loser {
+			return fmt.Sprintf("loser M%d", source.Match+1)
+		}
+		return fmt.Sprintf("winner M%d", source.Match+1)
+	default:
+		return fmt.Sprintf("[%d] Team %d", entrant+1, t.Entrants[entrant].TeamNumber)
+	}
+}
+
+// getEntrantNames describes an entrant by their team number and the names of their players
+func getEntrantNames(entrant TournamentEntrant) string {
+	return fmt.Sprintf("Team %d (%s)", entrant.TeamNumber, strings.Join(entrant.Players, ", "))
+}
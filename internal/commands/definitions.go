@@ -5,46 +5,63 @@ package commands
 
 import (
 	"fmt"
+	"strings"
 
 	dg "github.com/bwmarrin/discordgo"
 	rsp "github.com/philflip12/spikebot/internal/responder"
 	log "github.com/sirupsen/logrus"
 )
 
-var channelMap map[string]struct{}
-
-func init() {
-	channelMap = map[string]struct{}{}
-}
-
-// should not be called after adding handles which use the ChannelIDs map.
-func SetChannelIDs(channelIDs []string) {
-	for _, channelID := range channelIDs {
-		channelMap[channelID] = struct{}{}
-	}
-}
-
 // OnInteractionCreate is called every time an interaction is created on any server the bot has
 // registered commands to.
 // It is added as a callback by 'discordgo.Session.AddHandler'
 func OnInteractionCreate(s *dg.Session, i *dg.InteractionCreate) {
-	if _, ok := channelMap[i.ChannelID]; !ok {
-		// Ignore commands sent from non-added channels
+	d, err := getPersistentServerData(s, i)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(s, i, err.Error())
 		return
 	}
+	defer d.release()
 
-	d, err := getPersistentServerData(s, i)
+	settings, err := d.GetSettings()
 	if err != nil {
 		log.Error(err)
 		rsp.InteractionRespond(s, i, err.Error())
 		return
 	}
+	// Ignore commands sent from channels the server has not allowed, except /config so that the
+	// allowed channels can always be changed
+	isConfig := i.Type == dg.InteractionApplicationCommand && i.ApplicationCommandData().Name == "config"
+	if !settings.allowsChannel(i.ChannelID) && !isConfig {
+		if len(settings.ChannelIDs) == 0 && !settings.AllChannels {
+			rsp.InteractionRespondEphemeral(s, i, "Spike has not been given any channels to respond in, a server manager can add one with /config channels add")
+		}
+		return
+	}
+
+	switch i.Type {
+	case dg.InteractionApplicationCommand:
+		onApplicationCommand(s, i, d)
+	case dg.InteractionMessageComponent:
+		onMessageComponent(s, i, d)
+	}
+}
+
+func onApplicationCommand(s *dg.Session, i *dg.InteractionCreate, d *serverData) {
+	rejection, err := checkCommandPermission(i, d)
+	if err != nil {
+		log.Error(err)
+		rsp.InteractionRespond(s, i, err.Error())
+		return
+	} else if rejection != "" {
+		rsp.InteractionRespondEphemeral(s, i, rejection)
+		return
+	}
 
 	switch i.ApplicationCommandData().Name {
 	case "help":
 		cmdHelp(s, i, d)
-	case "continue":
-		cmdContinue(s, i, d)
 	case "playing":
 		cmdPlay(s, i, d)
 	case "skill":
@@ -63,6 +80,30 @@ func OnInteractionCreate(s *dg.Session, i *dg.InteractionCreate) {
 		cmdTeams(s, i, d)
 	case "redo":
 		cmdRedoTeams(s, i, d)
+	case "match":
+		cmdMatch(s, i, d)
+	case "session":
+		cmdSession(s, i, d)
+	case "permissions":
+		cmdPermissions(s, i, d)
+	case "config":
+		cmdConfig(s, i, d)
+	case "position":
+		cmdPosition(s, i, d)
+	case "constraint":
+		cmdConstraint(s, i, d)
+	case "draft":
+		cmdDraft(s, i, d)
+	case "schedule":
+		cmdSchedule(s, i, d)
+	case "tournament":
+		cmdTournament(s, i, d)
+	case "stats":
+		cmdStats(s, i, d)
+	case "leaderboard":
+		cmdLeaderboard(s, i, d)
+	case "season":
+		cmdSeason(s, i, d)
 	}
 }
 
@@ -133,6 +174,95 @@ var (
 		MinValue:    ptr(float64(1)),
 		MaxValue:    99,
 	}
+	reasonOption = &dg.ApplicationCommandOption{
+		Name:        "reason",
+		Description: "Why the skill rank is being changed",
+		Type:        dg.ApplicationCommandOptionString,
+		Required:    false,
+	}
+	historyEntryOption = &dg.ApplicationCommandOption{
+		Name:        "entry",
+		Description: "Number of the change in the skill history to revert, defaults to the most recent",
+		Type:        dg.ApplicationCommandOptionInteger,
+		Required:    false,
+		MinValue:    ptr(float64(1)),
+	}
+	commandPathOption = &dg.ApplicationCommandOption{
+		Name:        "command",
+		Description: "Command or subcommand to restrict, such as \"skill\" or \"playing clear\"",
+		Type:        dg.ApplicationCommandOptionString,
+		Required:    true,
+	}
+	channelOption = &dg.ApplicationCommandOption{
+		Name:         "channel",
+		Description:  "Text channel of the server",
+		Type:         dg.ApplicationCommandOptionChannel,
+		Required:     true,
+		ChannelTypes: []dg.ChannelType{dg.ChannelTypeGuildText},
+	}
+	primaryPositionOption = &dg.ApplicationCommandOption{
+		Name:        "primary",
+		Description: "Position the player prefers to play",
+		Type:        dg.ApplicationCommandOptionString,
+		Required:    true,
+		Choices:     positionChoices(),
+	}
+	secondaryPositionOption = &dg.ApplicationCommandOption{
+		Name:        "secondary",
+		Description: "Position the player can fill in at when there are too few of it",
+		Type:        dg.ApplicationCommandOptionString,
+		Required:    false,
+		Choices:     positionChoices(),
+	}
+	playerOption = &dg.ApplicationCommandOption{
+		Name:        "player",
+		Description: "Member or guest",
+		Type:        dg.ApplicationCommandOptionMentionable,
+		Required:    true,
+	}
+	objectiveChoices = []*dg.ApplicationCommandOptionChoice{
+		{Name: "average skill gap", Value: objectiveAverage},
+		{Name: "total skill gap", Value: objectiveTotal},
+		{Name: "similar skill spread within teams", Value: objectiveVariance},
+		{Name: "split the strongest players evenly", Value: objectiveTop},
+	}
+	moveTeamOption = &dg.ApplicationCommandOption{
+		Name:        "team",
+		Description: "Number of the team to move the player to",
+		Type:        dg.ApplicationCommandOptionInteger,
+		Required:    true,
+		MinValue:    ptr(float64(1)),
+	}
+	playerPairOptions = []*dg.ApplicationCommandOption{{
+		Name:        "player_1",
+		Description: "Member or guest",
+		Type:        dg.ApplicationCommandOptionMentionable,
+		Required:    true,
+	}, {
+		Name:        "player_2",
+		Description: "Member or guest",
+		Type:        dg.ApplicationCommandOptionMentionable,
+		Required:    true,
+	}}
+	draftStartOptions = func() []*dg.ApplicationCommandOption {
+		options := []*dg.ApplicationCommandOption{{
+			Name:        "teams",
+			Description: "Number of teams to draft",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    true,
+			MinValue:    ptr(float64(2)),
+			MaxValue:    maxDraftCaptains,
+		}}
+		for i := 1; i <= maxDraftCaptains; i++ {
+			options = append(options, &dg.ApplicationCommandOption{
+				Name:        fmt.Sprintf("captain_%d", i),
+				Description: "Member or guest to captain a team",
+				Type:        dg.ApplicationCommandOptionMentionable,
+				Required:    false,
+			})
+		}
+		return options
+	}
 	signedOption = &dg.ApplicationCommandOption{
 		Name:        "signed",
 		Description: "Whether or not the guest has signed",
@@ -146,9 +276,6 @@ var (
 var CommandList = []*dg.ApplicationCommand{{
 	Name:        "help",
 	Description: "Print all spike commands",
-}, {
-	Name:        "continue",
-	Description: "Continue printing output from the previous command",
 }, {
 	Name:        "skill",
 	Description: "Commands relating to players' skill ranks",
@@ -159,6 +286,7 @@ var CommandList = []*dg.ApplicationCommand{{
 		Options: []*dg.ApplicationCommandOption{
 			memberOption,
 			skillOption,
+			reasonOption,
 		},
 	}, {
 		Name:        "increase",
@@ -167,6 +295,7 @@ var CommandList = []*dg.ApplicationCommand{{
 		Options: []*dg.ApplicationCommandOption{
 			memberOption,
 			increaseOption,
+			reasonOption,
 		},
 	}, {
 		Name:        "decrease",
@@ -175,6 +304,7 @@ var CommandList = []*dg.ApplicationCommand{{
 		Options: []*dg.ApplicationCommandOption{
 			memberOption,
 			decreaseOption,
+			reasonOption,
 		},
 	}, {
 		Name:        "show",
@@ -187,6 +317,21 @@ var CommandList = []*dg.ApplicationCommand{{
 		Name:        "show_all",
 		Description: "Display the skill rank of all players",
 		Type:        dg.ApplicationCommandOptionSubCommand,
+	}, {
+		Name:        "history",
+		Description: "Display the history of changes to the skill rank of a player",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{
+			memberOption,
+		},
+	}, {
+		Name:        "revert",
+		Description: "Restore the skill rank of a player to its value before a change",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{
+			memberOption,
+			historyEntryOption,
+		},
 	}, {
 		Name:        "guest",
 		Description: "Guest variations of skill commands",
@@ -198,6 +343,7 @@ var CommandList = []*dg.ApplicationCommand{{
 			Options: []*dg.ApplicationCommandOption{
 				guestOption,
 				skillOption,
+				reasonOption,
 			},
 		}, {
 			Name:        "increase",
@@ -206,6 +352,7 @@ var CommandList = []*dg.ApplicationCommand{{
 			Options: []*dg.ApplicationCommandOption{
 				guestOption,
 				increaseOption,
+				reasonOption,
 			},
 		}, {
 			Name:        "decrease",
@@ -214,6 +361,7 @@ var CommandList = []*dg.ApplicationCommand{{
 			Options: []*dg.ApplicationCommandOption{
 				guestOption,
 				decreaseOption,
+				reasonOption,
 			},
 		}, {
 			Name:        "show",
@@ -221,6 +369,21 @@ var CommandList = []*dg.ApplicationCommand{{
 			Type:        dg.ApplicationCommandOptionSubCommand,
 			Options: []*dg.ApplicationCommandOption{
 				guestOption},
+		}, {
+			Name:        "history",
+			Description: "Display the history of changes to the skill rank of a guest",
+			Type:        dg.ApplicationCommandOptionSubCommand,
+			Options: []*dg.ApplicationCommandOption{
+				guestOption,
+			},
+		}, {
+			Name:        "revert",
+			Description: "Restore the skill rank of a guest to its value before a change",
+			Type:        dg.ApplicationCommandOptionSubCommand,
+			Options: []*dg.ApplicationCommandOption{
+				guestOption,
+				historyEntryOption,
+			},
 		}},
 	}},
 }, {
@@ -236,13 +399,17 @@ var CommandList = []*dg.ApplicationCommand{{
 		Description: "Remove players from the list of active players",
 		Type:        dg.ApplicationCommandOptionSubCommand,
 		Options:     multiMemberSelectOptions(24),
+	}, {
+		Name:        "leave",
+		Description: "Remove yourself from the list of active players or the waitlist",
+		Type:        dg.ApplicationCommandOptionSubCommand,
 	}, {
 		Name:        "clear",
 		Description: "Clear the list of active players",
 		Type:        dg.ApplicationCommandOptionSubCommand,
 	}, {
 		Name:        "show_all",
-		Description: "Show the list of active players and their skill ranks",
+		Description: "Show the list of active players and the waitlist with their skill ranks",
 		Type:        dg.ApplicationCommandOptionSubCommand,
 	}, {
 		Name:        "guest",
@@ -262,22 +429,439 @@ var CommandList = []*dg.ApplicationCommand{{
 	}},
 }, {
 	Name:        "teams",
-	Description: "Create teams based on the list of players currently playing",
+	Description: "Commands relating to the teams created from the list of players currently playing",
 	Options: []*dg.ApplicationCommandOption{{
-		Name:        "count",
-		Description: "Number of teams to create",
-		Type:        dg.ApplicationCommandOptionInteger,
-		Required:    true,
-		MinValue:    ptr(float64(2)),
+		Name:        "create",
+		Description: "Create teams based on the list of players currently playing",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{{
+			Name:        "count",
+			Description: "Number of teams to create, required unless sizes or max_team_size is given",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    false,
+			MinValue:    ptr(float64(2)),
+		}, {
+			Name:        "sizes",
+			Description: "Number of players on each team separated by commas, such as 6,6,4,4. Others sit out",
+			Type:        dg.ApplicationCommandOptionString,
+			Required:    false,
+		}, {
+			Name:        "max_team_size",
+			Description: "The most players allowed on a team, players who do not fit sit out",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    false,
+			MinValue:    ptr(float64(1)),
+		}, {
+			Name:        "max_skill_gap",
+			Description: "Largest skill gap allowed between the strongest and weakest teams, defaults to the server's setting",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    false,
+			MinValue:    ptr(float64(0)),
+		}, {
+			Name:        "objective",
+			Description: "What to balance the teams by, defaults to the gap between team averages",
+			Type:        dg.ApplicationCommandOptionString,
+			Required:    false,
+			Choices:     objectiveChoices,
+		}, {
+			Name:        "top_count",
+			Description: "Number of strongest players to split evenly between the teams, defaults to the number of teams",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    false,
+			MinValue:    ptr(float64(1)),
+		}, {
+			Name:        "balance_positions",
+			Description: "Split the players of each position evenly between the teams, defaults to the server's setting",
+			Type:        dg.ApplicationCommandOptionBoolean,
+			Required:    false,
+		}, {
+			Name:        "repeat_penalty",
+			Description: "How strongly to avoid teammates from recent sessions, 0 to 10, defaults to the server's setting",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    false,
+			MinValue:    ptr(float64(0)),
+			MaxValue:    10,
+		}},
+	}, {
+		Name:        "show",
+		Description: "Show the most recently created teams, or earlier teams from /teams history",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{{
+			Name:        "entry",
+			Description: "Number of the teams in /teams history to show, defaults to 1, the most recent",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    false,
+			MinValue:    ptr(float64(1)),
+			MaxValue:    teamsHistoryLength,
+		}},
+	}, {
+		Name:        "history",
+		Description: "List the most recently created teams",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+	}, {
+		Name:        "swap",
+		Description: "Swap two players between the last created teams and the bench",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options:     playerPairOptions,
+	}, {
+		Name:        "move",
+		Description: "Move a player to a different one of the last created teams, or off the bench",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{
+			playerOption,
+			moveTeamOption,
+		},
+	}, {
+		Name:        "lock",
+		Description: "Keep a player on their team when /redo creates the teams again",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{
+			playerOption,
+		},
+	}, {
+		Name:        "unlock",
+		Description: "Let a locked player be placed on any team when /redo creates the teams again",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{
+			playerOption,
+		},
+	}},
+}, {
+	Name:        "position",
+	Description: "Commands relating to the positions players prefer to play",
+	Options: []*dg.ApplicationCommandOption{{
+		Name:        "set",
+		Description: "Set the positions a player prefers to play",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{
+			memberOption,
+			primaryPositionOption,
+			secondaryPositionOption,
+		},
+	}, {
+		Name:        "clear",
+		Description: "Remove the positions of a player",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{
+			memberOption,
+		},
+	}, {
+		Name:        "show_all",
+		Description: "Display the positions of all players",
+		Type:        dg.ApplicationCommandOptionSubCommand,
 	}, {
-		Name:        "max_skill_gap",
-		Description: "The largest allowable skill gap between the strongest and weakest created teams, defaults to 5",
+		Name:        "guest",
+		Description: "Guest variations of position commands",
+		Type:        dg.ApplicationCommandOptionSubCommandGroup,
+		Options: []*dg.ApplicationCommandOption{{
+			Name:        "set",
+			Description: "Set the positions a guest prefers to play",
+			Type:        dg.ApplicationCommandOptionSubCommand,
+			Options: []*dg.ApplicationCommandOption{
+				guestOption,
+				primaryPositionOption,
+				secondaryPositionOption,
+			},
+		}, {
+			Name:        "clear",
+			Description: "Remove the positions of a guest",
+			Type:        dg.ApplicationCommandOptionSubCommand,
+			Options: []*dg.ApplicationCommandOption{
+				guestOption,
+			},
+		}},
+	}},
+}, {
+	Name:        "constraint",
+	Description: "Commands for keeping pairs of players together or apart when creating teams",
+	Options: []*dg.ApplicationCommandOption{{
+		Name:        "together",
+		Description: "Always place two players on the same team",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options:     playerPairOptions,
+	}, {
+		Name:        "apart",
+		Description: "Always place two players on different teams",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options:     playerPairOptions,
+	}, {
+		Name:        "remove",
+		Description: "Remove the constraint between two players",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options:     playerPairOptions,
+	}, {
+		Name:        "show_all",
+		Description: "Display all team constraints",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+	}},
+}, {
+	Name:        "draft",
+	Description: "Commands for creating teams by having captains take turns picking players",
+	Options: []*dg.ApplicationCommandOption{{
+		Name:        "start",
+		Description: "Start a snake draft of the playing group, captains not chosen are the strongest players",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options:     draftStartOptions(),
+	}, {
+		Name:        "cancel",
+		Description: "Stop the running draft without saving the teams",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+	}},
+}, {
+	Name:        "schedule",
+	Description: "Commands for rotating the last created teams between the courts",
+	Options: []*dg.ApplicationCommandOption{{
+		Name:        "create",
+		Description: "Schedule the last created teams onto the courts",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{{
+			Name:        "format",
+			Description: "How the teams rotate between the courts",
+			Type:        dg.ApplicationCommandOptionString,
+			Required:    true,
+			Choices: []*dg.ApplicationCommandOptionChoice{
+				{Name: "round robin", Value: scheduleRoundRobin},
+				{Name: "king of the court", Value: scheduleKing},
+			},
+		}, {
+			Name:        "courts",
+			Description: "Number of courts available",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    true,
+			MinValue:    ptr(float64(1)),
+		}, {
+			Name:        "game_length",
+			Description: "Length of each game in minutes, defaults to 15",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    false,
+			MinValue:    ptr(float64(1)),
+		}},
+	}, {
+		Name:        "next",
+		Description: "Advance the schedule to the next round and announce the matchups",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{{
+			Name:        "winners",
+			Description: "Team numbers which won on each court separated by commas, for king of the court",
+			Type:        dg.ApplicationCommandOptionString,
+			Required:    false,
+		}},
+	}, {
+		Name:        "show",
+		Description: "Show the schedule as a table",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+	}},
+}, {
+	Name:        "tournament",
+	Description: "Commands for running a tournament between the last created teams",
+	Options: []*dg.ApplicationCommandOption{{
+		Name:        "create",
+		Description: "Start a tournament between the last created teams, seeded by their skill",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{{
+			Name:        "format",
+			Description: "How the teams are eliminated",
+			Type:        dg.ApplicationCommandOptionString,
+			Required:    true,
+			Choices: []*dg.ApplicationCommandOptionChoice{
+				{Name: "single elimination", Value: tournamentSingle},
+				{Name: "double elimination", Value: tournamentDouble},
+				{Name: "pool play into a bracket", Value: tournamentPools},
+			},
+		}, {
+			Name:        "pools",
+			Description: "Number of pools for pool play, defaults to 2",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    false,
+			MinValue:    ptr(float64(1)),
+		}, {
+			Name:        "advance",
+			Description: "Number of teams from each pool which advance to the bracket, defaults to 2",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    false,
+			MinValue:    ptr(float64(1)),
+		}},
+	}, {
+		Name:        "report",
+		Description: "Report the result of a tournament match",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{{
+			Name:        "match",
+			Description: "Number of the match",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    true,
+			MinValue:    ptr(float64(1)),
+		}, {
+			Name:        "winner",
+			Description: "Number of the winning team",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    true,
+			MinValue:    ptr(float64(1)),
+		}, {
+			Name:        "winner_score",
+			Description: "Points scored by the winning team, used to break ties in pool play",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    false,
+			MinValue:    ptr(float64(0)),
+		}, {
+			Name:        "loser_score",
+			Description: "Points scored by the losing team, used to break ties in pool play",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    false,
+			MinValue:    ptr(float64(0)),
+		}},
+	}, {
+		Name:        "show",
+		Description: "Show the state of the tournament bracket",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+	}, {
+		Name:        "cancel",
+		Description: "End the tournament without a champion",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+	}},
+}, {
+	Name:        "redo",
+	Description: "Create teams in the same way as the last call to /teams create or /draft",
+}, {
+	Name:        "session",
+	Description: "Commands for configuring the playing session",
+	Options: []*dg.ApplicationCommandOption{{
+		Name:        "open",
+		Description: "Post a sign-up message with buttons for players to join or leave the playing group",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{{
+			Name:        "title",
+			Description: "Title of the sign-up message, such as the time and place of the session",
+			Type:        dg.ApplicationCommandOptionString,
+			Required:    false,
+		}},
+	}, {
+		Name:        "capacity",
+		Description: "Set the most players allowed in the playing group, further players join a waitlist",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{{
+			Name:        "max_players",
+			Description: "The most players allowed in the playing group, 0 for no limit",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    true,
+			MinValue:    ptr(float64(0)),
+		}},
+	}, {
+		Name:        "close",
+		Description: "Record the attendance of everyone in the playing group for this session",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+	}},
+}, {
+	Name:        "stats",
+	Description: "Display the attendance, match results and streaks of a player",
+	Options: []*dg.ApplicationCommandOption{
+		playerOption,
+	},
+}, {
+	Name:        "leaderboard",
+	Description: "Display the top players by rating, win rate or attendance",
+	Options: []*dg.ApplicationCommandOption{{
+		Name:        "metric",
+		Description: "What the players are ranked by, defaults to rating",
+		Type:        dg.ApplicationCommandOptionString,
+		Required:    false,
+		Choices: []*dg.ApplicationCommandOptionChoice{
+			{Name: "rating", Value: leaderboardRating},
+			{Name: "win rate", Value: leaderboardWinRate},
+			{Name: "attendance", Value: leaderboardAttendance},
+		},
+	}, {
+		Name:        "window",
+		Description: "The period of play counted, defaults to the running season or else all time",
+		Type:        dg.ApplicationCommandOptionString,
+		Required:    false,
+		Choices: []*dg.ApplicationCommandOptionChoice{
+			{Name: "this season", Value: windowSeason},
+			{Name: "last 30 days", Value: window30Days},
+			{Name: "all time", Value: windowAllTime},
+		},
+	}, {
+		Name:        "count",
+		Description: "Number of players shown, defaults to 10",
 		Type:        dg.ApplicationCommandOptionInteger,
 		Required:    false,
+		MinValue:    ptr(float64(1)),
+		MaxValue:    50,
 	}},
 }, {
-	Name:        "redo",
-	Description: "Create teams in the same way as the last call to /teams",
+	Name:        "season",
+	Description: "Commands for running seasons, whose standings are archived when they end",
+	Options: []*dg.ApplicationCommandOption{{
+		Name:        "start",
+		Description: "Start a new season",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{{
+			Name:        "name",
+			Description: "Name of the season, defaults to its number",
+			Type:        dg.ApplicationCommandOptionString,
+			Required:    false,
+		}},
+	}, {
+		Name:        "end",
+		Description: "End the running season and archive its standings",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{{
+			Name:        "reset",
+			Description: "Percent of the way to move every skill rank toward the mean, defaults to 0",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    false,
+			MinValue:    ptr(float64(0)),
+			MaxValue:    100,
+		}},
+	}, {
+		Name:        "show",
+		Description: "Display the standings of a season, defaults to the running or last season",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{{
+			Name:        "number",
+			Description: "Number of the season",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    false,
+			MinValue:    ptr(float64(1)),
+		}},
+	}, {
+		Name:        "list",
+		Description: "Display every season and its winner",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+	}},
+}, {
+	Name:        "match",
+	Description: "Commands relating to matches played between the last created teams",
+	Options: []*dg.ApplicationCommandOption{{
+		Name:        "report",
+		Description: "Report the result of a match and update the skill rank of each player",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{{
+			Name:        "winner",
+			Description: "Number of the winning team",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    true,
+			MinValue:    ptr(float64(1)),
+		}, {
+			Name:        "loser",
+			Description: "Number of the losing team, required when there are more than 2 teams",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    false,
+			MinValue:    ptr(float64(1)),
+		}, {
+			Name:        "winner_score",
+			Description: "Score of the winning team, a wider margin of victory moves skill ranks further",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    false,
+			MinValue:    ptr(float64(0)),
+		}, {
+			Name:        "loser_score",
+			Description: "Score of the losing team, given along with the winning team's score",
+			Type:        dg.ApplicationCommandOptionInteger,
+			Required:    false,
+			MinValue:    ptr(float64(0)),
+		}},
+	}},
 }, {
 	Name:        "update_names",
 	Description: "Update Spike database with player's names and remove players that have left the server",
@@ -352,6 +936,85 @@ var CommandList = []*dg.ApplicationCommand{{
 		Type:        dg.ApplicationCommandOptionBoolean,
 		Required:    true,
 	}},
+}, {
+	Name:        "permissions",
+	Description: "Commands for restricting who may use each command, requires the Manage Server permission",
+	Options: []*dg.ApplicationCommandOption{{
+		Name:        "require_role",
+		Description: "Allow members with a role to use a command, once set other members may not use it",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{
+			commandPathOption,
+			{
+				Name:        "role",
+				Description: "Role allowed to use the command",
+				Type:        dg.ApplicationCommandOptionRole,
+				Required:    true,
+			},
+		},
+	}, {
+		Name:        "require_permission",
+		Description: "Allow members with a discord permission to use a command, once set other members may not use it",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{
+			commandPathOption,
+			{
+				Name:        "permission",
+				Description: "Discord permission allowed to use the command",
+				Type:        dg.ApplicationCommandOptionString,
+				Required:    true,
+				Choices:     permissionOptionChoices(),
+			},
+		},
+	}, {
+		Name:        "reset",
+		Description: "Remove the roles and permission required to use a command",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+		Options: []*dg.ApplicationCommandOption{
+			commandPathOption,
+		},
+	}, {
+		Name:        "show",
+		Description: "Display the roles and permissions required to use each command",
+		Type:        dg.ApplicationCommandOptionSubCommand,
+	}},
+}, {
+	Name:        "config",
+	Description: "Commands for configuring spike on this server, requires the Manage Server permission",
+	Options: []*dg.ApplicationCommandOption{{
+		Name:        "channels",
+		Description: "Commands for choosing the channels spike responds to commands in",
+		Type:        dg.ApplicationCommandOptionSubCommandGroup,
+		Options: []*dg.ApplicationCommandOption{{
+			Name:        "add",
+			Description: "Respond to commands in a channel, once a channel is added others are ignored",
+			Type:        dg.ApplicationCommandOptionSubCommand,
+			Options: []*dg.ApplicationCommandOption{
+				channelOption,
+			},
+		}, {
+			Name:        "remove",
+			Description: "Stop responding to commands in a channel",
+			Type:        dg.ApplicationCommandOptionSubCommand,
+			Options: []*dg.ApplicationCommandOption{
+				channelOption,
+			},
+		}, {
+			Name:        "all",
+			Description: "Set whether spike responds to commands in every channel, rather than only the added channels",
+			Type:        dg.ApplicationCommandOptionSubCommand,
+			Options: []*dg.ApplicationCommandOption{{
+				Name:        "allow",
+				Description: "Whether spike responds to commands in every channel",
+				Type:        dg.ApplicationCommandOptionBoolean,
+				Required:    true,
+			}},
+		}, {
+			Name:        "show",
+			Description: "Display the channels spike responds to commands in",
+			Type:        dg.ApplicationCommandOptionSubCommand,
+		}},
+	}},
 }}
 
 const helpMessage = "Spike Command Options:\n" +
@@ -363,14 +1026,19 @@ skill
 	decrease
 	show
 	show_all
+	history
+	revert
 	guest
 		set
 		increase
 		decrease
 		show
+		history
+		revert
 playing
 	add
 	remove
+	leave
 	clear
 	show_all
 	guest
@@ -386,17 +1054,81 @@ guest
 sign
 unsign
 require_signatures
+position
+	set
+	clear
+	show_all
+	guest
+		set
+		clear
+constraint
+	together
+	apart
+	remove
+	show_all
+session
+	open
+	capacity
+	close
+stats
+leaderboard
+season
+	start
+	end
+	show
+	list
 teams
+	create
+	show
+	history
+	swap
+	move
+	lock
+	unlock
+schedule
+	create
+	next
+	show
+tournament
+	create
+	report
+	show
+	cancel
+redo
+draft
+	start
+	cancel
+match
+	report
 update_names
+permissions
+	require_role
+	require_permission
+	reset
+	show
+config
+	channels
+		add
+		remove
+		all
+		show
 ` + "```"
 
 func cmdHelp(s *dg.Session, i *dg.InteractionCreate, _ *serverData) {
 	rsp.InteractionRespond(s, i, helpMessage)
 }
 
-func cmdContinue(s *dg.Session, i *dg.InteractionCreate, _ *serverData) {
-	if err := rsp.InteractionContinue(s, i); err == rsp.ErrNoResponseContinuation {
-		rsp.InteractionRespond(s, i, err.Error())
+// onMessageComponent is called when a user interacts with a component, such as a button, attached
+// to one of spike's messages
+func onMessageComponent(s *dg.Session, i *dg.InteractionCreate, d *serverData) {
+	customID := i.MessageComponentData().CustomID
+	switch {
+	case rsp.IsPageComponent(customID):
+		rsp.InteractionPage(s, i)
+	case strings.HasPrefix(customID, rsvpPrefix):
+		onRSVP(s, i, d)
+	case strings.HasPrefix(customID, draftPrefix):
+		onDraftPick(s, i, d)
 	}
 }
 
@@ -7,26 +7,42 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
-	"path/filepath"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/philflip12/spikebot/pkg/atomic"
 )
 
 const (
-	persistentDataDirectory = "persistentData"
-	settingsFileName        = "settings"
-	playerDataFileName      = "playerData"
-	playingListFileName     = "playingList"
+	settingsFileName      = "settings"
+	playerDataFileName    = "playerData"
+	playingListFileName   = "playingList"
+	matchHistoryFileName  = "matchHistory"
+	skillHistoryFileName  = "skillHistory"
+	constraintsFileName   = "teamConstraints"
+	rosterHistoryFileName = "rosterHistory"
+	teamsHistoryFileName  = "teamsHistory"
+	scheduleFileName      = "schedule"
+	tournamentFileName    = "tournament"
+	attendanceFileName    = "attendance"
+	seasonsFileName       = "seasons"
 )
 
+// jsonFileNames are the names of every file the JSON backend saves for a server
+var jsonFileNames = []string{
+	settingsFileName, playerDataFileName, playingListFileName, matchHistoryFileName,
+	skillHistoryFileName, constraintsFileName, rosterHistoryFileName, teamsHistoryFileName,
+	scheduleFileName, tournamentFileName, attendanceFileName, seasonsFileName,
+}
+
 var servers = atomic.NewAtomicMap[string, *serverData]()
 
-func newServerData(serverID string) *serverData {
-	filepath.Join(persistentDataDirectory, serverID)
-	serverDirectory := fmt.Sprintf("%s/%s", persistentDataDirectory, serverID)
-	return &serverData{
+func newJSONStore(serverDirectory string) *jsonStore {
+	return &jsonStore{
 		Settings: persistentObject[*Settings]{
 			filePath:   serverDirectory,
 			fileName:   settingsFileName,
@@ -39,30 +55,157 @@ func newServerData(serverID string) *serverData {
 			makeNew:    func() map[string]Player { return map[string]Player{} },
 			checkValid: func(m map[string]Player) bool { return m != nil },
 		},
-		Playing: persistentObject[map[string]struct{}]{
+		Playing: persistentObject[*PlayingGroup]{
 			filePath:   serverDirectory,
 			fileName:   playingListFileName,
-			makeNew:    func() map[string]struct{} { return map[string]struct{}{} },
-			checkValid: func(m map[string]struct{}) bool { return m != nil },
+			makeNew:    func() *PlayingGroup { return &PlayingGroup{} },
+			checkValid: func(m *PlayingGroup) bool { return m != nil },
+		},
+		Matches: persistentObject[*[]Match]{
+			filePath:   serverDirectory,
+			fileName:   matchHistoryFileName,
+			makeNew:    func() *[]Match { return &[]Match{} },
+			checkValid: func(m *[]Match) bool { return m != nil },
+		},
+		SkillHistory: persistentObject[*[]SkillHistoryEntry]{
+			filePath:   serverDirectory,
+			fileName:   skillHistoryFileName,
+			makeNew:    func() *[]SkillHistoryEntry { return &[]SkillHistoryEntry{} },
+			checkValid: func(m *[]SkillHistoryEntry) bool { return m != nil },
+		},
+		Constraints: persistentObject[*[]TeamConstraint]{
+			filePath:   serverDirectory,
+			fileName:   constraintsFileName,
+			makeNew:    func() *[]TeamConstraint { return &[]TeamConstraint{} },
+			checkValid: func(m *[]TeamConstraint) bool { return m != nil },
+		},
+		Rosters: persistentObject[*[]Roster]{
+			filePath:   serverDirectory,
+			fileName:   rosterHistoryFileName,
+			makeNew:    func() *[]Roster { return &[]Roster{} },
+			checkValid: func(m *[]Roster) bool { return m != nil },
+		},
+		TeamsHistory: persistentObject[*[]TeamsRecord]{
+			filePath:   serverDirectory,
+			fileName:   teamsHistoryFileName,
+			makeNew:    func() *[]TeamsRecord { return &[]TeamsRecord{} },
+			checkValid: func(m *[]TeamsRecord) bool { return m != nil },
+		},
+		Schedule: persistentObject[*Schedule]{
+			filePath:   serverDirectory,
+			fileName:   scheduleFileName,
+			makeNew:    func() *Schedule { return &Schedule{} },
+			checkValid: func(m *Schedule) bool { return m != nil },
+		},
+		Tournament: persistentObject[*Tournament]{
+			filePath:   serverDirectory,
+			fileName:   tournamentFileName,
+			makeNew:    func() *Tournament { return &Tournament{} },
+			checkValid: func(m *Tournament) bool { return m != nil },
+		},
+		Attendance: persistentObject[*[]AttendanceEntry]{
+			filePath:   serverDirectory,
+			fileName:   attendanceFileName,
+			makeNew:    func() *[]AttendanceEntry { return &[]AttendanceEntry{} },
+			checkValid: func(m *[]AttendanceEntry) bool { return m != nil },
+		},
+		Seasons: persistentObject[*[]Season]{
+			filePath:   serverDirectory,
+			fileName:   seasonsFileName,
+			makeNew:    func() *[]Season { return &[]Season{} },
+			checkValid: func(m *[]Season) bool { return m != nil },
 		},
 	}
 }
 
-type serverData struct {
-	Settings persistentObject[*Settings]
-	Players  persistentObject[map[string]Player]
-	Playing  persistentObject[map[string]struct{}]
+// jsonStore keeps each piece of a server's data in its own JSON file, rewriting the file on every
+// change
+type jsonStore struct {
+	Settings     persistentObject[*Settings]
+	Players      persistentObject[map[string]Player]
+	Playing      persistentObject[*PlayingGroup]
+	Matches      persistentObject[*[]Match]
+	SkillHistory persistentObject[*[]SkillHistoryEntry]
+	Constraints  persistentObject[*[]TeamConstraint]
+	Rosters      persistentObject[*[]Roster]
+	TeamsHistory persistentObject[*[]TeamsRecord]
+	Schedule     persistentObject[*Schedule]
+	Tournament   persistentObject[*Tournament]
+	Attendance   persistentObject[*[]AttendanceEntry]
+	Seasons      persistentObject[*[]Season]
 }
 
 type Settings struct {
 	RequireSignatures bool `json:"requireSignatures"`
+	// the most players allowed in the playing group at once, 0 if there is no limit
+	MaxPlayers int `json:"maxPlayers"`
+	// the rules restricting who may run each command, keyed by the command path such as
+	// "skill guest set". The rule of the most specific path applies.
+	Permissions map[string]PermissionRule `json:"permissions,omitempty"`
+	// the channels spike responds to commands in
+	ChannelIDs []string `json:"channelIDs,omitempty"`
+	// whether spike responds to commands in every channel rather than only those in ChannelIDs
+	AllChannels bool `json:"allChannels,omitempty"`
+	// whether the channels were chosen with /config channels, after which they are no longer
+	// seeded from the channels given at startup
+	ChannelsConfigured bool `json:"channelsConfigured,omitempty"`
+}
+
+// PermissionRule restricts a command to members with any of the roles or with all of the discord
+// permissions. Administrators are always allowed.
+type PermissionRule struct {
+	RoleIDs     []string `json:"roleIDs,omitempty"`
+	Permissions int64    `json:"permissions,omitempty"`
+}
+
+func (r PermissionRule) isEmpty() bool {
+	return len(r.RoleIDs) == 0 && r.Permissions == 0
+}
+
+// setCommandPermission replaces the rule of a command, removing it if the rule is empty
+func (s *Settings) setCommandPermission(command string, rule PermissionRule) (changed bool) {
+	if rule.isEmpty() {
+		if _, ok := s.Permissions[command]; !ok {
+			return false
+		}
+		delete(s.Permissions, command)
+		return true
+	}
+	if s.Permissions == nil {
+		s.Permissions = map[string]PermissionRule{}
+	}
+	s.Permissions[command] = rule
+	return true
+}
+
+// allowsChannel returns whether spike responds to commands in the channel
+func (s Settings) allowsChannel(channelID string) bool {
+	return s.AllChannels || slices.Contains(s.ChannelIDs, channelID)
+}
+
+// setChannelAllowed adds the channel to or removes it from the channels spike responds in
+func (s *Settings) setChannelAllowed(channelID string, allowed bool) (changed bool) {
+	s.ChannelsConfigured = true
+	index := slices.Index(s.ChannelIDs, channelID)
+	switch {
+	case allowed && index == -1:
+		s.ChannelIDs = append(s.ChannelIDs, channelID)
+		return true
+	case !allowed && index != -1:
+		s.ChannelIDs = slices.Delete(s.ChannelIDs, index, index+1)
+		return true
+	}
+	return false
 }
 
-// initializes the players and playing persistentObject variables for each server being serviced
-func setPlayersAndPlayingServerIDs(serverIDs []string) {
-	for _, serverID := range serverIDs {
-		servers.Write(serverID, newServerData(serverID))
+// seedChannels sets the channels spike responds in to those given at startup, unless channels
+// were already chosen
+func (s *Settings) seedChannels(channelIDs []string) (changed bool) {
+	if s.ChannelsConfigured || len(s.ChannelIDs) > 0 || len(channelIDs) == 0 {
+		return false
 	}
+	s.ChannelIDs = slices.Clone(channelIDs)
+	return true
 }
 
 type persistentObject[T any] struct {
@@ -155,7 +298,11 @@ func (p *persistentObject[T]) WithLock(do func(object T) (dirty bool)) error {
 	return nil
 }
 
-func (d *serverData) SetSignatureRequirement(isRequired bool) error {
+func (d *jsonStore) Close() error {
+	return nil
+}
+
+func (d *jsonStore) SetSignatureRequirement(isRequired bool) error {
 	return d.Settings.WithLock(func(s *Settings) (dirty bool) {
 		wasRequired := s.RequireSignatures
 		s.RequireSignatures = isRequired
@@ -163,25 +310,178 @@ func (d *serverData) SetSignatureRequirement(isRequired bool) error {
 	})
 }
 
-func (d *serverData) GetSettings() (Settings, error) {
+func (d *jsonStore) GetSettings() (Settings, error) {
 	var settings Settings
 	err := d.Settings.WithLock(func(s *Settings) (dirty bool) {
 		settings = *s
+		settings.Permissions = maps.Clone(s.Permissions)
+		settings.ChannelIDs = slices.Clone(s.ChannelIDs)
 		return false
 	})
 	return settings, err
 }
 
+func (d *jsonStore) SetCommandPermission(command string, rule PermissionRule) error {
+	return d.Settings.WithLock(func(s *Settings) (dirty bool) {
+		return s.setCommandPermission(command, rule)
+	})
+}
+
+func (d *jsonStore) SeedChannels(channelIDs []string) error {
+	return d.Settings.WithLock(func(s *Settings) (dirty bool) {
+		return s.seedChannels(channelIDs)
+	})
+}
+
+func (d *jsonStore) SetAllChannelsAllowed(allowed bool) error {
+	return d.Settings.WithLock(func(s *Settings) (dirty bool) {
+		wasAllowed := s.AllChannels
+		s.AllChannels = allowed
+		s.ChannelsConfigured = true
+		return wasAllowed != allowed
+	})
+}
+
+func (d *jsonStore) SetChannelAllowed(channelID string, allowed bool) (changed bool, err error) {
+	err = d.Settings.WithLock(func(s *Settings) (dirty bool) {
+		changed = s.setChannelAllowed(channelID, allowed)
+		return changed
+	})
+	return changed, err
+}
+
 type Player struct {
+	// ID is filled in when players are loaded and is not saved with the player
+	ID     string `json:"-"`
 	Name   string `json:"name"`
 	Skill  int    `json:"skill"`
 	Signed bool   `json:"signed"`
+	Rating Rating `json:"rating"`
+	// the positions the player prefers to play, empty if the player has not chosen one
+	Position          string `json:"position,omitempty"`
+	SecondaryPosition string `json:"secondaryPosition,omitempty"`
+
+	Stats PlayerStats `json:"stats"`
+}
+
+// PlayerStats counts the sessions a player attended and the matches they played
+type PlayerStats struct {
+	Sessions int `json:"sessions"`
+	// the time of the last session the player attended, zero if they have not attended one
+	LastPlayed time.Time `json:"lastPlayed"`
+	// the number of sessions in a row the player attended, ending with the last one they attended
+	SessionStreak        int `json:"sessionStreak"`
+	LongestSessionStreak int `json:"longestSessionStreak"`
+	Wins                 int `json:"wins"`
+	Losses               int `json:"losses"`
+	// the number of matches in a row the player won if positive, or lost if negative
+	MatchStreak      int `json:"matchStreak"`
+	LongestWinStreak int `json:"longestWinStreak"`
+}
+
+// PlayingGroup tracks who is playing in the order they joined, along with those waiting for a spot
+// to open up once the playing group is full.
+type PlayingGroup struct {
+	Playing  []string `json:"playing"`
+	Waitlist []string `json:"waitlist"`
+	// users who answered maybe to a sign-up message, they are neither playing nor waitlisted
+	Maybe []string `json:"maybe"`
 }
 
-func (d *serverData) LoadUserName(userID string) (string, bool, error) {
+// UnmarshalJSON also accepts the unordered playing list saved by earlier versions, an object keyed
+// by userID.
+func (g *PlayingGroup) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if _, ok := fields["playing"]; !ok {
+		g.Playing = make([]string, 0, len(fields))
+		for userID := range fields {
+			g.Playing = append(g.Playing, userID)
+		}
+		sort.Strings(g.Playing)
+		return nil
+	}
+
+	type playingGroup PlayingGroup
+	return json.Unmarshal(data, (*playingGroup)(g))
+}
+
+// add appends each user not already in the group to the playing group while it has room and to
+// the waitlist otherwise. A maxPlayers of 0 means there is no limit.
+func (g *PlayingGroup) add(maxPlayers int, userIDs ...string) (waitlisted []string, changed bool) {
+	for _, userID := range userIDs {
+		if index := slices.Index(g.Maybe, userID); index != -1 {
+			g.Maybe = slices.Delete(g.Maybe, index, index+1)
+			changed = true
+		}
+		if slices.Contains(g.Playing, userID) || slices.Contains(g.Waitlist, userID) {
+			continue
+		}
+		if maxPlayers > 0 && len(g.Playing) >= maxPlayers {
+			g.Waitlist = append(g.Waitlist, userID)
+			waitlisted = append(waitlisted, userID)
+		} else {
+			g.Playing = append(g.Playing, userID)
+		}
+		changed = true
+	}
+	return waitlisted, changed
+}
+
+func (g *PlayingGroup) clone() PlayingGroup {
+	return PlayingGroup{
+		Playing:  slices.Clone(g.Playing),
+		Waitlist: slices.Clone(g.Waitlist),
+		Maybe:    slices.Clone(g.Maybe),
+	}
+}
+
+// remove takes the users out of the playing group, the waitlist and the maybe list, returning the
+// userIDs which were in any of them
+func (g *PlayingGroup) remove(userIDs ...string) (removed []string) {
+	isRemoved := func(userID string) bool {
+		return slices.Contains(userIDs, userID)
+	}
+	for _, list := range [][]string{g.Playing, g.Waitlist, g.Maybe} {
+		for _, userID := range list {
+			if isRemoved(userID) {
+				removed = append(removed, userID)
+			}
+		}
+	}
+	g.Playing = slices.DeleteFunc(g.Playing, isRemoved)
+	g.Waitlist = slices.DeleteFunc(g.Waitlist, isRemoved)
+	g.Maybe = slices.DeleteFunc(g.Maybe, isRemoved)
+	return removed
+}
+
+// markMaybe moves the user out of the playing group or waitlist and onto the maybe list
+func (g *PlayingGroup) markMaybe(userID string) (changed bool) {
+	if slices.Contains(g.Maybe, userID) {
+		return false
+	}
+	g.remove(userID)
+	g.Maybe = append(g.Maybe, userID)
+	return true
+}
+
+// promote moves users from the front of the waitlist into the playing group until it is full
+func (g *PlayingGroup) promote(maxPlayers int) (promoted []string) {
+	for len(g.Waitlist) > 0 && (maxPlayers <= 0 || len(g.Playing) < maxPlayers) {
+		promoted = append(promoted, g.Waitlist[0])
+		g.Playing = append(g.Playing, g.Waitlist[0])
+		g.Waitlist = g.Waitlist[1:]
+	}
+	return promoted
+}
+
+func (d *jsonStore) LoadUserName(userID string) (string, bool, error) {
 	name, ok := "", false
 	err := d.Players.WithLock(func(players map[string]Player) (dirty bool) {
-		player, ok := players[userID]
+		var player Player
+		player, ok = players[userID]
 		if ok {
 			name = player.Name
 		}
@@ -190,7 +490,7 @@ func (d *serverData) LoadUserName(userID string) (string, bool, error) {
 	return name, ok, err
 }
 
-func (d *serverData) SaveUserName(userID string, name string) error {
+func (d *jsonStore) SaveUserName(userID string, name string) error {
 	return d.Players.WithLock(func(players map[string]Player) (dirty bool) {
 		if _, ok := players[userID]; ok {
 			return false
@@ -204,39 +504,42 @@ func (d *serverData) SaveUserName(userID string, name string) error {
 	})
 }
 
-func (d *serverData) DeleteUsers(userIDs ...string) error {
+func (d *jsonStore) DeleteUsers(userIDs ...string) error {
 	if len(userIDs) == 0 {
 		return nil
 	}
 
-	// Remove from playing group before deleting from database
-	err := d.Playing.WithLock(func(playing map[string]struct{}) (dirty bool) {
-		for _, userID := range userIDs {
-			if _, ok := playing[userID]; ok {
-				delete(playing, userID)
-				dirty = true
-			}
-		}
-		return dirty
-	})
-	if err != nil {
-		return err
-	}
-
 	missingIDs := 0
-	err = d.Players.WithLock(func(players map[string]Player) (dirty bool) {
-		for _, userID := range userIDs {
-			if _, ok := players[userID]; !ok {
-				missingIDs++
-			} else {
-				delete(players, userID)
-				dirty = true
+	var playersErr, saveErr error
+	// the players are locked within the playing group so that the users leave the playing group
+	// before they are deleted, and a failure in between leaves saved players who are not playing
+	// rather than playing users who are no longer saved
+	err := d.withPlayingGroup(func(group *PlayingGroup, maxPlayers int) (dirty bool) {
+		playersErr = d.Players.WithLock(func(players map[string]Player) (dirty bool) {
+			before := group.clone()
+			if len(group.remove(userIDs...)) > 0 {
+				group.promote(maxPlayers)
+				if saveErr = d.Playing.Save(); saveErr != nil {
+					*group = before
+					return false
+				}
 			}
-		}
-		return dirty
+			for _, userID := range userIDs {
+				if _, ok := players[userID]; !ok {
+					missingIDs++
+				} else {
+					delete(players, userID)
+					dirty = true
+				}
+			}
+			return dirty
+		})
+		return false
 	})
-	if err != nil {
-		return err
+	for _, err := range []error{err, playersErr, saveErr} {
+		if err != nil {
+			return err
+		}
 	}
 	switch missingIDs {
 	case 0:
@@ -248,61 +551,140 @@ func (d *serverData) DeleteUsers(userIDs ...string) error {
 	}
 }
 
-func (d *serverData) AddPlayingUsers(userIDs ...string) error {
-	return d.Playing.WithLock(func(playing map[string]struct{}) (dirty bool) {
-		for i := range userIDs {
-			if _, ok := playing[userIDs[i]]; !ok {
-				playing[userIDs[i]] = struct{}{}
-				dirty = true
-			}
-		}
-		return dirty
+// withPlayingGroup runs do on the playing group along with the most players it may hold. The
+// settings are locked within the playing group, so that the capacity cannot change until do is done.
+func (d *jsonStore) withPlayingGroup(do func(group *PlayingGroup, maxPlayers int) (dirty bool)) error {
+	var settingsErr error
+	err := d.Playing.WithLock(func(group *PlayingGroup) (dirty bool) {
+		settingsErr = d.Settings.WithLock(func(s *Settings) (settingsDirty bool) {
+			dirty = do(group, s.MaxPlayers)
+			return false
+		})
+		return dirty && settingsErr == nil
 	})
+	if err != nil {
+		return err
+	}
+	return settingsErr
 }
 
-func (d *serverData) RemovePlayingUsers(userIDs ...string) error {
-	return d.Playing.WithLock(func(playing map[string]struct{}) (dirty bool) {
-		for i := range userIDs {
-			if _, ok := playing[userIDs[i]]; ok {
-				delete(playing, userIDs[i])
-				dirty = true
-			}
-		}
+func (d *jsonStore) AddPlayingUsers(userIDs ...string) (waitlisted []string, err error) {
+	err = d.withPlayingGroup(func(group *PlayingGroup, maxPlayers int) (dirty bool) {
+		waitlisted, dirty = group.add(maxPlayers, userIDs...)
 		return dirty
 	})
+	if err != nil {
+		return nil, err
+	}
+	return waitlisted, nil
+}
+
+func (d *jsonStore) RemovePlayingUsers(userIDs ...string) (removed, promoted []string, err error) {
+	err = d.withPlayingGroup(func(group *PlayingGroup, maxPlayers int) (dirty bool) {
+		removed = group.remove(userIDs...)
+		promoted = group.promote(maxPlayers)
+		return len(removed) > 0 || len(promoted) > 0
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return removed, promoted, nil
+}
+
+func (d *jsonStore) MarkPlayingMaybe(userID string) (promoted []string, err error) {
+	err = d.withPlayingGroup(func(group *PlayingGroup, maxPlayers int) (dirty bool) {
+		dirty = group.markMaybe(userID)
+		promoted = group.promote(maxPlayers)
+		return dirty || len(promoted) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	return promoted, nil
 }
 
-func (d *serverData) ClearPlayingUsers() error {
+func (d *jsonStore) ClearPlayingUsers() error {
 	d.Playing.Lock()
 	defer d.Playing.Unlock()
 
-	d.Playing.object = map[string]struct{}{}
+	d.Playing.object = &PlayingGroup{}
 	return d.Playing.Save()
 }
 
-func (d *serverData) GetPlaying() ([]Player, error) {
-	var userIDs []string
-	err := d.Playing.WithLock(func(playing map[string]struct{}) (dirty bool) {
-		userIDs = make([]string, 0, len(playing))
-		for key := range playing {
-			userIDs = append(userIDs, key)
+func (d *jsonStore) SetMaxPlayers(maxPlayers int) (promoted []string, err error) {
+	var settingsErr error
+	// the playing group is locked first, in the same order as withPlayingGroup
+	err = d.Playing.WithLock(func(group *PlayingGroup) (dirty bool) {
+		settingsErr = d.Settings.WithLock(func(s *Settings) (dirty bool) {
+			maxBefore := s.MaxPlayers
+			s.MaxPlayers = maxPlayers
+			return maxBefore != maxPlayers
+		})
+		if settingsErr != nil {
+			return false
 		}
+		promoted = group.promote(maxPlayers)
+		return len(promoted) > 0
+	})
+	if err == nil {
+		err = settingsErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return promoted, nil
+}
+
+func (d *jsonStore) GetPlaying() ([]Player, error) {
+	var userIDs []string
+	err := d.Playing.WithLock(func(group *PlayingGroup) (dirty bool) {
+		userIDs = append([]string{}, group.Playing...)
 		return false
 	})
 	if err != nil {
 		return nil, err
 	}
+	return d.getPlayersInOrder(userIDs, "playing")
+}
 
-	playingPlayers := make([]Player, 0, len(userIDs))
+func (d *jsonStore) GetWaitlist() ([]Player, error) {
+	var userIDs []string
+	err := d.Playing.WithLock(func(group *PlayingGroup) (dirty bool) {
+		userIDs = append([]string{}, group.Waitlist...)
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d.getPlayersInOrder(userIDs, "waitlisted")
+}
+
+func (d *jsonStore) GetMaybe() ([]Player, error) {
+	var userIDs []string
+	err := d.Playing.WithLock(func(group *PlayingGroup) (dirty bool) {
+		userIDs = append([]string{}, group.Maybe...)
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d.getPlayersInOrder(userIDs, "maybe")
+}
+
+// getPlayersInOrder returns the players with the given userIDs in the same order. group names the
+// list the userIDs came from for the error returned when one is not a saved player.
+func (d *jsonStore) getPlayersInOrder(userIDs []string, group string) ([]Player, error) {
+	orderedPlayers := make([]Player, 0, len(userIDs))
 	var mapErr error
-	err = d.Players.WithLock(func(players map[string]Player) (dirty bool) {
+	err := d.Players.WithLock(func(players map[string]Player) (dirty bool) {
 		for _, userID := range userIDs {
 			player, ok := players[userID]
 			if !ok {
-				mapErr = errors.New("playing userID not found in list of players")
+				mapErr = fmt.Errorf("%s userID not found in list of players", group)
 				return false
 			}
-			playingPlayers = append(playingPlayers, player)
+			player.ID = userID
+			orderedPlayers = append(orderedPlayers, player)
 		}
 		return false
 	})
@@ -312,19 +694,37 @@ func (d *serverData) GetPlaying() ([]Player, error) {
 	if mapErr != nil {
 		return nil, mapErr
 	}
-	return playingPlayers, nil
+	return orderedPlayers, nil
 }
 
-func (d *serverData) GetPlayingCount() (int, error) {
-	var count int
-	err := d.Playing.WithLock(func(playing map[string]struct{}) (dirty bool) {
-		count = len(playing)
+func (d *jsonStore) GetPlayingCount() (playing, waitlisted int, err error) {
+	err = d.Playing.WithLock(func(group *PlayingGroup) (dirty bool) {
+		playing = len(group.Playing)
+		waitlisted = len(group.Waitlist)
 		return false
 	})
-	return count, err
+	return playing, waitlisted, err
 }
 
-func (d *serverData) SetPlayerSkill(userID string, skill int) error {
+func (d *jsonStore) SetPlayerSkill(userID string, skill int, edit SkillEdit) error {
+	_, err := d.updateSkills(edit, func(players map[string]Player) ([]SkillChange, error) {
+		player, ok := players[userID]
+		if !ok {
+			return nil, errors.New("userID not found in list of players")
+		}
+		skillBefore := player.Skill
+		player.Skill = skill
+		player.Rating = player.Rating.withSkill(skill)
+		players[userID] = player
+		if skill == skillBefore {
+			return nil, nil
+		}
+		return []SkillChange{{UserID: userID, Before: skillBefore, After: skill}}, nil
+	})
+	return err
+}
+
+func (d *jsonStore) SetPlayerPositions(userID, primary, secondary string) error {
 	var mapErr error
 	err := d.Players.WithLock(func(players map[string]Player) (dirty bool) {
 		player, ok := players[userID]
@@ -332,10 +732,11 @@ func (d *serverData) SetPlayerSkill(userID string, skill int) error {
 			mapErr = errors.New("userID not found in list of players")
 			return false
 		}
-		skillBefore := player.Skill
-		player.Skill = skill
+		dirty = player.Position != primary || player.SecondaryPosition != secondary
+		player.Position = primary
+		player.SecondaryPosition = secondary
 		players[userID] = player
-		return skill != skillBefore
+		return dirty
 	})
 	if err != nil {
 		return err
@@ -343,13 +744,11 @@ func (d *serverData) SetPlayerSkill(userID string, skill int) error {
 	return mapErr
 }
 
-func (d *serverData) ModifyPlayerSkill(userID string, diff int) (prev, new int, err error) {
-	var mapErr error
-	err = d.Players.WithLock(func(players map[string]Player) (dirty bool) {
+func (d *jsonStore) ModifyPlayerSkill(userID string, diff int, edit SkillEdit) (prev, new int, err error) {
+	_, err = d.updateSkills(edit, func(players map[string]Player) ([]SkillChange, error) {
 		player, ok := players[userID]
 		if !ok {
-			mapErr = errors.New("userID not found in list of players")
-			return false
+			return nil, errors.New("userID not found in list of players")
 		}
 		prev = player.Skill
 		player.Skill += diff
@@ -359,19 +758,20 @@ func (d *serverData) ModifyPlayerSkill(userID string, diff int) (prev, new int,
 			player.Skill = 0
 		}
 		new = player.Skill
+		player.Rating = player.Rating.withSkill(new)
 		players[userID] = player
-		return prev != new
+		if prev == new {
+			return nil, nil
+		}
+		return []SkillChange{{UserID: userID, Before: prev, After: new}}, nil
 	})
 	if err != nil {
 		return 0, 0, err
 	}
-	if mapErr != nil {
-		return 0, 0, mapErr
-	}
 	return prev, new, nil
 }
 
-func (d *serverData) UpdatePlayerSignatures(userIDs []string, signed bool) error {
+func (d *jsonStore) UpdatePlayerSignatures(userIDs []string, signed bool) error {
 	missingIDs := 0
 	err := d.Players.WithLock(func(players map[string]Player) (dirty bool) {
 		for _, userID := range userIDs {
@@ -399,11 +799,12 @@ func (d *serverData) UpdatePlayerSignatures(userIDs []string, signed bool) error
 	}
 }
 
-func (d *serverData) GetPlayer(userID string) (Player, bool, error) {
+func (d *jsonStore) GetPlayer(userID string) (Player, bool, error) {
 	var player Player
 	var found bool
 	err := d.Players.WithLock(func(players map[string]Player) (dirty bool) {
 		player, found = players[userID]
+		player.ID = userID
 		return false
 	})
 	if err != nil {
@@ -412,11 +813,12 @@ func (d *serverData) GetPlayer(userID string) (Player, bool, error) {
 	return player, found, nil
 }
 
-func (d *serverData) GetPlayers() (map[string]Player, error) {
+func (d *jsonStore) GetPlayers() (map[string]Player, error) {
 	var playerMap map[string]Player
 	err := d.Players.WithLock(func(players map[string]Player) (dirty bool) {
 		playerMap = make(map[string]Player, len(players))
 		for userID, player := range players {
+			player.ID = userID
 			playerMap[userID] = player
 		}
 		return false
@@ -424,7 +826,7 @@ func (d *serverData) GetPlayers() (map[string]Player, error) {
 	return playerMap, err
 }
 
-func (d *serverData) UpdatePlayerNames(nameMap map[string]string) error {
+func (d *jsonStore) UpdatePlayerNames(nameMap map[string]string) error {
 	return d.Players.WithLock(func(players map[string]Player) (dirty bool) {
 		dirty = false
 		for userID, name := range nameMap {
@@ -442,7 +844,7 @@ func (d *serverData) UpdatePlayerNames(nameMap map[string]string) error {
 	})
 }
 
-func (d *serverData) SaveGuest(guestID, guestName string, skill int, signed bool) error {
+func (d *jsonStore) SaveGuest(guestID, guestName string, skill int, signed bool) error {
 	var mapErr error
 	err := d.Players.WithLock(func(players map[string]Player) (dirty bool) {
 		if _, ok := players[guestID]; ok {
@@ -462,7 +864,7 @@ func (d *serverData) SaveGuest(guestID, guestName string, skill int, signed bool
 	return mapErr
 }
 
-func (d *serverData) RenamePlayer(guestID, guestName string) error {
+func (d *jsonStore) RenamePlayer(guestID, guestName string) error {
 	var mapErr error
 	err := d.Players.WithLock(func(players map[string]Player) (dirty bool) {
 		player, ok := players[guestID]
@@ -480,3 +882,772 @@ func (d *serverData) RenamePlayer(guestID, guestName string) error {
 	}
 	return mapErr
 }
+
+type Match struct {
+	Time        time.Time `json:"time"`
+	Winners     []string  `json:"winners"`
+	Losers      []string  `json:"losers"`
+	WinnerScore int       `json:"winnerScore,omitempty"`
+	LoserScore  int       `json:"loserScore,omitempty"`
+	// the ID of the interaction the match was reported by, so that it is only recorded once
+	InteractionID string `json:"interactionID,omitempty"`
+	// the change in rating of each rated player keyed by their ID, empty for matches recorded before
+	// the changes were kept
+	RatingChanges map[string]float64 `json:"ratingChanges,omitempty"`
+}
+
+// isReported returns whether the match was already recorded from the same interaction, such as when
+// discord delivers the interaction again
+func (m Match) isReported(matches []Match) bool {
+	return m.InteractionID != "" && slices.ContainsFunc(matches, func(reported Match) bool {
+		return reported.InteractionID == m.InteractionID
+	})
+}
+
+var errRepeatedMatch = errors.New("could not record match: the report was already recorded")
+
+type SkillChange struct {
+	UserID string
+	Name   string
+	Before int
+	After  int
+}
+
+// RecordMatch saves the match to the match history and updates the ratings and skill ranks of the
+// players involved. Players no longer in the database are left out of the rating update. A match
+// reported by an interaction which was already recorded is rejected.
+func (d *jsonStore) RecordMatch(match Match, edit SkillEdit) (winners, losers []SkillChange, err error) {
+	var recordErr, historyErr, saveErr error
+	// the players are locked within the matches, and the skill history within the players, so that
+	// the match and then the skill history are saved before the ratings they record. A failure in
+	// between leaves a match which was not rated rather than ratings without their match or their
+	// skill history.
+	err = d.Matches.WithLock(func(matches *[]Match) (dirty bool) {
+		if match.isReported(*matches) {
+			recordErr = errRepeatedMatch
+			return false
+		}
+		recordErr = d.Players.WithLock(func(players map[string]Player) (dirty bool) {
+			rated := maps.Clone(players)
+			winners, losers = rateMatch(rated, &match)
+			if len(winners) == 0 || len(losers) == 0 {
+				return false
+			}
+			*matches = append(*matches, match)
+			if saveErr = d.Matches.Save(); saveErr != nil {
+				*matches = (*matches)[:len(*matches)-1]
+				return false
+			}
+			historyErr = d.SkillHistory.WithLock(func(history *[]SkillHistoryEntry) (historyDirty bool) {
+				length := len(*history)
+				changes := append(append([]SkillChange{}, winners...), losers...)
+				if addSkillHistory(history, edit, time.Now(), changes...) {
+					if saveErr = d.SkillHistory.Save(); saveErr != nil {
+						*history = (*history)[:length]
+						return false
+					}
+				}
+				maps.Copy(players, rated)
+				dirty = true
+				return false
+			})
+			return dirty
+		})
+		return false
+	})
+	for _, err := range []error{err, recordErr, historyErr, saveErr} {
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(winners) == 0 || len(losers) == 0 {
+		return nil, nil, errors.New("could not record match: teams no longer contain any saved players with a skill rank")
+	}
+	return winners, losers, nil
+}
+
+// rateMatch updates the ratings, skill ranks and match stats of the match's players in players, and
+// sets the rating changes of the match
+func rateMatch(players map[string]Player, match *Match) (winners, losers []SkillChange) {
+	winnerIDs := knownPlayerIDs(players, match.Winners)
+	loserIDs := knownPlayerIDs(players, match.Losers)
+	if len(winnerIDs) == 0 || len(loserIDs) == 0 {
+		return nil, nil
+	}
+
+	before := map[string]float64{}
+	winnerRatings := make([]Rating, len(winnerIDs))
+	for i, userID := range winnerIDs {
+		winnerRatings[i] = players[userID].getRating()
+		before[userID] = winnerRatings[i].Mu
+	}
+	loserRatings := make([]Rating, len(loserIDs))
+	for i, userID := range loserIDs {
+		loserRatings[i] = players[userID].getRating()
+		before[userID] = loserRatings[i].Mu
+	}
+	winnerRatings, loserRatings = updateRatings(winnerRatings, loserRatings, marginWeight(match.WinnerScore, match.LoserScore))
+	recordResults(players, winnerIDs, true)
+	recordResults(players, loserIDs, false)
+
+	winners, losers = applyRatings(players, winnerIDs, winnerRatings), applyRatings(players, loserIDs, loserRatings)
+	match.RatingChanges = make(map[string]float64, len(before))
+	for userID, mu := range before {
+		match.RatingChanges[userID] = players[userID].Rating.Mu - mu
+	}
+	return winners, losers
+}
+
+// knownPlayerIDs returns the userIDs of the saved players who have a skill rank. Players without
+// one, such as an unranked player moved onto a team with /teams move, are left unrated.
+func knownPlayerIDs(players map[string]Player, userIDs []string) []string {
+	known := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if player, ok := players[userID]; ok && player.Skill >= 0 {
+			known = append(known, userID)
+		}
+	}
+	return known
+}
+
+func applyRatings(players map[string]Player, userIDs []string, ratings []Rating) []SkillChange {
+	changes := make([]SkillChange, len(userIDs))
+	for i, userID := range userIDs {
+		player := players[userID]
+		changes[i] = SkillChange{UserID: userID, Name: player.Name, Before: player.Skill}
+		player.Rating = ratings[i]
+		player.Skill = skillFromRating(ratings[i])
+		changes[i].After = player.Skill
+		players[userID] = player
+	}
+	return changes
+}
+
+// recordResults counts a won or lost match in the stats of each of the players
+func recordResults(players map[string]Player, userIDs []string, won bool) {
+	for _, userID := range userIDs {
+		player := players[userID]
+		stats := &player.Stats
+		if won {
+			stats.Wins++
+			stats.MatchStreak = max(stats.MatchStreak, 0) + 1
+			stats.LongestWinStreak = max(stats.LongestWinStreak, stats.MatchStreak)
+		} else {
+			stats.Losses++
+			stats.MatchStreak = min(stats.MatchStreak, 0) - 1
+		}
+		players[userID] = player
+	}
+}
+
+// recordAttendance counts the session at the given time in the stats of each of the players who
+// have not already been counted for it, returning the IDs of the players updated
+func recordAttendance(players map[string]Player, userIDs []string, attended time.Time) []string {
+	// the session before this one is the latest attended by anyone
+	var prevSession time.Time
+	for _, player := range players {
+		lastPlayed := player.Stats.LastPlayed
+		if lastPlayed.After(prevSession) && !isSameSession(lastPlayed, attended) {
+			prevSession = lastPlayed
+		}
+	}
+
+	updated := []string{}
+	for _, userID := range userIDs {
+		player, ok := players[userID]
+		if !ok || (!player.Stats.LastPlayed.IsZero() && isSameSession(player.Stats.LastPlayed, attended)) {
+			continue
+		}
+		stats := &player.Stats
+		if !prevSession.IsZero() && !stats.LastPlayed.IsZero() && isSameSession(stats.LastPlayed, prevSession) {
+			stats.SessionStreak++
+		} else {
+			stats.SessionStreak = 1
+		}
+		stats.LongestSessionStreak = max(stats.LongestSessionStreak, stats.SessionStreak)
+		stats.Sessions++
+		stats.LastPlayed = attended
+		players[userID] = player
+		updated = append(updated, userID)
+	}
+	return updated
+}
+
+// AttendanceEntry records that a player attended the session at the given time
+type AttendanceEntry struct {
+	UserID string    `json:"userID"`
+	Time   time.Time `json:"time"`
+}
+
+// RecordAttendance counts the session at the given time in the stats of each of the players, once
+// per session
+func (d *jsonStore) RecordAttendance(userIDs []string, attended time.Time) error {
+	var updated []string
+	err := d.Players.WithLock(func(players map[string]Player) (dirty bool) {
+		updated = recordAttendance(players, userIDs, attended)
+		return len(updated) > 0
+	})
+	if err != nil || len(updated) == 0 {
+		return err
+	}
+	return d.Attendance.WithLock(func(entries *[]AttendanceEntry) (dirty bool) {
+		for _, userID := range updated {
+			*entries = append(*entries, AttendanceEntry{UserID: userID, Time: attended})
+		}
+		return true
+	})
+}
+
+// GetAttendance returns the attendance recorded since the given time, from oldest to newest
+func (d *jsonStore) GetAttendance(since time.Time) ([]AttendanceEntry, error) {
+	var attendance []AttendanceEntry
+	err := d.Attendance.WithLock(func(entries *[]AttendanceEntry) (dirty bool) {
+		for _, entry := range *entries {
+			if !entry.Time.Before(since) {
+				attendance = append(attendance, entry)
+			}
+		}
+		return false
+	})
+	return attendance, err
+}
+
+// GetMatches returns the matches reported since the given time, from oldest to newest
+func (d *jsonStore) GetMatches(since time.Time) ([]Match, error) {
+	var matches []Match
+	err := d.Matches.WithLock(func(m *[]Match) (dirty bool) {
+		for _, match := range *m {
+			if !match.Time.Before(since) {
+				matches = append(matches, match)
+			}
+		}
+		return false
+	})
+	return matches, err
+}
+
+// softResetSkills moves the skill rank of every ranked player the given fraction of the way toward
+// the mean skill rank. The uncertainty of their ratings grows by the same fraction toward that of a
+// new player, so that their ratings can move quickly again.
+func softResetSkills(players map[string]Player, strength float64) []SkillChange {
+	sum, count := 0, 0
+	for _, player := range players {
+		if player.Skill >= 0 {
+			sum += player.Skill
+			count++
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	mean := float64(sum) / float64(count)
+
+	changes := []SkillChange{}
+	for userID, player := range players {
+		if player.Skill < 0 {
+			continue
+		}
+		change := SkillChange{UserID: userID, Name: player.Name, Before: player.Skill}
+		rating := player.getRating()
+		rating.Mu += strength * (mean - rating.Mu)
+		rating.Sigma += strength * max(initialRatingSigma-rating.Sigma, 0)
+		player.Skill = skillFromRating(rating)
+		if player.Rating.isSet() {
+			player.Rating = rating
+		}
+		change.After = player.Skill
+		players[userID] = player
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// SoftResetSkills moves the skill rank of every ranked player the given fraction of the way toward
+// the mean skill rank
+func (d *jsonStore) SoftResetSkills(strength float64, edit SkillEdit) ([]SkillChange, error) {
+	return d.updateSkills(edit, func(players map[string]Player) ([]SkillChange, error) {
+		return softResetSkills(players, strength), nil
+	})
+}
+
+// SkillEdit describes who made a change to players' skill ranks and why
+type SkillEdit struct {
+	ActorID   string
+	ActorName string
+	Reason    string
+}
+
+type SkillHistoryEntry struct {
+	UserID    string    `json:"userID"`
+	ActorID   string    `json:"actorID"`
+	ActorName string    `json:"actorName"`
+	Before    int       `json:"before"`
+	After     int       `json:"after"`
+	Time      time.Time `json:"time"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// updateSkills applies update to a copy of the players and records the skill changes it returns in
+// the skill history. The skill history is locked within the players and saved before the players,
+// so that a failure leaves neither the skill ranks nor their history changed.
+func (d *jsonStore) updateSkills(edit SkillEdit, update func(players map[string]Player) ([]SkillChange, error)) ([]SkillChange, error) {
+	var changes []SkillChange
+	var updateErr, historyErr error
+	err := d.Players.WithLock(func(players map[string]Player) (dirty bool) {
+		updated := maps.Clone(players)
+		if changes, updateErr = update(updated); updateErr != nil || len(changes) == 0 {
+			return false
+		}
+		historyErr = d.SkillHistory.WithLock(func(history *[]SkillHistoryEntry) (historyDirty bool) {
+			length := len(*history)
+			if addSkillHistory(history, edit, time.Now(), changes...) {
+				if updateErr = d.SkillHistory.Save(); updateErr != nil {
+					*history = (*history)[:length]
+					return false
+				}
+			}
+			maps.Copy(players, updated)
+			dirty = true
+			return false
+		})
+		return dirty
+	})
+	for _, err := range []error{err, historyErr, updateErr} {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// addSkillHistory appends an entry to history for each change which modified a skill rank,
+// returning whether any was added
+func addSkillHistory(history *[]SkillHistoryEntry, edit SkillEdit, now time.Time, changes ...SkillChange) (added bool) {
+	for _, change := range changes {
+		if change.Before == change.After {
+			continue
+		}
+		*history = append(*history, SkillHistoryEntry{
+			UserID:    change.UserID,
+			ActorID:   edit.ActorID,
+			ActorName: edit.ActorName,
+			Before:    change.Before,
+			After:     change.After,
+			Time:      now,
+			Reason:    edit.Reason,
+		})
+		added = true
+	}
+	return added
+}
+
+// playerSkillHistory returns the entries of history for the player from most to least recent
+func playerSkillHistory(history []SkillHistoryEntry, userID string) []SkillHistoryEntry {
+	var entries []SkillHistoryEntry
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].UserID == userID {
+			entries = append(entries, history[i])
+		}
+	}
+	return entries
+}
+
+// GetSkillHistory returns the skill history of a player from most to least recent
+func (d *jsonStore) GetSkillHistory(userID string) ([]SkillHistoryEntry, error) {
+	var entries []SkillHistoryEntry
+	err := d.SkillHistory.WithLock(func(history *[]SkillHistoryEntry) (dirty bool) {
+		entries = playerSkillHistory(*history, userID)
+		return false
+	})
+	return entries, err
+}
+
+// RevertSkillChange restores a player's skill rank to its value before the change at position
+// entryNum of their skill history, where 1 is the most recent change.
+func (d *jsonStore) RevertSkillChange(userID string, entryNum int, edit SkillEdit) (SkillHistoryEntry, error) {
+	var reverted SkillHistoryEntry
+	var revertErr, historyErr error
+	// the skill history is locked within the players so that no other change can be made between
+	// reading the history and restoring the skill rank, and the entry recording the revert is saved
+	// before the skill rank it records
+	err := d.Players.WithLock(func(players map[string]Player) (dirty bool) {
+		historyErr = d.SkillHistory.WithLock(func(history *[]SkillHistoryEntry) (historyDirty bool) {
+			entries := playerSkillHistory(*history, userID)
+			if entryNum > len(entries) {
+				revertErr = fmt.Errorf("skill history only contains %d changes", len(entries))
+				return false
+			}
+			reverted = entries[entryNum-1]
+			player, ok := players[userID]
+			if !ok {
+				revertErr = errors.New("userID not found in list of players")
+				return false
+			}
+			length := len(*history)
+			change := SkillChange{UserID: userID, Before: player.Skill, After: reverted.Before}
+			if !addSkillHistory(history, edit, time.Now(), change) {
+				return false
+			}
+			if revertErr = d.SkillHistory.Save(); revertErr != nil {
+				*history = (*history)[:length]
+				return false
+			}
+			player.Skill = reverted.Before
+			player.Rating = player.Rating.withSkill(reverted.Before)
+			players[userID] = player
+			dirty = true
+			return false
+		})
+		return dirty
+	})
+	for _, err := range []error{err, historyErr, revertErr} {
+		if err != nil {
+			return SkillHistoryEntry{}, err
+		}
+	}
+	return reverted, nil
+}
+
+const (
+	constraintTogether = "together"
+	constraintApart    = "apart"
+)
+
+// TeamConstraint requires a pair of players to be placed on the same team, or on different teams,
+// whenever both are playing
+type TeamConstraint struct {
+	Kind    string    `json:"kind"`
+	UserIDs [2]string `json:"userIDs"`
+}
+
+// isPair reports whether the constraint is between the two players, in either order
+func (c TeamConstraint) isPair(userIDA, userIDB string) bool {
+	return (c.UserIDs[0] == userIDA && c.UserIDs[1] == userIDB) ||
+		(c.UserIDs[0] == userIDB && c.UserIDs[1] == userIDA)
+}
+
+// GetTeamConstraints returns the team constraints in the order they were added
+func (d *jsonStore) GetTeamConstraints() ([]TeamConstraint, error) {
+	var constraints []TeamConstraint
+	err := d.Constraints.WithLock(func(c *[]TeamConstraint) (dirty bool) {
+		constraints = slices.Clone(*c)
+		return false
+	})
+	return constraints, err
+}
+
+// AddTeamConstraint adds a team constraint, replacing any constraint already between the pair
+func (d *jsonStore) AddTeamConstraint(constraint TeamConstraint) error {
+	return d.Constraints.WithLock(func(c *[]TeamConstraint) (dirty bool) {
+		*c = slices.DeleteFunc(*c, func(existing TeamConstraint) bool {
+			return existing.isPair(constraint.UserIDs[0], constraint.UserIDs[1])
+		})
+		*c = append(*c, constraint)
+		return true
+	})
+}
+
+func (d *jsonStore) RemoveTeamConstraint(userIDA, userIDB string) (removed bool, err error) {
+	err = d.Constraints.WithLock(func(c *[]TeamConstraint) (dirty bool) {
+		before := len(*c)
+		*c = slices.DeleteFunc(*c, func(existing TeamConstraint) bool {
+			return existing.isPair(userIDA, userIDB)
+		})
+		removed = len(*c) != before
+		return removed
+	})
+	return removed, err
+}
+
+// the number of playing sessions whose rosters are remembered
+const rosterHistoryLength = 5
+
+// Roster holds the userIDs of each team created for a playing session
+type Roster struct {
+	Time  time.Time  `json:"time"`
+	Teams [][]string `json:"teams"`
+}
+
+// isSameSession reports whether two rosters were created for the same playing session, which is
+// taken to be everything created on the same day
+func isSameSession(a, b time.Time) bool {
+	yearA, monthA, dayA := a.Local().Date()
+	yearB, monthB, dayB := b.Local().Date()
+	return yearA == yearB && monthA == monthB && dayA == dayB
+}
+
+// SaveRoster saves the teams created for the current playing session, replacing any teams created
+// earlier in the same session
+func (d *jsonStore) SaveRoster(roster Roster) error {
+	return d.Rosters.WithLock(func(rosters *[]Roster) (dirty bool) {
+		if len(*rosters) > 0 && isSameSession((*rosters)[len(*rosters)-1].Time, roster.Time) {
+			*rosters = (*rosters)[:len(*rosters)-1]
+		}
+		*rosters = append(*rosters, roster)
+		if len(*rosters) > rosterHistoryLength {
+			*rosters = slices.Clone((*rosters)[len(*rosters)-rosterHistoryLength:])
+		}
+		return true
+	})
+}
+
+// GetRosters returns the rosters of the remembered playing sessions from most to least recent
+func (d *jsonStore) GetRosters() ([]Roster, error) {
+	var rosters []Roster
+	err := d.Rosters.WithLock(func(r *[]Roster) (dirty bool) {
+		for i := len(*r) - 1; i >= 0; i-- {
+			rosters = append(rosters, (*r)[i])
+		}
+		return false
+	})
+	return rosters, err
+}
+
+// the number of generated teams which are remembered
+const teamsHistoryLength = 10
+
+// TeamsConfig holds the options teams are created with, so that /redo can create them the same way
+type TeamsConfig struct {
+	// the number of teams, 0 if it follows from MaxTeamSize
+	NumTeams    int     `json:"numTeams"`
+	MaxSkillGap float64 `json:"maxSkillGap"`
+	// the number of players on each team, nil to split the players evenly
+	TeamSizes []int `json:"teamSizes,omitempty"`
+	// the most players allowed on a team, 0 if there is no limit
+	MaxTeamSize int `json:"maxTeamSize,omitempty"`
+	// what the teams are balanced by, "" for the gap between team averages
+	Objective string `json:"objective,omitempty"`
+	// the number of strongest players split evenly between the teams, 0 for one per team
+	TopCount int `json:"topCount,omitempty"`
+	// whether the players of each position are split evenly between the teams
+	BalancePositions bool `json:"balancePositions,omitempty"`
+	// how strongly to avoid placing players with their teammates from earlier sessions, 0 to ignore
+	RepeatPenalty int `json:"repeatPenalty,omitempty"`
+	// the captains of the teams if they were drafted rather than created by /teams create
+	DraftCaptains []string `json:"draftCaptains,omitempty"`
+}
+
+// TeamsRecord holds a set of generated teams as they were displayed, along with the options they
+// were created with
+type TeamsRecord struct {
+	Time     time.Time   `json:"time"`
+	Config   TeamsConfig `json:"config"`
+	SkillGap float64     `json:"skillGap"`
+	Optimal  bool        `json:"optimal"`
+	// the number of teammate pairings repeated from earlier sessions
+	Repeats int                   `json:"repeats"`
+	Teams   [][]TeamsRecordPlayer `json:"teams"`
+	// the players left over once every team was full, who sit out
+	Bench []TeamsRecordPlayer `json:"bench,omitempty"`
+}
+
+// TeamsRecordPlayer holds a player as they were when the teams were generated
+type TeamsRecordPlayer struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Skill int    `json:"skill"`
+	// the position the player was balanced as, "" if positions were not balanced
+	Position string `json:"position,omitempty"`
+	// whether the player stays on their team when the teams are created again by /redo
+	Locked bool `json:"locked,omitempty"`
+}
+
+func (r *TeamsRecord) clone() TeamsRecord {
+	record := *r
+	record.Config.TeamSizes = slices.Clone(r.Config.TeamSizes)
+	record.Config.DraftCaptains = slices.Clone(r.Config.DraftCaptains)
+	record.Teams = make([][]TeamsRecordPlayer, len(r.Teams))
+	for i, team := range r.Teams {
+		record.Teams[i] = slices.Clone(team)
+	}
+	record.Bench = slices.Clone(r.Bench)
+	return record
+}
+
+// SaveTeams saves a set of generated teams, forgetting the oldest once there are too many
+func (d *jsonStore) SaveTeams(record TeamsRecord) error {
+	return d.TeamsHistory.WithLock(func(history *[]TeamsRecord) (dirty bool) {
+		*history = append(*history, record.clone())
+		if len(*history) > teamsHistoryLength {
+			*history = slices.Clone((*history)[len(*history)-teamsHistoryLength:])
+		}
+		return true
+	})
+}
+
+// GetTeamsHistory returns the remembered generated teams from most to least recent
+func (d *jsonStore) GetTeamsHistory() ([]TeamsRecord, error) {
+	var history []TeamsRecord
+	err := d.TeamsHistory.WithLock(func(h *[]TeamsRecord) (dirty bool) {
+		for i := len(*h) - 1; i >= 0; i-- {
+			history = append(history, (*h)[i].clone())
+		}
+		return false
+	})
+	return history, err
+}
+
+func (d *jsonStore) UpdateLastTeams(update func(record *TeamsRecord) (changed bool)) (record TeamsRecord, ok bool, err error) {
+	err = d.TeamsHistory.WithLock(func(history *[]TeamsRecord) (dirty bool) {
+		if len(*history) == 0 {
+			return false
+		}
+		ok = true
+		record = (*history)[len(*history)-1].clone()
+		if !update(&record) {
+			return false
+		}
+		(*history)[len(*history)-1] = record.clone()
+		return true
+	})
+	return record, ok, err
+}
+
+// Schedule is a rotation of the last created teams between the courts, for when there are more
+// teams than courts
+type Schedule struct {
+	// the rotation format, "" if there is no schedule
+	Format string `json:"format"`
+	// the time the teams being rotated were created, so a schedule of older teams can be detected
+	TeamsTime time.Time `json:"teamsTime"`
+	NumTeams  int       `json:"numTeams"`
+	Courts    int       `json:"courts"`
+	// the length of each game in minutes
+	GameLength int `json:"gameLength"`
+	// the team numbers playing on each court in each round. The rounds of a king of the court
+	// schedule are added as they are played.
+	Rounds [][][2]int `json:"rounds"`
+	// the index of the round being played
+	Round int `json:"round"`
+	// the team numbers waiting to play in a king of the court schedule, in the order they play
+	Queue []int `json:"queue,omitempty"`
+}
+
+// GetSchedule returns the saved schedule, ok is false if there is none
+func (d *jsonStore) GetSchedule() (schedule Schedule, ok bool, err error) {
+	err = d.Schedule.WithLock(func(s *Schedule) (dirty bool) {
+		schedule = *s
+		return false
+	})
+	return schedule, schedule.Format != "", err
+}
+
+// SaveSchedule replaces the saved schedule
+func (d *jsonStore) SaveSchedule(schedule Schedule) error {
+	return d.Schedule.WithLock(func(s *Schedule) (dirty bool) {
+		*s = schedule
+		return true
+	})
+}
+
+// Tournament is a bracket of matches between the teams that were last created
+type Tournament struct {
+	// the tournament format, "" if there is no tournament
+	Format string `json:"format"`
+	// the teams in seed order, so the strongest team is first
+	Entrants []TournamentEntrant `json:"entrants"`
+	// the matches in the order they can be played, each only depending on the matches before it
+	Matches []TournamentMatch `json:"matches"`
+	// the entrant indices in each pool, for pool play
+	Pools [][]int `json:"pools,omitempty"`
+	// the number of teams from each pool which advance to the bracket, for pool play
+	Advance int `json:"advance,omitempty"`
+	// the index of the match which decides the champion, -1 until the bracket is created
+	Final int `json:"final"`
+}
+
+// TournamentEntrant is a team as it was when the tournament was created
+type TournamentEntrant struct {
+	TeamNumber int      `json:"teamNumber"`
+	Skill      float64  `json:"skill"`
+	Players    []string `json:"players"`
+}
+
+// TournamentMatch is a match between two entrants of a tournament
+type TournamentMatch struct {
+	Bracket string `json:"bracket"`
+	Round   int    `json:"round"`
+	// the index of the pool the match is played in, for pool play
+	Pool int `json:"pool,omitempty"`
+	// the entrant index of each side, tournamentTBD until the side is decided by its source match,
+	// or tournamentBye if nobody fills the side
+	Entrants [2]int `json:"entrants"`
+	// the matches whose winner or loser fills each side, nil for sides filled when the match was
+	// created
+	Sources [2]*MatchSource `json:"sources"`
+	// the entrant index of the winner, tournamentTBD until the match is decided
+	Winner int `json:"winner"`
+	// the points scored by each side, both 0 if they were not reported
+	Scores [2]int `json:"scores"`
+}
+
+// MatchSource refers to the winner or loser of an earlier match
+type MatchSource struct {
+	Match int  `json:"match"`
+	Loser bool `json:"loser,omitempty"`
+}
+
+// GetTournament returns the saved tournament, ok is false if there is none
+func (d *jsonStore) GetTournament() (tournament Tournament, ok bool, err error) {
+	err = d.Tournament.WithLock(func(t *Tournament) (dirty bool) {
+		tournament = *t
+		return false
+	})
+	return tournament, tournament.Format != "", err
+}
+
+// SaveTournament replaces the saved tournament
+func (d *jsonStore) SaveTournament(tournament Tournament) error {
+	return d.Tournament.WithLock(func(t *Tournament) (dirty bool) {
+		*t = tournament
+		return true
+	})
+}
+
+// Season is a period of play whose standings are archived when it ends
+type Season struct {
+	Number int       `json:"number"`
+	Name   string    `json:"name"`
+	Start  time.Time `json:"start"`
+	// the time the season ended, zero while it is running
+	End time.Time `json:"end"`
+	// the standings of the players when the season ended
+	Standings []Standing `json:"standings,omitempty"`
+}
+
+// Standing is a player's rating and results over a period of play
+type Standing struct {
+	UserID string  `json:"userID"`
+	Name   string  `json:"name"`
+	Skill  int     `json:"skill"`
+	Rating float64 `json:"rating"`
+	// the change in rating over the period
+	RatingChange float64 `json:"ratingChange"`
+	Wins         int     `json:"wins"`
+	Losses       int     `json:"losses"`
+	Sessions     int     `json:"sessions"`
+}
+
+// GetSeasons returns every season from oldest to newest
+func (d *jsonStore) GetSeasons() ([]Season, error) {
+	var seasons []Season
+	err := d.Seasons.WithLock(func(s *[]Season) (dirty bool) {
+		seasons = append(seasons, *s...)
+		return false
+	})
+	return seasons, err
+}
+
+// SaveSeason adds a new season or replaces the season with the same number
+func (d *jsonStore) SaveSeason(season Season) error {
+	return d.Seasons.WithLock(func(seasons *[]Season) (dirty bool) {
+		for i := range *seasons {
+			if (*seasons)[i].Number == season.Number {
+				(*seasons)[i] = season
+				return true
+			}
+		}
+		*seasons = append(*seasons, season)
+		return true
+	})
+}
@@ -0,0 +1,134 @@
+package commands
+
+// This file contains the TrueSkill style rating model used to update players' skill ranks from
+// reported match results. Ratings are kept on the same 0-99 scale as skill ranks so that a
+// player's skill rank is simply their rounded rating.
+
+import "math"
+
+const (
+	// uncertainty given to a player's skill rank before their first reported match
+	initialRatingSigma = 8.0
+	// spread of a single game's performance around a player's true skill
+	ratingBeta = 4.0
+	// uncertainty added before each match so that ratings can keep moving over time
+	ratingTau = 0.2
+)
+
+type Rating struct {
+	Mu    float64 `json:"mu"`
+	Sigma float64 `json:"sigma"`
+	Games int     `json:"games"`
+}
+
+// isSet reports whether the rating has been initialized by a reported match
+func (r Rating) isSet() bool {
+	return r.Sigma > 0
+}
+
+// withSkill returns the rating after an admin overwrites the player's skill rank. The uncertainty
+// of the rating is kept.
+func (r Rating) withSkill(skill int) Rating {
+	if !r.isSet() {
+		return r
+	}
+	r.Mu = float64(skill)
+	return r
+}
+
+// getRating returns the player's rating, starting from their skill rank if no match has been
+// reported for them yet.
+func (p Player) getRating() Rating {
+	if p.Rating.isSet() {
+		return p.Rating
+	}
+	return Rating{Mu: float64(p.Skill), Sigma: initialRatingSigma}
+}
+
+// skillFromRating converts a rating to the 0-99 skill rank displayed to users
+func skillFromRating(r Rating) int {
+	skill := int(math.Round(r.Mu))
+	if skill > 99 {
+		return 99
+	} else if skill < 0 {
+		return 0
+	}
+	return skill
+}
+
+// marginWeight returns how far the score of a match moves the ratings compared to a match reported
+// without a score, from half as far for a tied score up to half again as far for a shutout
+func marginWeight(winnerScore, loserScore int) float64 {
+	if winnerScore+loserScore <= 0 {
+		return 1
+	}
+	return 0.5 + float64(winnerScore-loserScore)/float64(winnerScore+loserScore)
+}
+
+// updateRatings returns the new ratings of the players on a winning and losing team. A team's
+// strength is the average of its players' ratings, matching how teams are balanced. The change in
+// each rating is scaled by weight, such as from marginWeight.
+func updateRatings(winners, losers []Rating, weight float64) (newWinners, newLosers []Rating) {
+	winners = addDynamics(winners)
+	losers = addDynamics(losers)
+
+	winnerMean, winnerVariance := teamPerformance(winners)
+	loserMean, loserVariance := teamPerformance(losers)
+	c := math.Sqrt(2*ratingBeta*ratingBeta + winnerVariance + loserVariance)
+
+	t := (winnerMean - loserMean) / c
+	v := truncatedMean(t)
+	w := v * (v + t)
+
+	newWinners = make([]Rating, len(winners))
+	for i, r := range winners {
+		newWinners[i] = updateRating(r, len(winners), c, v*weight, w, 1)
+	}
+	newLosers = make([]Rating, len(losers))
+	for i, r := range losers {
+		newLosers[i] = updateRating(r, len(losers), c, v*weight, w, -1)
+	}
+	return newWinners, newLosers
+}
+
+func addDynamics(ratings []Rating) []Rating {
+	withDynamics := make([]Rating, len(ratings))
+	for i, r := range ratings {
+		r.Sigma = math.Sqrt(r.Sigma*r.Sigma + ratingTau*ratingTau)
+		withDynamics[i] = r
+	}
+	return withDynamics
+}
+
+// teamPerformance returns the mean and the variance of the rating uncertainty of a team's average
+func teamPerformance(team []Rating) (mean, variance float64) {
+	size := float64(len(team))
+	for _, r := range team {
+		mean += r.Mu
+		variance += r.Sigma * r.Sigma
+	}
+	return mean / size, variance / (size * size)
+}
+
+// updateRating moves a single player's rating in the direction of the match result. sign is 1 for
+// winners and -1 for losers.
+func updateRating(r Rating, teamSize int, c, v, w, sign float64) Rating {
+	// a player contributes 1/teamSize of their team's average
+	weightedVariance := r.Sigma * r.Sigma / float64(teamSize)
+	r.Mu += sign * weightedVariance / c * v
+	r.Sigma *= math.Sqrt(math.Max(1-weightedVariance/float64(teamSize)/(c*c)*w, 0))
+	r.Games++
+	return r
+}
+
+// truncatedMean returns the additive correction to the performance difference after observing
+// that it was positive, N(t)/Φ(t).
+func truncatedMean(t float64) float64 {
+	cdf := 0.5 * math.Erfc(-t/math.Sqrt2)
+	if cdf < 1e-12 {
+		// the limit for large upsets, where the ratio cannot be computed accurately
+		return -t
+	}
+	pdf := math.Exp(-t*t/2) / math.Sqrt(2*math.Pi)
+	return pdf / cdf
+}
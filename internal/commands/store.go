@@ -0,0 +1,305 @@
+package commands
+
+// This file defines the interface through which commands read and write the persistent data of a
+// server, along with the selection of the storage backend implementing it.
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Store contains every operation on the persistent data of a single server
+type Store interface {
+	GetSettings() (Settings, error)
+	SetSignatureRequirement(isRequired bool) error
+	// SetCommandPermission replaces the permission rule of a command, an empty rule removes it
+	SetCommandPermission(command string, rule PermissionRule) error
+	// SetChannelAllowed adds the channel to or removes it from the channels commands are accepted
+	// in, changed is false if it already was or was not in them
+	SetChannelAllowed(channelID string, allowed bool) (changed bool, err error)
+	// SetAllChannelsAllowed sets whether commands are accepted in every channel
+	SetAllChannelsAllowed(allowed bool) error
+	// SeedChannels sets the channels commands are accepted in, unless they were already chosen
+	SeedChannels(channelIDs []string) error
+
+	LoadUserName(userID string) (string, bool, error)
+	SaveUserName(userID string, name string) error
+	DeleteUsers(userIDs ...string) error
+	GetPlayer(userID string) (Player, bool, error)
+	GetPlayers() (map[string]Player, error)
+	UpdatePlayerNames(nameMap map[string]string) error
+	UpdatePlayerSignatures(userIDs []string, signed bool) error
+	SaveGuest(guestID, guestName string, skill int, signed bool) error
+	RenamePlayer(guestID, guestName string) error
+	// SetPlayerPositions sets the positions the player prefers to play, empty to clear them
+	SetPlayerPositions(userID, primary, secondary string) error
+
+	// AddPlayingUsers returns the userIDs which were put on the waitlist because the playing group
+	// was full
+	AddPlayingUsers(userIDs ...string) (waitlisted []string, err error)
+	// RemovePlayingUsers returns the userIDs which were in the playing group, waitlist or maybe
+	// list, and those which were moved from the waitlist into the spots opened in the playing group
+	RemovePlayingUsers(userIDs ...string) (removed, promoted []string, err error)
+	// MarkPlayingMaybe moves the user from the playing group or waitlist to the maybe list and
+	// returns the userIDs moved from the waitlist into any opened spot
+	MarkPlayingMaybe(userID string) (promoted []string, err error)
+	ClearPlayingUsers() error
+	SetMaxPlayers(maxPlayers int) (promoted []string, err error)
+	// GetPlaying returns the playing group in the order the players joined
+	GetPlaying() ([]Player, error)
+	// GetWaitlist returns the waitlist in the order the players joined
+	GetWaitlist() ([]Player, error)
+	// GetMaybe returns the users who might play in the order they answered
+	GetMaybe() ([]Player, error)
+	GetPlayingCount() (playing, waitlisted int, err error)
+
+	SetPlayerSkill(userID string, skill int, edit SkillEdit) error
+	ModifyPlayerSkill(userID string, diff int, edit SkillEdit) (prev, new int, err error)
+	GetSkillHistory(userID string) ([]SkillHistoryEntry, error)
+	RevertSkillChange(userID string, entryNum int, edit SkillEdit) (SkillHistoryEntry, error)
+
+	RecordMatch(match Match, edit SkillEdit) (winners, losers []SkillChange, err error)
+	// RecordAttendance counts the session at the given time in the stats of each of the players,
+	// once per session
+	RecordAttendance(userIDs []string, attended time.Time) error
+	// GetAttendance returns the attendance recorded since the given time, from oldest to newest
+	GetAttendance(since time.Time) ([]AttendanceEntry, error)
+	// GetMatches returns the matches reported since the given time, from oldest to newest
+	GetMatches(since time.Time) ([]Match, error)
+	// SoftResetSkills moves the skill rank of every ranked player the given fraction of the way
+	// toward the mean skill rank
+	SoftResetSkills(strength float64, edit SkillEdit) ([]SkillChange, error)
+
+	// GetSeasons returns every season from oldest to newest
+	GetSeasons() ([]Season, error)
+	// SaveSeason adds a new season or replaces the season with the same number
+	SaveSeason(season Season) error
+
+	// GetTeamConstraints returns the team constraints in the order they were added
+	GetTeamConstraints() ([]TeamConstraint, error)
+	// AddTeamConstraint adds a team constraint, replacing any constraint already between the pair
+	AddTeamConstraint(constraint TeamConstraint) error
+	RemoveTeamConstraint(userIDA, userIDB string) (removed bool, err error)
+
+	// SaveRoster saves the teams created for the current playing session, replacing any teams
+	// created earlier in the same session
+	SaveRoster(roster Roster) error
+	// GetRosters returns the rosters of the remembered playing sessions from most to least recent
+	GetRosters() ([]Roster, error)
+
+	// SaveTeams saves a set of generated teams, forgetting the oldest once there are too many
+	SaveTeams(record TeamsRecord) error
+	// UpdateLastTeams runs update on the most recently saved teams, such as to adjust them by hand,
+	// and saves them if it reports a change. Teams saved at the same time wait until the update is
+	// done. ok is false if no teams were saved.
+	UpdateLastTeams(update func(record *TeamsRecord) (changed bool)) (record TeamsRecord, ok bool, err error)
+	// GetTeamsHistory returns the remembered generated teams from most to least recent
+	GetTeamsHistory() ([]TeamsRecord, error)
+
+	// GetSchedule returns the saved schedule, ok is false if there is none
+	GetSchedule() (schedule Schedule, ok bool, err error)
+	SaveSchedule(schedule Schedule) error
+
+	// GetTournament returns the saved tournament, ok is false if there is none
+	GetTournament() (tournament Tournament, ok bool, err error)
+	SaveTournament(tournament Tournament) error
+
+	Close() error
+}
+
+const (
+	JSONBackend   = "json"
+	SQLiteBackend = "sqlite"
+)
+
+var storageBackend = JSONBackend
+
+// the directory holding the persistent data of every server, each in a directory of its own
+var dataDirectory = "persistentData"
+
+// SetStorageBackend selects how server data is stored. It should not be called after SetServerIDs.
+func SetStorageBackend(backend string) error {
+	switch backend {
+	case JSONBackend, SQLiteBackend:
+		storageBackend = backend
+		return nil
+	default:
+		return fmt.Errorf("invalid storage backend '%s'", backend)
+	}
+}
+
+// SetDataDirectory sets where server data is stored. It should not be called after SetServerIDs.
+func SetDataDirectory(dir string) {
+	dataDirectory = dir
+}
+
+type serverData struct {
+	Store
+	serverID string
+	// the number of interactions and drafts using the data, guarded by the lock of servers
+	users int
+	// whether spike was removed from the server, after which the data is closed once it is unused
+	removed bool
+}
+
+func newServerData(serverID string) (*serverData, error) {
+	serverDirectory := filepath.Join(dataDirectory, serverID)
+
+	var store Store
+	var err error
+	switch storageBackend {
+	case SQLiteBackend:
+		store, err = newSQLiteStore(serverDirectory)
+	default:
+		store = newJSONStore(serverDirectory)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data for server %s: %w", serverID, err)
+	}
+	return &serverData{Store: store, serverID: serverID}, nil
+}
+
+// the channels each server accepts commands in the first time it is opened, given at startup
+var seedChannels = map[string][]string{}
+
+// SetServerChannels sets the channels the server accepts commands in until they are chosen with
+// /config channels. It should not be called after SetServerIDs.
+func SetServerChannels(serverID string, channelIDs []string) {
+	seedChannels[serverID] = channelIDs
+}
+
+// the servers spike may serve besides any opened by SetServerIDs, or every server if allowAnyServer
+// is set
+var (
+	allowedServers = map[string]bool{}
+	allowAnyServer bool
+)
+
+// SetServerIDs allows spike to serve the servers and opens their data, so that any problem with it
+// is found at startup rather than by the first command
+func SetServerIDs(serverIDs []string) error {
+	for _, serverID := range serverIDs {
+		allowedServers[serverID] = true
+		if _, err := getServerData(serverID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AllowAnyServer sets whether spike serves every server it is invited to, rather than only the
+// servers given to SetServerIDs. It should not be called after adding handles which use server data.
+func AllowAnyServer(allow bool) {
+	allowAnyServer = allow
+}
+
+// IsServerAllowed returns whether spike may serve the server
+func IsServerAllowed(serverID string) bool {
+	return allowAnyServer || allowedServers[serverID]
+}
+
+// getServerData returns the data of the server, opening it the first time the server is used
+func getServerData(serverID string) (*serverData, error) {
+	if data, ok := servers.ReadSafe(serverID); ok {
+		return data, nil
+	}
+	var data *serverData
+	var err error
+	servers.WithLock(func(m map[string]*serverData) {
+		data, err = openServerData(m, serverID)
+	})
+	return data, err
+}
+
+// acquireServerData returns the data of the server like getServerData, and keeps it open even if
+// spike is removed from the server until release is called
+func acquireServerData(serverID string) (*serverData, error) {
+	var data *serverData
+	var err error
+	servers.WithLock(func(m map[string]*serverData) {
+		if data, err = openServerData(m, serverID); err == nil {
+			data.users++
+		}
+	})
+	return data, err
+}
+
+// acquire keeps the data open even if spike is removed from the server until release is called
+func (d *serverData) acquire() {
+	servers.WithLock(func(map[string]*serverData) {
+		d.users++
+	})
+}
+
+// release stops using the data, closing it if spike was removed from the server and nothing else
+// is using it
+func (d *serverData) release() {
+	servers.WithLock(func(m map[string]*serverData) {
+		d.users--
+		if d.users == 0 && d.removed {
+			d.Close()
+			delete(m, d.serverID)
+		}
+	})
+}
+
+// openServerData returns the data of the server in m, opening it if it is not open yet. It must be
+// called with the lock of servers held.
+func openServerData(m map[string]*serverData, serverID string) (*serverData, error) {
+	if data, ok := m[serverID]; ok {
+		return data, nil
+	}
+	if !IsServerAllowed(serverID) {
+		return nil, fmt.Errorf("serverID not recognized: %s", serverID)
+	}
+
+	data, err := newServerData(serverID)
+	if err != nil {
+		return nil, err
+	}
+	if err := data.SeedChannels(seedChannels[serverID]); err != nil {
+		data.Close()
+		return nil, err
+	}
+	m[serverID] = data
+	return data, nil
+}
+
+// OpenServer opens the data of a server spike has been invited to, failing if it is not allowed.
+// If spike was removed from the server while the data was still in use, the open data is kept.
+func OpenServer(serverID string) error {
+	var err error
+	servers.WithLock(func(m map[string]*serverData) {
+		var data *serverData
+		if data, err = openServerData(m, serverID); err == nil {
+			data.removed = false
+		}
+	})
+	return err
+}
+
+// CloseServer releases the storage of a server spike was removed from once no interaction or draft
+// is using it. Its data is kept, and is opened again if spike is invited back.
+func CloseServer(serverID string) {
+	servers.WithLock(func(m map[string]*serverData) {
+		data, ok := m[serverID]
+		if !ok {
+			return
+		}
+		data.removed = true
+		if data.users == 0 {
+			data.Close()
+			delete(m, serverID)
+		}
+	})
+}
+
+// CloseServers releases the storage of every server being serviced
+func CloseServers() {
+	servers.WithLock(func(m map[string]*serverData) {
+		for _, data := range m {
+			data.Close()
+		}
+	})
+}
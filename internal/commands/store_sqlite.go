@@ -0,0 +1,1413 @@
+package commands
+
+// This file contains the SQLite implementation of Store. Each server's data is kept in a single
+// database file, and every operation touching more than one row runs in a transaction so that it
+// is applied atomically.
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+)
+
+const sqliteFileName = "spike.db"
+
+// sqliteMigrations are applied in order to bring a database up to date. The number of migrations
+// already applied is kept in the database's user_version.
+var sqliteMigrations = []string{`
+CREATE TABLE IF NOT EXISTS settings (
+	id   INTEGER PRIMARY KEY CHECK (id = 1),
+	data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS players (
+	id           TEXT PRIMARY KEY,
+	name         TEXT NOT NULL,
+	skill        INTEGER NOT NULL,
+	signed       INTEGER NOT NULL,
+	rating_mu    REAL NOT NULL DEFAULT 0,
+	rating_sigma REAL NOT NULL DEFAULT 0,
+	rating_games INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS playing (
+	id TEXT PRIMARY KEY
+);
+CREATE TABLE IF NOT EXISTS matches (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	time         INTEGER NOT NULL,
+	winners      TEXT NOT NULL,
+	losers       TEXT NOT NULL,
+	winner_score INTEGER NOT NULL,
+	loser_score  INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS skill_history (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id      TEXT NOT NULL,
+	actor_id     TEXT NOT NULL,
+	actor_name   TEXT NOT NULL,
+	skill_before INTEGER NOT NULL,
+	skill_after  INTEGER NOT NULL,
+	time         INTEGER NOT NULL,
+	reason       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS skill_history_user_id ON skill_history (user_id);
+`, `
+ALTER TABLE playing ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE playing ADD COLUMN waitlisted INTEGER NOT NULL DEFAULT 0;
+`, `
+CREATE TABLE IF NOT EXISTS maybe (
+	id       TEXT PRIMARY KEY,
+	position INTEGER NOT NULL
+);
+`, `
+ALTER TABLE players ADD COLUMN primary_position TEXT NOT NULL DEFAULT '';
+ALTER TABLE players ADD COLUMN secondary_position TEXT NOT NULL DEFAULT '';
+`, `
+CREATE TABLE IF NOT EXISTS team_constraints (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	kind      TEXT NOT NULL,
+	user_id_a TEXT NOT NULL,
+	user_id_b TEXT NOT NULL
+);
+`, `
+CREATE TABLE IF NOT EXISTS rosters (
+	id    INTEGER PRIMARY KEY AUTOINCREMENT,
+	time  INTEGER NOT NULL,
+	teams TEXT NOT NULL
+);
+`, `
+CREATE TABLE IF NOT EXISTS teams_history (
+	id     INTEGER PRIMARY KEY AUTOINCREMENT,
+	record TEXT NOT NULL
+);
+`, `
+CREATE TABLE IF NOT EXISTS schedule (
+	id   INTEGER PRIMARY KEY CHECK (id = 1),
+	data TEXT NOT NULL
+);
+`, `
+CREATE TABLE IF NOT EXISTS tournament (
+	id   INTEGER PRIMARY KEY CHECK (id = 1),
+	data TEXT NOT NULL
+);
+`, `
+ALTER TABLE players ADD COLUMN sessions INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE players ADD COLUMN last_played INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE players ADD COLUMN session_streak INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE players ADD COLUMN longest_session_streak INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE players ADD COLUMN wins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE players ADD COLUMN losses INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE players ADD COLUMN match_streak INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE players ADD COLUMN longest_win_streak INTEGER NOT NULL DEFAULT 0;
+`, `
+CREATE TABLE IF NOT EXISTS attendance (
+	id      INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id TEXT NOT NULL,
+	time    INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS attendance_time ON attendance (time);
+CREATE TABLE IF NOT EXISTS seasons (
+	number INTEGER PRIMARY KEY,
+	data   TEXT NOT NULL
+);
+`, `
+ALTER TABLE matches ADD COLUMN rating_changes TEXT NOT NULL DEFAULT '{}';
+`, `
+ALTER TABLE matches ADD COLUMN interaction_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS matches_interaction_id ON matches (interaction_id);
+`}
+
+const playerColumns = "id, name, skill, signed, rating_mu, rating_sigma, rating_games, " +
+	"primary_position, secondary_position, sessions, last_played, session_streak, " +
+	"longest_session_streak, wins, losses, match_streak, longest_win_streak"
+const qualifiedPlayerColumns = "players.id, players.name, players.skill, players.signed, " +
+	"players.rating_mu, players.rating_sigma, players.rating_games, " +
+	"players.primary_position, players.secondary_position, players.sessions, " +
+	"players.last_played, players.session_streak, players.longest_session_streak, " +
+	"players.wins, players.losses, players.match_streak, players.longest_win_streak"
+
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// sqlQuerier is implemented by both *sql.DB and *sql.Tx
+type sqlQuerier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+type sqlScanner interface {
+	Scan(dest ...any) error
+}
+
+func newSQLiteStore(serverDirectory string) (*sqliteStore, error) {
+	if err := os.MkdirAll(serverDirectory, os.ModePerm); err != nil {
+		return nil, err
+	}
+	dbPath := filepath.Join(serverDirectory, sqliteFileName)
+	// a server which was stored by the JSON backend until now has its data imported into the new
+	// database, so that switching backends does not start it over
+	_, statErr := os.Stat(dbPath)
+	importJSON := errors.Is(statErr, os.ErrNotExist) && hasJSONData(serverDirectory)
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	// A single connection serializes transactions, so concurrent commands never see a busy database.
+	// This means queries inside a transaction must go through the transaction, not through db.
+	db.SetMaxOpenConns(1)
+	store := &sqliteStore{db: db}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if importJSON {
+		if err := store.importJSON(newJSONStore(serverDirectory)); err != nil {
+			db.Close()
+			// the import is tried again from the start the next time the server is opened
+			os.Remove(dbPath)
+			return nil, fmt.Errorf("failed to import the JSON data in %s: %w", serverDirectory, err)
+		}
+		log.Infof("Imported the JSON data in %s into %s, the JSON files are no longer used", serverDirectory, sqliteFileName)
+	}
+	return store, nil
+}
+
+// hasJSONData reports whether the server directory holds data saved by the JSON backend
+func hasJSONData(serverDirectory string) bool {
+	for _, fileName := range jsonFileNames {
+		if _, err := os.Stat(filepath.Join(serverDirectory, fileName+".json")); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// loadJSONObject returns the object saved by the JSON backend, or a new one if it was never saved
+func loadJSONObject[T any](p *persistentObject[T]) (T, error) {
+	var object T
+	err := p.WithLock(func(o T) (dirty bool) {
+		object = o
+		return false
+	})
+	return object, err
+}
+
+// importJSON copies every object saved by the JSON backend into the database in one transaction
+func (d *sqliteStore) importJSON(j *jsonStore) error {
+	settings, err := loadJSONObject(&j.Settings)
+	if err != nil {
+		return err
+	}
+	players, err := loadJSONObject(&j.Players)
+	if err != nil {
+		return err
+	}
+	playing, err := loadJSONObject(&j.Playing)
+	if err != nil {
+		return err
+	}
+	matches, err := loadJSONObject(&j.Matches)
+	if err != nil {
+		return err
+	}
+	skillHistory, err := loadJSONObject(&j.SkillHistory)
+	if err != nil {
+		return err
+	}
+	constraints, err := loadJSONObject(&j.Constraints)
+	if err != nil {
+		return err
+	}
+	rosters, err := loadJSONObject(&j.Rosters)
+	if err != nil {
+		return err
+	}
+	teamsHistory, err := loadJSONObject(&j.TeamsHistory)
+	if err != nil {
+		return err
+	}
+	schedule, err := loadJSONObject(&j.Schedule)
+	if err != nil {
+		return err
+	}
+	tournament, err := loadJSONObject(&j.Tournament)
+	if err != nil {
+		return err
+	}
+	attendance, err := loadJSONObject(&j.Attendance)
+	if err != nil {
+		return err
+	}
+	seasons, err := loadJSONObject(&j.Seasons)
+	if err != nil {
+		return err
+	}
+
+	return d.withTx(func(tx *sql.Tx) error {
+		if err := saveSQLSettings(tx, *settings); err != nil {
+			return err
+		}
+		for userID, player := range players {
+			player.ID = userID
+			if _, err := tx.Exec(`INSERT INTO players (id, name, skill, signed) VALUES (?, ?, ?, ?)`,
+				userID, player.Name, player.Skill, player.Signed); err != nil {
+				return err
+			}
+			if err := updateSQLPlayer(tx, player); err != nil {
+				return err
+			}
+		}
+
+		position := 0
+		for i, group := range [][]string{playing.Playing, playing.Waitlist} {
+			for _, userID := range group {
+				position++
+				if _, err := tx.Exec(`INSERT INTO playing (id, position, waitlisted) VALUES (?, ?, ?)`,
+					userID, position, i == 1); err != nil {
+					return err
+				}
+			}
+		}
+		for i, userID := range playing.Maybe {
+			if _, err := tx.Exec(`INSERT INTO maybe (id, position) VALUES (?, ?)`, userID, i+1); err != nil {
+				return err
+			}
+		}
+
+		for _, match := range *matches {
+			if err := insertSQLMatch(tx, match); err != nil {
+				return err
+			}
+		}
+		for _, entry := range *skillHistory {
+			_, err := tx.Exec(`INSERT INTO skill_history (user_id, actor_id, actor_name, skill_before, skill_after, time, reason)
+				VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				entry.UserID, entry.ActorID, entry.ActorName, entry.Before, entry.After, entry.Time.UnixNano(), entry.Reason)
+			if err != nil {
+				return err
+			}
+		}
+		for _, c := range *constraints {
+			if _, err := tx.Exec(`INSERT INTO team_constraints (kind, user_id_a, user_id_b) VALUES (?, ?, ?)`,
+				c.Kind, c.UserIDs[0], c.UserIDs[1]); err != nil {
+				return err
+			}
+		}
+		for _, roster := range *rosters {
+			teamsData, err := json.Marshal(roster.Teams)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT INTO rosters (time, teams) VALUES (?, ?)`, roster.Time.UnixNano(), string(teamsData)); err != nil {
+				return err
+			}
+		}
+		for _, record := range *teamsHistory {
+			recordData, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT INTO teams_history (record) VALUES (?)`, string(recordData)); err != nil {
+				return err
+			}
+		}
+		for _, entry := range *attendance {
+			if _, err := tx.Exec(`INSERT INTO attendance (user_id, time) VALUES (?, ?)`, entry.UserID, entry.Time.UnixNano()); err != nil {
+				return err
+			}
+		}
+		for _, season := range *seasons {
+			data, err := json.Marshal(season)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT INTO seasons (number, data) VALUES (?, ?)`, season.Number, string(data)); err != nil {
+				return err
+			}
+		}
+
+		scheduleData, err := json.Marshal(schedule)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO schedule (id, data) VALUES (1, ?)`, string(scheduleData)); err != nil {
+			return err
+		}
+		tournamentData, err := json.Marshal(tournament)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO tournament (id, data) VALUES (1, ?)`, string(tournamentData))
+		return err
+	})
+}
+
+func (d *sqliteStore) migrate() error {
+	var version int
+	if err := d.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(sqliteMigrations); version++ {
+		err := d.withTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(sqliteMigrations[version]); err != nil {
+				return err
+			}
+			_, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply database migration %d: %w", version+1, err)
+		}
+	}
+	return nil
+}
+
+func (d *sqliteStore) Close() error {
+	return d.db.Close()
+}
+
+// withTx runs do inside a transaction which is committed if do succeeds and rolled back otherwise
+func (d *sqliteStore) withTx(do func(tx *sql.Tx) error) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := do(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func getSQLSettings(q sqlQuerier) (Settings, error) {
+	var settings Settings
+	var data string
+	err := q.QueryRow(`SELECT data FROM settings WHERE id = 1`).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+	err = json.Unmarshal([]byte(data), &settings)
+	return settings, err
+}
+
+func (d *sqliteStore) GetSettings() (Settings, error) {
+	return getSQLSettings(d.db)
+}
+
+// updateSettings applies update to the saved settings
+func (d *sqliteStore) updateSettings(update func(s *Settings)) error {
+	return d.withTx(func(tx *sql.Tx) error {
+		settings, err := getSQLSettings(tx)
+		if err != nil {
+			return err
+		}
+		update(&settings)
+		return saveSQLSettings(tx, settings)
+	})
+}
+
+func saveSQLSettings(q sqlQuerier, settings Settings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`INSERT INTO settings (id, data) VALUES (1, ?)
+		ON CONFLICT (id) DO UPDATE SET data = excluded.data`, string(data))
+	return err
+}
+
+func (d *sqliteStore) SetSignatureRequirement(isRequired bool) error {
+	return d.updateSettings(func(s *Settings) {
+		s.RequireSignatures = isRequired
+	})
+}
+
+func (d *sqliteStore) SetCommandPermission(command string, rule PermissionRule) error {
+	return d.updateSettings(func(s *Settings) {
+		s.setCommandPermission(command, rule)
+	})
+}
+
+func (d *sqliteStore) SeedChannels(channelIDs []string) error {
+	return d.updateSettings(func(s *Settings) {
+		s.seedChannels(channelIDs)
+	})
+}
+
+func (d *sqliteStore) SetAllChannelsAllowed(allowed bool) error {
+	return d.updateSettings(func(s *Settings) {
+		s.AllChannels = allowed
+		s.ChannelsConfigured = true
+	})
+}
+
+func (d *sqliteStore) SetChannelAllowed(channelID string, allowed bool) (changed bool, err error) {
+	err = d.updateSettings(func(s *Settings) {
+		changed = s.setChannelAllowed(channelID, allowed)
+	})
+	return changed, err
+}
+
+func scanPlayer(row sqlScanner) (Player, error) {
+	var p Player
+	var lastPlayed int64
+	err := row.Scan(&p.ID, &p.Name, &p.Skill, &p.Signed, &p.Rating.Mu, &p.Rating.Sigma, &p.Rating.Games,
+		&p.Position, &p.SecondaryPosition, &p.Stats.Sessions, &lastPlayed, &p.Stats.SessionStreak,
+		&p.Stats.LongestSessionStreak, &p.Stats.Wins, &p.Stats.Losses, &p.Stats.MatchStreak,
+		&p.Stats.LongestWinStreak)
+	// a player who has not attended a session is stored with a last played time of 0
+	if lastPlayed != 0 {
+		p.Stats.LastPlayed = time.Unix(0, lastPlayed)
+	}
+	return p, err
+}
+
+func getSQLPlayer(q sqlQuerier, userID string) (Player, bool, error) {
+	player, err := scanPlayer(q.QueryRow(`SELECT `+playerColumns+` FROM players WHERE id = ?`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Player{}, false, nil
+	}
+	if err != nil {
+		return Player{}, false, err
+	}
+	return player, true, nil
+}
+
+func queryPlayers(q sqlQuerier, query string, args ...any) ([]Player, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var players []Player
+	for rows.Next() {
+		player, err := scanPlayer(rows)
+		if err != nil {
+			return nil, err
+		}
+		players = append(players, player)
+	}
+	return players, rows.Err()
+}
+
+func updateSQLPlayer(q sqlQuerier, player Player) error {
+	var lastPlayed int64
+	if !player.Stats.LastPlayed.IsZero() {
+		lastPlayed = player.Stats.LastPlayed.UnixNano()
+	}
+	stats := player.Stats
+	_, err := q.Exec(`UPDATE players SET name = ?, skill = ?, signed = ?, rating_mu = ?, rating_sigma = ?, rating_games = ?,
+		primary_position = ?, secondary_position = ?, sessions = ?, last_played = ?, session_streak = ?,
+		longest_session_streak = ?, wins = ?, losses = ?, match_streak = ?, longest_win_streak = ? WHERE id = ?`,
+		player.Name, player.Skill, player.Signed, player.Rating.Mu, player.Rating.Sigma, player.Rating.Games,
+		player.Position, player.SecondaryPosition, stats.Sessions, lastPlayed, stats.SessionStreak,
+		stats.LongestSessionStreak, stats.Wins, stats.Losses, stats.MatchStreak, stats.LongestWinStreak, player.ID)
+	return err
+}
+
+func (d *sqliteStore) LoadUserName(userID string) (string, bool, error) {
+	player, ok, err := getSQLPlayer(d.db, userID)
+	return player.Name, ok, err
+}
+
+func (d *sqliteStore) SaveUserName(userID string, name string) error {
+	_, err := d.db.Exec(`INSERT INTO players (id, name, skill, signed) VALUES (?, ?, -1, FALSE)
+		ON CONFLICT (id) DO NOTHING`, userID, name)
+	return err
+}
+
+func (d *sqliteStore) DeleteUsers(userIDs ...string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	missingIDs := 0
+	err := d.withTx(func(tx *sql.Tx) error {
+		// Remove from playing group before deleting from database
+		if _, _, err := removeSQLPlayingUsers(tx, userIDs...); err != nil {
+			return err
+		}
+		for _, userID := range userIDs {
+			result, err := tx.Exec(`DELETE FROM players WHERE id = ?`, userID)
+			if err != nil {
+				return err
+			}
+			if deleted, err := result.RowsAffected(); err != nil {
+				return err
+			} else if deleted == 0 {
+				missingIDs++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	switch missingIDs {
+	case 0:
+		return nil
+	case 1:
+		return errors.New("could not delete user: ID not found")
+	default:
+		return fmt.Errorf("could not delete %d users: ID not found", missingIDs)
+	}
+}
+
+func (d *sqliteStore) GetPlayer(userID string) (Player, bool, error) {
+	return getSQLPlayer(d.db, userID)
+}
+
+func (d *sqliteStore) GetPlayers() (map[string]Player, error) {
+	players, err := queryPlayers(d.db, `SELECT `+playerColumns+` FROM players`)
+	if err != nil {
+		return nil, err
+	}
+	playerMap := make(map[string]Player, len(players))
+	for _, player := range players {
+		playerMap[player.ID] = player
+	}
+	return playerMap, nil
+}
+
+func (d *sqliteStore) UpdatePlayerNames(nameMap map[string]string) error {
+	return d.withTx(func(tx *sql.Tx) error {
+		for userID, name := range nameMap {
+			if _, err := tx.Exec(`UPDATE players SET name = ? WHERE id = ?`, name, userID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *sqliteStore) UpdatePlayerSignatures(userIDs []string, signed bool) error {
+	missingIDs := 0
+	err := d.withTx(func(tx *sql.Tx) error {
+		for _, userID := range userIDs {
+			result, err := tx.Exec(`UPDATE players SET signed = ? WHERE id = ?`, signed, userID)
+			if err != nil {
+				return err
+			}
+			if updated, err := result.RowsAffected(); err != nil {
+				return err
+			} else if updated == 0 {
+				missingIDs++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	switch missingIDs {
+	case 0:
+		return nil
+	case 1:
+		return errors.New("could modify user: ID not found")
+	default:
+		return fmt.Errorf("could not modify %d users: ID not found", missingIDs)
+	}
+}
+
+func (d *sqliteStore) SaveGuest(guestID, guestName string, skill int, signed bool) error {
+	return d.withTx(func(tx *sql.Tx) error {
+		if _, ok, err := getSQLPlayer(tx, guestID); err != nil {
+			return err
+		} else if ok {
+			return fmt.Errorf("cannot save guest \"%s\": ID already in use", guestName)
+		}
+		_, err := tx.Exec(`INSERT INTO players (id, name, skill, signed) VALUES (?, ?, ?, ?)`, guestID, guestName, skill, signed)
+		return err
+	})
+}
+
+func (d *sqliteStore) RenamePlayer(guestID, guestName string) error {
+	result, err := d.db.Exec(`UPDATE players SET name = ? WHERE id = ?`, guestName, guestID)
+	if err != nil {
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return fmt.Errorf("guest with id %s not found", guestID)
+	}
+	return nil
+}
+
+func (d *sqliteStore) AddPlayingUsers(userIDs ...string) (waitlisted []string, err error) {
+	err = d.withTx(func(tx *sql.Tx) error {
+		settings, err := getSQLSettings(tx)
+		if err != nil {
+			return err
+		}
+		var playing int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM playing WHERE NOT waitlisted`).Scan(&playing); err != nil {
+			return err
+		}
+		for _, userID := range userIDs {
+			if _, err := tx.Exec(`DELETE FROM maybe WHERE id = ?`, userID); err != nil {
+				return err
+			}
+			isWaitlisted := settings.MaxPlayers > 0 && playing >= settings.MaxPlayers
+			result, err := tx.Exec(`INSERT INTO playing (id, position, waitlisted)
+				VALUES (?, (SELECT COALESCE(MAX(position), 0) + 1 FROM playing), ?)
+				ON CONFLICT (id) DO NOTHING`, userID, isWaitlisted)
+			if err != nil {
+				return err
+			}
+			if added, err := result.RowsAffected(); err != nil {
+				return err
+			} else if added == 0 {
+				continue
+			}
+			if isWaitlisted {
+				waitlisted = append(waitlisted, userID)
+			} else {
+				playing++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return waitlisted, nil
+}
+
+func (d *sqliteStore) RemovePlayingUsers(userIDs ...string) (removed, promoted []string, err error) {
+	err = d.withTx(func(tx *sql.Tx) error {
+		removed, promoted, err = removeSQLPlayingUsers(tx, userIDs...)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return removed, promoted, nil
+}
+
+// removeSQLPlayingUsers takes the users out of the playing group, waitlist and maybe list, then
+// fills any opened spots from the waitlist. removed holds the users which were in any of them.
+func removeSQLPlayingUsers(tx *sql.Tx, userIDs ...string) (removed, promoted []string, err error) {
+	for _, userID := range userIDs {
+		deleted := int64(0)
+		for _, query := range []string{`DELETE FROM playing WHERE id = ?`, `DELETE FROM maybe WHERE id = ?`} {
+			result, err := tx.Exec(query, userID)
+			if err != nil {
+				return nil, nil, err
+			}
+			count, err := result.RowsAffected()
+			if err != nil {
+				return nil, nil, err
+			}
+			deleted += count
+		}
+		if deleted > 0 {
+			removed = append(removed, userID)
+		}
+	}
+	settings, err := getSQLSettings(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	promoted, err = promoteSQLWaitlist(tx, settings.MaxPlayers)
+	if err != nil {
+		return nil, nil, err
+	}
+	return removed, promoted, nil
+}
+
+// promoteSQLWaitlist moves users from the front of the waitlist into the playing group until it is
+// full. A maxPlayers of 0 means there is no limit.
+func promoteSQLWaitlist(tx *sql.Tx, maxPlayers int) (promoted []string, err error) {
+	var playing int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM playing WHERE NOT waitlisted`).Scan(&playing); err != nil {
+		return nil, err
+	}
+	for maxPlayers <= 0 || playing < maxPlayers {
+		var userID string
+		err := tx.QueryRow(`SELECT id FROM playing WHERE waitlisted ORDER BY position LIMIT 1`).Scan(&userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// promoted users join the end of the playing group
+		_, err = tx.Exec(`UPDATE playing SET waitlisted = FALSE, position = (SELECT MAX(position) + 1 FROM playing)
+			WHERE id = ?`, userID)
+		if err != nil {
+			return nil, err
+		}
+		promoted = append(promoted, userID)
+		playing++
+	}
+	return promoted, nil
+}
+
+func (d *sqliteStore) MarkPlayingMaybe(userID string) (promoted []string, err error) {
+	err = d.withTx(func(tx *sql.Tx) error {
+		var isMaybe bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM maybe WHERE id = ?)`, userID).Scan(&isMaybe); err != nil {
+			return err
+		}
+		if isMaybe {
+			return nil
+		}
+		if _, promoted, err = removeSQLPlayingUsers(tx, userID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO maybe (id, position) VALUES (?, (SELECT COALESCE(MAX(position), 0) + 1 FROM maybe))`, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return promoted, nil
+}
+
+func (d *sqliteStore) ClearPlayingUsers() error {
+	return d.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM playing`); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM maybe`)
+		return err
+	})
+}
+
+func (d *sqliteStore) SetMaxPlayers(maxPlayers int) (promoted []string, err error) {
+	err = d.withTx(func(tx *sql.Tx) error {
+		settings, err := getSQLSettings(tx)
+		if err != nil {
+			return err
+		}
+		settings.MaxPlayers = maxPlayers
+		if err := saveSQLSettings(tx, settings); err != nil {
+			return err
+		}
+		promoted, err = promoteSQLWaitlist(tx, maxPlayers)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return promoted, nil
+}
+
+func (d *sqliteStore) GetPlaying() ([]Player, error) {
+	return d.getPlayingGroup(false)
+}
+
+func (d *sqliteStore) GetWaitlist() ([]Player, error) {
+	return d.getPlayingGroup(true)
+}
+
+// getPlayingGroup returns either the players in the playing group or on the waitlist in the order
+// they joined
+func (d *sqliteStore) getPlayingGroup(waitlisted bool) ([]Player, error) {
+	var groupPlayers []Player
+	err := d.withTx(func(tx *sql.Tx) error {
+		var count int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM playing WHERE waitlisted = ?`, waitlisted).Scan(&count); err != nil {
+			return err
+		}
+		players, err := queryPlayers(tx, `SELECT `+qualifiedPlayerColumns+` FROM players
+			JOIN playing ON playing.id = players.id WHERE playing.waitlisted = ? ORDER BY playing.position`, waitlisted)
+		if err != nil {
+			return err
+		}
+		if len(players) != count {
+			if waitlisted {
+				return errors.New("waitlisted userID not found in list of players")
+			}
+			return errors.New("playing userID not found in list of players")
+		}
+		groupPlayers = players
+		return nil
+	})
+	return groupPlayers, err
+}
+
+func (d *sqliteStore) GetMaybe() ([]Player, error) {
+	var maybePlayers []Player
+	err := d.withTx(func(tx *sql.Tx) error {
+		var count int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM maybe`).Scan(&count); err != nil {
+			return err
+		}
+		players, err := queryPlayers(tx, `SELECT `+qualifiedPlayerColumns+` FROM players
+			JOIN maybe ON maybe.id = players.id ORDER BY maybe.position`)
+		if err != nil {
+			return err
+		}
+		if len(players) != count {
+			return errors.New("maybe userID not found in list of players")
+		}
+		maybePlayers = players
+		return nil
+	})
+	return maybePlayers, err
+}
+
+func (d *sqliteStore) GetPlayingCount() (playing, waitlisted int, err error) {
+	err = d.db.QueryRow(`SELECT COUNT(*) FILTER (WHERE NOT waitlisted), COUNT(*) FILTER (WHERE waitlisted) FROM playing`).
+		Scan(&playing, &waitlisted)
+	return playing, waitlisted, err
+}
+
+func (d *sqliteStore) SetPlayerPositions(userID, primary, secondary string) error {
+	result, err := d.db.Exec(`UPDATE players SET primary_position = ?, secondary_position = ? WHERE id = ?`,
+		primary, secondary, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New("userID not found in list of players")
+	}
+	return nil
+}
+
+// updateSQLPlayerSkill sets a player's skill rank to the result of update and records the change
+func updateSQLPlayerSkill(tx *sql.Tx, userID string, update func(skill int) int, edit SkillEdit) (prev, new int, err error) {
+	player, ok, err := getSQLPlayer(tx, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !ok {
+		return 0, 0, errors.New("userID not found in list of players")
+	}
+	prev = player.Skill
+	player.Skill = update(prev)
+	player.Rating = player.Rating.withSkill(player.Skill)
+	if err := updateSQLPlayer(tx, player); err != nil {
+		return 0, 0, err
+	}
+	change := SkillChange{UserID: userID, Name: player.Name, Before: prev, After: player.Skill}
+	if err := insertSQLSkillHistory(tx, edit, change); err != nil {
+		return 0, 0, err
+	}
+	return prev, player.Skill, nil
+}
+
+func (d *sqliteStore) SetPlayerSkill(userID string, skill int, edit SkillEdit) error {
+	return d.withTx(func(tx *sql.Tx) error {
+		_, _, err := updateSQLPlayerSkill(tx, userID, func(int) int { return skill }, edit)
+		return err
+	})
+}
+
+func (d *sqliteStore) ModifyPlayerSkill(userID string, diff int, edit SkillEdit) (prev, new int, err error) {
+	err = d.withTx(func(tx *sql.Tx) error {
+		prev, new, err = updateSQLPlayerSkill(tx, userID, func(skill int) int {
+			skill += diff
+			if skill > 99 {
+				return 99
+			} else if skill < 0 {
+				return 0
+			}
+			return skill
+		}, edit)
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return prev, new, nil
+}
+
+// insertSQLSkillHistory adds an entry to the skill history for each change which modified a skill
+// rank
+func insertSQLSkillHistory(tx *sql.Tx, edit SkillEdit, changes ...SkillChange) error {
+	now := time.Now()
+	for _, change := range changes {
+		if change.Before == change.After {
+			continue
+		}
+		_, err := tx.Exec(`INSERT INTO skill_history (user_id, actor_id, actor_name, skill_before, skill_after, time, reason)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			change.UserID, edit.ActorID, edit.ActorName, change.Before, change.After, now.UnixNano(), edit.Reason)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func querySkillHistory(q sqlQuerier, query string, args ...any) ([]SkillHistoryEntry, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []SkillHistoryEntry
+	for rows.Next() {
+		var entry SkillHistoryEntry
+		var timestamp int64
+		err := rows.Scan(&entry.UserID, &entry.ActorID, &entry.ActorName, &entry.Before, &entry.After, &timestamp, &entry.Reason)
+		if err != nil {
+			return nil, err
+		}
+		entry.Time = time.Unix(0, timestamp)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+const skillHistoryQuery = `SELECT user_id, actor_id, actor_name, skill_before, skill_after, time, reason
+	FROM skill_history WHERE user_id = ? ORDER BY id DESC`
+
+func (d *sqliteStore) GetSkillHistory(userID string) ([]SkillHistoryEntry, error) {
+	return querySkillHistory(d.db, skillHistoryQuery, userID)
+}
+
+func (d *sqliteStore) RevertSkillChange(userID string, entryNum int, edit SkillEdit) (SkillHistoryEntry, error) {
+	var reverted SkillHistoryEntry
+	err := d.withTx(func(tx *sql.Tx) error {
+		entries, err := querySkillHistory(tx, skillHistoryQuery, userID)
+		if err != nil {
+			return err
+		}
+		if entryNum > len(entries) {
+			return fmt.Errorf("skill history only contains %d changes", len(entries))
+		}
+		reverted = entries[entryNum-1]
+		_, _, err = updateSQLPlayerSkill(tx, userID, func(int) int { return reverted.Before }, edit)
+		return err
+	})
+	if err != nil {
+		return SkillHistoryEntry{}, err
+	}
+	return reverted, nil
+}
+
+func (d *sqliteStore) RecordMatch(match Match, edit SkillEdit) (winners, losers []SkillChange, err error) {
+	err = d.withTx(func(tx *sql.Tx) error {
+		if reported, err := isSQLMatchReported(tx, match); err != nil {
+			return err
+		} else if reported {
+			return errRepeatedMatch
+		}
+
+		players := map[string]Player{}
+		for _, userID := range append(append([]string{}, match.Winners...), match.Losers...) {
+			player, ok, err := getSQLPlayer(tx, userID)
+			if err != nil {
+				return err
+			}
+			if ok {
+				players[userID] = player
+			}
+		}
+
+		winners, losers = rateMatch(players, &match)
+		if len(winners) == 0 || len(losers) == 0 {
+			return errors.New("could not record match: teams no longer contain any saved players with a skill rank")
+		}
+
+		if err := insertSQLMatch(tx, match); err != nil {
+			return err
+		}
+
+		for _, player := range players {
+			if err := updateSQLPlayer(tx, player); err != nil {
+				return err
+			}
+		}
+		return insertSQLSkillHistory(tx, edit, append(append([]SkillChange{}, winners...), losers...)...)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return winners, losers, nil
+}
+
+func insertSQLMatch(tx *sql.Tx, match Match) error {
+	winnerData, err := json.Marshal(match.Winners)
+	if err != nil {
+		return err
+	}
+	loserData, err := json.Marshal(match.Losers)
+	if err != nil {
+		return err
+	}
+	changeData, err := json.Marshal(match.RatingChanges)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO matches (time, winners, losers, winner_score, loser_score, rating_changes, interaction_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		match.Time.UnixNano(), string(winnerData), string(loserData), match.WinnerScore, match.LoserScore, string(changeData),
+		match.InteractionID)
+	return err
+}
+
+// isSQLMatchReported returns whether the match was already recorded from the same interaction
+func isSQLMatchReported(q sqlQuerier, match Match) (bool, error) {
+	if match.InteractionID == "" {
+		return false, nil
+	}
+	var reported bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM matches WHERE interaction_id = ?)`, match.InteractionID).Scan(&reported)
+	return reported, err
+}
+
+func (d *sqliteStore) RecordAttendance(userIDs []string, attended time.Time) error {
+	return d.withTx(func(tx *sql.Tx) error {
+		players, err := queryPlayers(tx, `SELECT `+playerColumns+` FROM players`)
+		if err != nil {
+			return err
+		}
+		playerMap := make(map[string]Player, len(players))
+		for _, player := range players {
+			playerMap[player.ID] = player
+		}
+		for _, userID := range recordAttendance(playerMap, userIDs, attended) {
+			if err := updateSQLPlayer(tx, playerMap[userID]); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO attendance (user_id, time) VALUES (?, ?)`, userID, attended.UnixNano())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// sqlSince converts the start of a time window to a timestamp, the zero time including everything
+func sqlSince(since time.Time) int64 {
+	if since.IsZero() {
+		return math.MinInt64
+	}
+	return since.UnixNano()
+}
+
+func (d *sqliteStore) GetAttendance(since time.Time) ([]AttendanceEntry, error) {
+	rows, err := d.db.Query(`SELECT user_id, time FROM attendance WHERE time >= ? ORDER BY id`, sqlSince(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attendance []AttendanceEntry
+	for rows.Next() {
+		var entry AttendanceEntry
+		var timestamp int64
+		if err := rows.Scan(&entry.UserID, &timestamp); err != nil {
+			return nil, err
+		}
+		entry.Time = time.Unix(0, timestamp)
+		attendance = append(attendance, entry)
+	}
+	return attendance, rows.Err()
+}
+
+func (d *sqliteStore) GetMatches(since time.Time) ([]Match, error) {
+	rows, err := d.db.Query(`SELECT time, winners, losers, winner_score, loser_score, rating_changes, interaction_id FROM matches
+		WHERE time >= ? ORDER BY id`, sqlSince(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []Match
+	for rows.Next() {
+		var match Match
+		var timestamp int64
+		var winnerData, loserData, changeData string
+		if err := rows.Scan(&timestamp, &winnerData, &loserData, &match.WinnerScore, &match.LoserScore, &changeData, &match.InteractionID); err != nil {
+			return nil, err
+		}
+		match.Time = time.Unix(0, timestamp)
+		if err := json.Unmarshal([]byte(winnerData), &match.Winners); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(loserData), &match.Losers); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changeData), &match.RatingChanges); err != nil {
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+	return matches, rows.Err()
+}
+
+func (d *sqliteStore) SoftResetSkills(strength float64, edit SkillEdit) (changes []SkillChange, err error) {
+	err = d.withTx(func(tx *sql.Tx) error {
+		players, err := queryPlayers(tx, `SELECT `+playerColumns+` FROM players`)
+		if err != nil {
+			return err
+		}
+		playerMap := make(map[string]Player, len(players))
+		for _, player := range players {
+			playerMap[player.ID] = player
+		}
+		changes = softResetSkills(playerMap, strength)
+		for _, change := range changes {
+			if err := updateSQLPlayer(tx, playerMap[change.UserID]); err != nil {
+				return err
+			}
+		}
+		return insertSQLSkillHistory(tx, edit, changes...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (d *sqliteStore) GetSeasons() ([]Season, error) {
+	rows, err := d.db.Query(`SELECT data FROM seasons ORDER BY number`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var seasons []Season
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var season Season
+		if err := json.Unmarshal([]byte(data), &season); err != nil {
+			return nil, err
+		}
+		seasons = append(seasons, season)
+	}
+	return seasons, rows.Err()
+}
+
+func (d *sqliteStore) SaveSeason(season Season) error {
+	data, err := json.Marshal(season)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec(`INSERT INTO seasons (number, data) VALUES (?, ?)
+		ON CONFLICT (number) DO UPDATE SET data = excluded.data`, season.Number, string(data))
+	return err
+}
+
+func (d *sqliteStore) GetTeamConstraints() ([]TeamConstraint, error) {
+	rows, err := d.db.Query(`SELECT kind, user_id_a, user_id_b FROM team_constraints ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var constraints []TeamConstraint
+	for rows.Next() {
+		var c TeamConstraint
+		if err := rows.Scan(&c.Kind, &c.UserIDs[0], &c.UserIDs[1]); err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, c)
+	}
+	return constraints, rows.Err()
+}
+
+func deleteSQLTeamConstraint(q sqlQuerier, userIDA, userIDB string) (removed bool, err error) {
+	result, err := q.Exec(`DELETE FROM team_constraints
+		WHERE (user_id_a = ? AND user_id_b = ?) OR (user_id_a = ? AND user_id_b = ?)`,
+		userIDA, userIDB, userIDB, userIDA)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (d *sqliteStore) AddTeamConstraint(constraint TeamConstraint) error {
+	return d.withTx(func(tx *sql.Tx) error {
+		if _, err := deleteSQLTeamConstraint(tx, constraint.UserIDs[0], constraint.UserIDs[1]); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO team_constraints (kind, user_id_a, user_id_b) VALUES (?, ?, ?)`,
+			constraint.Kind, constraint.UserIDs[0], constraint.UserIDs[1])
+		return err
+	})
+}
+
+func (d *sqliteStore) RemoveTeamConstraint(userIDA, userIDB string) (removed bool, err error) {
+	return deleteSQLTeamConstraint(d.db, userIDA, userIDB)
+}
+
+func (d *sqliteStore) SaveRoster(roster Roster) error {
+	teamsData, err := json.Marshal(roster.Teams)
+	if err != nil {
+		return err
+	}
+	return d.withTx(func(tx *sql.Tx) error {
+		var id, timestamp int64
+		err := tx.QueryRow(`SELECT id, time FROM rosters ORDER BY id DESC LIMIT 1`).Scan(&id, &timestamp)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if err == nil && isSameSession(time.Unix(0, timestamp), roster.Time) {
+			if _, err := tx.Exec(`DELETE FROM rosters WHERE id = ?`, id); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(`INSERT INTO rosters (time, teams) VALUES (?, ?)`, roster.Time.UnixNano(), string(teamsData))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM rosters WHERE id NOT IN (SELECT id FROM rosters ORDER BY id DESC LIMIT ?)`,
+			rosterHistoryLength)
+		return err
+	})
+}
+
+func (d *sqliteStore) GetRosters() ([]Roster, error) {
+	rows, err := d.db.Query(`SELECT time, teams FROM rosters ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rosters []Roster
+	for rows.Next() {
+		var roster Roster
+		var timestamp int64
+		var teamsData string
+		if err := rows.Scan(&timestamp, &teamsData); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(teamsData), &roster.Teams); err != nil {
+			return nil, err
+		}
+		roster.Time = time.Unix(0, timestamp)
+		rosters = append(rosters, roster)
+	}
+	return rosters, rows.Err()
+}
+
+func (d *sqliteStore) SaveTeams(record TeamsRecord) error {
+	recordData, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return d.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`INSERT INTO teams_history (record) VALUES (?)`, string(recordData)); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM teams_history WHERE id NOT IN (SELECT id FROM teams_history ORDER BY id DESC LIMIT ?)`,
+			teamsHistoryLength)
+		return err
+	})
+}
+
+func (d *sqliteStore) UpdateLastTeams(update func(record *TeamsRecord) (changed bool)) (record TeamsRecord, ok bool, err error) {
+	err = d.withTx(func(tx *sql.Tx) error {
+		var id int64
+		var recordData string
+		err := tx.QueryRow(`SELECT id, record FROM teams_history ORDER BY id DESC LIMIT 1`).Scan(&id, &recordData)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ok = true
+		if err := json.Unmarshal([]byte(recordData), &record); err != nil {
+			return err
+		}
+		if !update(&record) {
+			return nil
+		}
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE teams_history SET record = ? WHERE id = ?`, string(data), id)
+		return err
+	})
+	return record, ok, err
+}
+
+func (d *sqliteStore) GetTeamsHistory() ([]TeamsRecord, error) {
+	rows, err := d.db.Query(`SELECT record FROM teams_history ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []TeamsRecord
+	for rows.Next() {
+		var recordData string
+		if err := rows.Scan(&recordData); err != nil {
+			return nil, err
+		}
+		var record TeamsRecord
+		if err := json.Unmarshal([]byte(recordData), &record); err != nil {
+			return nil, err
+		}
+		history = append(history, record)
+	}
+	return history, rows.Err()
+}
+
+func (d *sqliteStore) GetSchedule() (schedule Schedule, ok bool, err error) {
+	var data string
+	err = d.db.QueryRow(`SELECT data FROM schedule WHERE id = 1`).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return schedule, false, nil
+	}
+	if err != nil {
+		return schedule, false, err
+	}
+	err = json.Unmarshal([]byte(data), &schedule)
+	return schedule, schedule.Format != "", err
+}
+
+func (d *sqliteStore) SaveSchedule(schedule Schedule) error {
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec(`INSERT INTO schedule (id, data) VALUES (1, ?)
+		ON CONFLICT (id) DO UPDATE SET data = excluded.data`, string(data))
+	return err
+}
+
+func (d *sqliteStore) GetTournament() (tournament Tournament, ok bool, err error) {
+	var data string
+	err = d.db.QueryRow(`SELECT data FROM tournament WHERE id = 1`).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tournament, false, nil
+	}
+	if err != nil {
+		return tournament, false, err
+	}
+	err = json.Unmarshal([]byte(data), &tournament)
+	return tournament, tournament.Format != "", err
+}
+
+func (d *sqliteStore) SaveTournament(tournament Tournament) error {
+	data, err := json.Marshal(tournament)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec(`INSERT INTO tournament (id, data) VALUES (1, ?)
+		ON CONFLICT (id) DO UPDATE SET data = excluded.data`, string(data))
+	return err
+}
@@ -0,0 +1,504 @@
+package commands
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// forEachBackend runs the test against a new server stored by each storage backend
+func forEachBackend(t *testing.T, test func(t *testing.T, data *serverData)) {
+	for _, backend := range []string{JSONBackend, SQLiteBackend} {
+		t.Run(backend, func(t *testing.T) {
+			prevBackend, prevDirectory := storageBackend, dataDirectory
+			t.Cleanup(func() {
+				storageBackend, dataDirectory = prevBackend, prevDirectory
+			})
+			storageBackend, dataDirectory = backend, t.TempDir()
+
+			data, err := newServerData("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { data.Close() })
+			test(t, data)
+		})
+	}
+}
+
+func TestChannels(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, data *serverData) {
+		settings, err := data.GetSettings()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if settings.allowsChannel("10") {
+			t.Error("a server without channels allows every channel")
+		}
+
+		if err := data.SeedChannels([]string{"10", "11"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := data.SetChannelAllowed("11", false); err != nil {
+			t.Fatal(err)
+		}
+		// channels chosen with /config channels are never replaced by the seeded channels
+		if err := data.SeedChannels([]string{"12"}); err != nil {
+			t.Fatal(err)
+		}
+		settings, _ = data.GetSettings()
+		if !slices.Equal(settings.ChannelIDs, []string{"10"}) {
+			t.Errorf("channels %v, want [10]", settings.ChannelIDs)
+		}
+
+		if _, err := data.SetChannelAllowed("10", false); err != nil {
+			t.Fatal(err)
+		}
+		settings, _ = data.GetSettings()
+		if settings.allowsChannel("10") {
+			t.Error("removing the last channel allows every channel")
+		}
+
+		if err := data.SetAllChannelsAllowed(true); err != nil {
+			t.Fatal(err)
+		}
+		settings, _ = data.GetSettings()
+		if !settings.allowsChannel("13") {
+			t.Error("every channel is allowed but channel 13 is not")
+		}
+	})
+}
+
+func TestSeedChannelsOnOpen(t *testing.T) {
+	prevDirectory, prevAllowAny := dataDirectory, allowAnyServer
+	t.Cleanup(func() {
+		dataDirectory, allowAnyServer = prevDirectory, prevAllowAny
+		delete(seedChannels, "7")
+		CloseServer("7")
+	})
+	dataDirectory, allowAnyServer = t.TempDir(), true
+
+	SetServerChannels("7", []string{"70"})
+	data, err := getServerData("7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err := data.GetSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !settings.allowsChannel("70") || settings.allowsChannel("71") {
+		t.Errorf("channels %v, want the configured channel 70", settings.ChannelIDs)
+	}
+}
+
+func TestRecordMatchRepeated(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, data *serverData) {
+		for _, id := range []string{"a", "b"} {
+			if err := data.SaveGuest(id, id, 5, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		now := time.Now()
+		match := Match{Time: now, Winners: []string{"a"}, Losers: []string{"b"}, InteractionID: "1"}
+		if _, _, err := data.RecordMatch(match, SkillEdit{}); err != nil {
+			t.Fatal(err)
+		}
+		ratings, _ := data.GetPlayers()
+
+		match.Time = now.Add(time.Second)
+		if _, _, err := data.RecordMatch(match, SkillEdit{}); !errors.Is(err, errRepeatedMatch) {
+			t.Errorf("repeated report error %v, want %v", err, errRepeatedMatch)
+		}
+		if players, _ := data.GetPlayers(); players["a"].Rating != ratings["a"].Rating {
+			t.Error("a repeated report changed the ratings")
+		}
+
+		// a rematch with the same result is recorded straight away when reported again
+		match.InteractionID = "2"
+		if _, _, err := data.RecordMatch(match, SkillEdit{}); err != nil {
+			t.Fatal(err)
+		}
+		if matches, _ := data.GetMatches(time.Time{}); len(matches) != 2 || matches[1].InteractionID != "2" {
+			t.Errorf("matches %+v, want 2 recorded", matches)
+		}
+	})
+}
+
+func TestRecordMatchMargin(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, data *serverData) {
+		for _, id := range []string{"a", "b", "c", "d"} {
+			if err := data.SaveGuest(id, id, 50, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		closeMatch := Match{Winners: []string{"a"}, Losers: []string{"b"}, WinnerScore: 25, LoserScore: 23}
+		blowout := Match{Winners: []string{"c"}, Losers: []string{"d"}, WinnerScore: 25, LoserScore: 5}
+		for _, match := range []Match{closeMatch, blowout} {
+			if _, _, err := data.RecordMatch(match, SkillEdit{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		players, _ := data.GetPlayers()
+		if players["c"].Rating.Mu <= players["a"].Rating.Mu || players["d"].Rating.Mu >= players["b"].Rating.Mu {
+			t.Errorf("ratings %+v, want the blowout to move ratings further than the close match", players)
+		}
+	})
+}
+
+func TestRecordMatchSkipsUnranked(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, data *serverData) {
+		for id, skill := range map[string]int{"a": 50, "b": -1, "c": 50} {
+			if err := data.SaveGuest(id, id, skill, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		match := Match{Winners: []string{"a", "b"}, Losers: []string{"c"}}
+		winners, _, err := data.RecordMatch(match, SkillEdit{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(winners) != 1 || winners[0].UserID != "a" {
+			t.Errorf("winners %+v, want only a rated", winners)
+		}
+		if players, _ := data.GetPlayers(); players["b"].Skill != -1 || players["b"].Rating.isSet() {
+			t.Errorf("unranked player %+v was rated", players["b"])
+		}
+
+		// a team of only unranked players cannot be rated
+		match = Match{Winners: []string{"b"}, Losers: []string{"c"}}
+		if _, _, err := data.RecordMatch(match, SkillEdit{}); err == nil {
+			t.Error("recorded a match against a team of only unranked players")
+		}
+	})
+}
+
+func TestPlayingCapacity(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, data *serverData) {
+		if _, err := data.SetMaxPlayers(2); err != nil {
+			t.Fatal(err)
+		}
+		waitlisted, err := data.AddPlayingUsers("a", "b", "c", "d")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(waitlisted, []string{"c", "d"}) {
+			t.Errorf("waitlisted %v, want [c d]", waitlisted)
+		}
+
+		removed, promoted, err := data.RemovePlayingUsers("a", "e")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(removed, []string{"a"}) {
+			t.Errorf("removed %v, want only a who was playing", removed)
+		}
+		if !slices.Equal(promoted, []string{"c"}) {
+			t.Errorf("promoted %v after a left, want [c]", promoted)
+		}
+		if removed, _, err = data.RemovePlayingUsers("a"); err != nil || len(removed) != 0 {
+			t.Errorf("removed %v and error %v after a already left, want none", removed, err)
+		}
+		if promoted, err = data.SetMaxPlayers(3); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(promoted, []string{"d"}) {
+			t.Errorf("promoted %v after the limit was raised, want [d]", promoted)
+		}
+		if playing, waitlisted, _ := data.GetPlayingCount(); playing != 3 || waitlisted != 0 {
+			t.Errorf("%d playing and %d waitlisted, want 3 and 0", playing, waitlisted)
+		}
+	})
+}
+
+func TestUpdateLastTeams(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, data *serverData) {
+		update := func(record *TeamsRecord) bool {
+			record.Teams[0], record.Bench = append(record.Teams[0], record.Bench[0]), nil
+			return true
+		}
+		if _, ok, err := data.UpdateLastTeams(update); err != nil || ok {
+			t.Fatalf("ok %t and error %v without saved teams, want false and nil", ok, err)
+		}
+
+		now := time.Now()
+		for i := 0; i < 2; i++ {
+			record := TeamsRecord{
+				Time:  now.Add(time.Duration(i) * time.Minute),
+				Teams: [][]TeamsRecordPlayer{{{ID: "a"}}, {{ID: "b"}}},
+				Bench: []TeamsRecordPlayer{{ID: "c"}},
+			}
+			if err := data.SaveTeams(record); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// an update which changes nothing is not saved
+		if _, _, err := data.UpdateLastTeams(func(record *TeamsRecord) bool {
+			record.Bench = nil
+			return false
+		}); err != nil {
+			t.Fatal(err)
+		}
+		record, ok, err := data.UpdateLastTeams(update)
+		if err != nil || !ok {
+			t.Fatalf("ok %t and error %v, want true and nil", ok, err)
+		}
+		if len(record.Teams[0]) != 2 || record.Bench != nil {
+			t.Errorf("updated teams %+v, want c moved from the bench to the first team", record)
+		}
+
+		history, err := data.GetTeamsHistory()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 2 || len(history[0].Teams[0]) != 2 || len(history[1].Teams[0]) != 1 {
+			t.Errorf("history %+v, want only the most recent teams updated", history)
+		}
+
+		// the returned records do not share their teams with the saved ones
+		record.Teams[0][0].ID = "x"
+		history[0].Teams[1][0].ID = "y"
+		history[0].Bench = append(history[0].Bench, TeamsRecordPlayer{ID: "z"})
+		if history, err = data.GetTeamsHistory(); err != nil {
+			t.Fatal(err)
+		}
+		if last := history[0]; last.Teams[0][0].ID != "a" || last.Teams[1][0].ID != "b" || len(last.Bench) != 0 {
+			t.Errorf("saved teams %+v changed along with the returned records", last)
+		}
+	})
+}
+
+func TestDeleteUsers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, data *serverData) {
+		for _, id := range []string{"a", "b", "c"} {
+			if err := data.SaveGuest(id, id, 5, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := data.SetMaxPlayers(2); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := data.AddPlayingUsers("a", "b", "c"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := data.DeleteUsers("a"); err != nil {
+			t.Fatal(err)
+		}
+		playing, err := data.GetPlaying()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(playing) != 2 || playing[0].ID != "b" || playing[1].ID != "c" {
+			t.Errorf("playing %+v after a was deleted, want b and c", playing)
+		}
+		if _, found, _ := data.GetPlayer("a"); found {
+			t.Error("deleted user a is still saved")
+		}
+		if err := data.DeleteUsers("a"); err == nil {
+			t.Error("deleting a missing user did not fail")
+		}
+	})
+}
+
+func TestRevertSkillChange(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, data *serverData) {
+		if err := data.SaveGuest("a", "a", 5, true); err != nil {
+			t.Fatal(err)
+		}
+		for _, skill := range []int{7, 9} {
+			if err := data.SetPlayerSkill("a", skill, SkillEdit{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		reverted, err := data.RevertSkillChange("a", 2, SkillEdit{Reason: "revert"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reverted.Before != 5 || reverted.After != 7 {
+			t.Errorf("reverted %d to %d, want 5 to 7", reverted.Before, reverted.After)
+		}
+		if player, _, _ := data.GetPlayer("a"); player.Skill != 5 {
+			t.Errorf("skill %d after the revert, want 5", player.Skill)
+		}
+		history, err := data.GetSkillHistory("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 3 || history[0].Before != 9 || history[0].After != 5 || history[0].Reason != "revert" {
+			t.Errorf("history %+v, want the revert from 9 to 5 first", history)
+		}
+		if _, err := data.RevertSkillChange("a", 4, SkillEdit{}); err == nil {
+			t.Error("reverting past the end of the history did not fail")
+		}
+	})
+}
+
+func TestOpenCloseServer(t *testing.T) {
+	for _, backend := range []string{JSONBackend, SQLiteBackend} {
+		t.Run(backend, func(t *testing.T) {
+			prevBackend, prevDirectory, prevAllowAny := storageBackend, dataDirectory, allowAnyServer
+			t.Cleanup(func() {
+				storageBackend, dataDirectory, allowAnyServer = prevBackend, prevDirectory, prevAllowAny
+				CloseServer("8")
+			})
+			storageBackend, dataDirectory, allowAnyServer = backend, t.TempDir(), true
+
+			if err := OpenServer("8"); err != nil {
+				t.Fatal(err)
+			}
+			data, _ := getServerData("8")
+			if err := data.SaveGuest("a", "a", 5, true); err != nil {
+				t.Fatal(err)
+			}
+
+			// the data of a server spike is removed from stays open while an interaction uses it
+			inUse, err := acquireServerData("8")
+			if err != nil {
+				t.Fatal(err)
+			}
+			CloseServer("8")
+			if _, _, err := inUse.GetPlayer("a"); err != nil {
+				t.Errorf("data in use was closed: %v", err)
+			}
+			// and is used again if spike is invited back before it is released
+			if err := OpenServer("8"); err != nil {
+				t.Fatal(err)
+			}
+			if reopened, _ := getServerData("8"); reopened != inUse {
+				t.Error("reopening a server in use opened its data a second time")
+			}
+			inUse.release()
+			if _, ok := servers.ReadSafe("8"); !ok {
+				t.Error("the data of a server spike was invited back to was closed once released")
+			}
+
+			CloseServer("8")
+			if _, ok := servers.ReadSafe("8"); ok {
+				t.Fatal("the data of an unused server was not closed")
+			}
+			if err := OpenServer("8"); err != nil {
+				t.Fatal(err)
+			}
+			reopened, _ := getServerData("8")
+			if _, found, err := reopened.GetPlayer("a"); err != nil || !found {
+				t.Errorf("found %t and error %v after reopening, want the saved guest", found, err)
+			}
+		})
+	}
+}
+
+func TestSkillChangeNotSavedWithoutHistory(t *testing.T) {
+	store := newJSONStore(t.TempDir())
+	if err := store.SaveGuest("a", "a", 5, true); err != nil {
+		t.Fatal(err)
+	}
+	store.SkillHistory.checkValid = func(*[]SkillHistoryEntry) bool { return false }
+
+	if err := store.SetPlayerSkill("a", 10, SkillEdit{}); err == nil {
+		t.Error("set a skill rank whose history could not be saved")
+	}
+	if _, _, err := store.ModifyPlayerSkill("a", 3, SkillEdit{}); err == nil {
+		t.Error("modified a skill rank whose history could not be saved")
+	}
+	if player, _, _ := store.GetPlayer("a"); player.Skill != 5 {
+		t.Errorf("skill %d, want 5 left unchanged", player.Skill)
+	}
+	if history, _ := store.GetSkillHistory("a"); len(history) != 0 {
+		t.Errorf("history %+v, want none", history)
+	}
+}
+
+func TestImportJSONIntoSQLite(t *testing.T) {
+	dir := t.TempDir()
+	j := newJSONStore(dir)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := j.SaveGuest(id, id, 50, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	steps := []error{
+		j.SetCommandPermission("skill", PermissionRule{RoleIDs: []string{"10"}}),
+		j.SetPlayerSkill("c", 40, SkillEdit{ActorName: "admin"}),
+		j.RecordAttendance([]string{"a", "b"}, now),
+		j.SaveTeams(TeamsRecord{Time: now, Teams: [][]TeamsRecordPlayer{{{ID: "a"}}, {{ID: "b"}}}}),
+		j.AddTeamConstraint(TeamConstraint{Kind: constraintApart, UserIDs: [2]string{"a", "b"}}),
+	}
+	_, waitErr := j.AddPlayingUsers("a", "b")
+	_, _, matchErr := j.RecordMatch(Match{Time: now, Winners: []string{"a"}, Losers: []string{"b"}}, SkillEdit{})
+	for _, err := range append(steps, waitErr, matchErr) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, _ := j.GetPlayers()
+
+	d, err := newSQLiteStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	players, err := d.GetPlayers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, player := range want {
+		got := players[id]
+		if got.Name != player.Name || got.Skill != player.Skill || got.Rating != player.Rating ||
+			got.Stats.Sessions != player.Stats.Sessions || got.Stats.Wins != player.Stats.Wins {
+			t.Errorf("imported player %+v, want %+v", got, player)
+		}
+	}
+	if settings, _ := d.GetSettings(); len(settings.Permissions["skill"].RoleIDs) != 1 {
+		t.Errorf("imported settings %+v, want the skill permission", settings)
+	}
+	if playing, _ := d.GetPlaying(); len(playing) != 2 || playing[0].ID != "a" {
+		t.Errorf("imported playing group %+v, want a and b", playing)
+	}
+	if history, _ := d.GetSkillHistory("c"); len(history) != 1 || history[0].ActorName != "admin" {
+		t.Errorf("imported skill history %+v, want the change to c", history)
+	}
+	if matches, _ := d.GetMatches(time.Time{}); len(matches) != 1 || matches[0].Winners[0] != "a" {
+		t.Errorf("imported matches %+v, want the match a won", matches)
+	}
+	if attendance, _ := d.GetAttendance(time.Time{}); len(attendance) != 2 {
+		t.Errorf("imported attendance %+v, want a and b", attendance)
+	}
+	if teams, _ := d.GetTeamsHistory(); len(teams) != 1 {
+		t.Errorf("imported teams %+v, want the saved teams", teams)
+	}
+	if constraints, _ := d.GetTeamConstraints(); len(constraints) != 1 || !constraints[0].isPair("b", "a") {
+		t.Errorf("imported constraints %+v, want a and b apart", constraints)
+	}
+
+	// the data is only imported into a new database
+	if err := d.SaveGuest("d", "d", 50, true); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+	if d, err = newSQLiteStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if players, _ := d.GetPlayers(); len(players) != 4 {
+		t.Errorf("%d players after reopening, want 4", len(players))
+	}
+}
+
+func TestImportInvalidJSON(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, playerDataFileName+".json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newSQLiteStore(dir); err == nil {
+		t.Fatal("opened a server whose JSON data could not be imported")
+	}
+	// the import is tried again rather than leaving an empty database behind
+	if _, err := os.Stat(filepath.Join(dir, sqliteFileName)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("database left after a failed import: %v", err)
+	}
+}
@@ -3,16 +3,18 @@ package commands
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	dg "github.com/bwmarrin/discordgo"
 )
 
+// getPersistentServerData returns the data of the interaction's server, which must be released
+// once the interaction is handled
 func getPersistentServerData(session *dg.Session, interaction *dg.InteractionCreate) (*serverData, error) {
-	data, ok := servers.ReadSafe(interaction.GuildID)
-	if !ok {
-		return nil, fmt.Errorf("serverID not recognized: %s", interaction.GuildID)
+	if interaction.GuildID == "" {
+		return nil, errors.New("spike's commands can only be used in a server")
 	}
-	return data, nil
+	return acquireServerData(interaction.GuildID)
 }
 
 func getUserName(serverData *serverData, serverID, userID string, session *dg.Session) (string, error) {
@@ -93,17 +95,76 @@ func getNameFromMember(member *dg.Member) string {
 }
 
 func getNumPlayingString(serverData *serverData) (string, error) {
-	numPlaying, err := serverData.GetPlayingCount()
+	numPlaying, numWaitlisted, err := serverData.GetPlayingCount()
 	if err != nil {
 		return "", err
 	}
-	if numPlaying == 0 {
+	if numPlaying == 0 && numWaitlisted == 0 {
 		return "", nil
 	}
-	return fmt.Sprintf("\n%d in playing group", numPlaying), nil
+	settings, err := serverData.GetSettings()
+	if err != nil {
+		return "", err
+	}
+
+	str := fmt.Sprintf("\n%d in playing group", numPlaying)
+	if settings.MaxPlayers > 0 {
+		str = fmt.Sprintf("\n%d/%d in playing group", numPlaying, settings.MaxPlayers)
+	}
+	if numWaitlisted > 0 {
+		str = fmt.Sprintf("%s, %d on the waitlist", str, numWaitlisted)
+	}
+	return str, nil
 }
 
-func SetServerIDs(serverIDs []string) {
-	setPlayersAndPlayingServerIDs(serverIDs)
-	setLastTeamsOptionsServerIDs(serverIDs)
+// getWaitlistChangesString lists the users who were put on the waitlist because the playing group
+// was full and announces the users who were moved from the waitlist into the playing group.
+func getWaitlistChangesString(serverData *serverData, waitlisted, promoted []string) (string, error) {
+	if len(waitlisted) == 0 && len(promoted) == 0 {
+		return "", nil
+	}
+	players, err := serverData.GetPlayers()
+	if err != nil {
+		return "", err
+	}
+
+	str := ""
+	if len(waitlisted) > 0 {
+		str = fmt.Sprintf("%s\n\nThe playing group is full, added to the waitlist:", str)
+		for _, userID := range waitlisted {
+			str = fmt.Sprintf("%s\n\t%s", str, players[userID].Name)
+		}
+	}
+	if len(promoted) > 0 {
+		str = fmt.Sprintf("%s\n\nMoved from the waitlist into the playing group:", str)
+		for _, userID := range promoted {
+			str = fmt.Sprintf("%s\n\t%s", str, getMention(userID, players[userID]))
+		}
+	}
+	return str, nil
+}
+
+// getMention returns a mention of the player which notifies them, or their name if they are a guest
+func getMention(userID string, player Player) string {
+	if strings.HasPrefix(userID, "g") {
+		return player.Name
+	}
+	return fmt.Sprintf("<@%s>", userID)
+}
+
+// getSkillEdit describes a change to skill ranks made by the user who created the interaction
+func getSkillEdit(interaction *dg.InteractionCreate, reason string) SkillEdit {
+	return SkillEdit{
+		ActorID:   interaction.Member.User.ID,
+		ActorName: getNameFromMember(interaction.Member),
+		Reason:    reason,
+	}
+}
+
+// getOptionalString returns the value of the string option at index, or "" if it was not given
+func getOptionalString(options []*dg.ApplicationCommandInteractionDataOption, index int) string {
+	if len(options) > index {
+		return options[index].StringValue()
+	}
+	return ""
 }
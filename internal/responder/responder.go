@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
+	"unicode/utf8"
 
 	dg "github.com/bwmarrin/discordgo"
 	log "github.com/sirupsen/logrus"
@@ -21,74 +23,99 @@ func InteractionRespondf(session *dg.Session, interaction *dg.InteractionCreate,
 	return r.InteractionRespondf(session, interaction, message, a...)
 }
 
-func InteractionContinue(session *dg.Session, interaction *dg.InteractionCreate) error {
-	return r.InteractionContinue(session, interaction)
+func InteractionPage(session *dg.Session, interaction *dg.InteractionCreate) error {
+	return r.InteractionPage(session, interaction)
+}
+
+// InteractionRespondEphemeral responds with a message only visible to the user who created the
+// interaction
+func InteractionRespondEphemeral(session *dg.Session, interaction *dg.InteractionCreate, message string) error {
+	return r.InteractionRespondEphemeral(session, interaction, message)
+}
+
+// IsPageComponent reports whether a message component custom ID belongs to a page button
+func IsPageComponent(customID string) bool {
+	return customID == prevPageID || customID == nextPageID
 }
 
 type ResponseManager interface {
 	InteractionRespond(session *dg.Session, interaction *dg.InteractionCreate, message string) error
 	InteractionRespondf(session *dg.Session, interaction *dg.InteractionCreate, message string, a ...any) error
-	InteractionContinue(session *dg.Session, interaction *dg.InteractionCreate) error
+	InteractionPage(session *dg.Session, interaction *dg.InteractionCreate) error
+	InteractionRespondEphemeral(session *dg.Session, interaction *dg.InteractionCreate, message string) error
 }
 
-type responseBuffer struct {
-	message string
+// pagedResponse holds every page of a response too long to fit in a single message
+type pagedResponse struct {
+	pages   []string
+	page    int
+	expires time.Time
 	mutex   sync.Mutex
 }
 
 type responseManager struct {
-	responseBuffers map[string]*responseBuffer
-	mapLock         sync.RWMutex
+	// paged responses keyed by the ID of the message displaying them
+	pagedResponses map[string]*pagedResponse
+	mapLock        sync.RWMutex
 }
 
 func newResponseManager() *responseManager {
 	return &responseManager{
-		responseBuffers: map[string]*responseBuffer{},
+		pagedResponses: map[string]*pagedResponse{},
 	}
 }
 
 const maxMessageLen = 2000
 const maxSplitCutoff = 100
 
-const continuePrompt = "\n...\n*/continue to show more*"
+// how long the page buttons of a response keep working
+const pageExpiry = 30 * time.Minute
+
+const (
+	prevPageID      = "responder_prev_page"
+	nextPageID      = "responder_next_page"
+	pageIndicatorID = "responder_page_indicator"
+)
+
+const codeBlock = "```"
 
-var continuePromptLen = len(continuePrompt)
-var maxSplitIndex = maxMessageLen - continuePromptLen
+// room left at the end of each page to close a code block which continues on the next page
+var maxSplitIndex = maxMessageLen - len("\n"+codeBlock)
 var minSplitIndex = maxSplitIndex - maxSplitCutoff
 
+var ErrPageExpired = errors.New("these pages have expired, run the command again to see them")
+
 func (r *responseManager) InteractionRespond(
 	session *dg.Session,
 	interaction *dg.InteractionCreate,
 	message string,
 ) error {
-	if len(message) <= maxMessageLen {
-		err := session.InteractionRespond(interaction.Interaction, &dg.InteractionResponse{
-			Type: dg.InteractionResponseChannelMessageWithSource,
-			Data: &dg.InteractionResponseData{
-				Content: message,
-			},
-		})
-		if err != nil {
-			log.Error(err.Error())
-		}
+	pages := splitPages(message)
+	data := &dg.InteractionResponseData{
+		Content: pages[0],
+	}
+	if len(pages) > 1 {
+		data.Components = pageButtons(0, len(pages))
+	}
+	err := session.InteractionRespond(interaction.Interaction, &dg.InteractionResponse{
+		Type: dg.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+	if err != nil {
+		log.Error(err.Error())
 		return err
 	}
-	splitIndex := maxSplitIndex
-	if index := strings.LastIndex(message[minSplitIndex:maxSplitIndex+1], "\n"); index != -1 {
-		splitIndex = minSplitIndex + index
-	} else if index := strings.LastIndexFunc(message[minSplitIndex:maxSplitIndex+1], func(r rune) bool {
-		return unicode.IsSpace(r)
-	}); index != -1 {
-		splitIndex = minSplitIndex + index
+	if len(pages) == 1 {
+		return nil
 	}
-	messageBuff := make([]byte, 0, splitIndex+continuePromptLen)
-	messageBuff = append(messageBuff, message[:splitIndex]...)
-	messageBuff = append(messageBuff, continuePrompt...)
-	err := r.InteractionRespond(session, interaction, string(messageBuff))
-	if err == nil {
-		r.updateBuffer(interaction.GuildID, strings.TrimSpace(string([]byte(message)[splitIndex:])))
+
+	response, err := session.InteractionResponse(interaction.Interaction)
+	if err != nil {
+		log.Error(err.Error())
+		return err
 	}
-	return err
+	r.savePages(response.ID, pages)
+	return nil
 }
 
 func (r *responseManager) InteractionRespondf(
@@ -100,57 +127,140 @@ func (r *responseManager) InteractionRespondf(
 	return r.InteractionRespond(session, interaction, fmt.Sprintf(message, a...))
 }
 
-var ErrNoResponseContinuation = errors.New("no response output to continue")
-
-func (r *responseManager) InteractionContinue(
+// InteractionRespondEphemeral responds with a single message, so messages too long to fit are cut
+// short rather than paged
+func (r *responseManager) InteractionRespondEphemeral(
 	session *dg.Session,
 	interaction *dg.InteractionCreate,
+	message string,
 ) error {
-	message := r.getBuffer(interaction.GuildID)
-	if message == "" {
-		return ErrNoResponseContinuation
+	err := session.InteractionRespond(interaction.Interaction, &dg.InteractionResponse{
+		Type: dg.InteractionResponseChannelMessageWithSource,
+		Data: &dg.InteractionResponseData{
+			Content: splitPages(message)[0],
+			Flags:   dg.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Error(err.Error())
 	}
-	return r.InteractionRespond(session, interaction, message)
+	return err
 }
 
-func (r *responseManager) updateBuffer(guildID string, message string) {
+// InteractionPage responds to a click on a page button by showing the requested page in place
+func (r *responseManager) InteractionPage(
+	session *dg.Session,
+	interaction *dg.InteractionCreate,
+) error {
 	r.mapLock.RLock()
-	buffer, ok := r.responseBuffers[guildID]
+	response, ok := r.pagedResponses[interaction.Message.ID]
 	r.mapLock.RUnlock()
-	if ok {
-		buffer.mutex.Lock()
-		buffer.message = message
-		buffer.mutex.Unlock()
-		return
+	if !ok || time.Now().After(response.expires) {
+		err := session.InteractionRespond(interaction.Interaction, &dg.InteractionResponse{
+			Type: dg.InteractionResponseChannelMessageWithSource,
+			Data: &dg.InteractionResponseData{
+				Content: ErrPageExpired.Error(),
+				Flags:   dg.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			log.Error(err.Error())
+		}
+		return ErrPageExpired
 	}
 
-	r.mapLock.Lock()
-	buffer, ok = r.responseBuffers[guildID]
-	if !ok {
-		buffer = &responseBuffer{
-			message: message,
+	response.mutex.Lock()
+	switch interaction.MessageComponentData().CustomID {
+	case prevPageID:
+		if response.page > 0 {
+			response.page--
+		}
+	case nextPageID:
+		if response.page < len(response.pages)-1 {
+			response.page++
 		}
-		r.responseBuffers[guildID] = buffer
-		r.mapLock.Unlock()
-		return
 	}
-	r.mapLock.Unlock()
+	page := response.page
+	response.mutex.Unlock()
+
+	err := session.InteractionRespond(interaction.Interaction, &dg.InteractionResponse{
+		Type: dg.InteractionResponseUpdateMessage,
+		Data: &dg.InteractionResponseData{
+			Content:    response.pages[page],
+			Components: pageButtons(page, len(response.pages)),
+		},
+	})
+	if err != nil {
+		log.Error(err.Error())
+	}
+	return err
+}
 
-	buffer.mutex.Lock()
-	buffer.message = message
-	buffer.mutex.Unlock()
+// savePages stores the pages of a response and drops any responses which have expired
+func (r *responseManager) savePages(messageID string, pages []string) {
+	now := time.Now()
+	r.mapLock.Lock()
+	defer r.mapLock.Unlock()
+	for id, response := range r.pagedResponses {
+		if now.After(response.expires) {
+			delete(r.pagedResponses, id)
+		}
+	}
+	r.pagedResponses[messageID] = &pagedResponse{
+		pages:   pages,
+		expires: now.Add(pageExpiry),
+	}
 }
 
-func (r *responseManager) getBuffer(guildID string) string {
-	r.mapLock.RLock()
-	buffer, ok := r.responseBuffers[guildID]
-	r.mapLock.RUnlock()
-	if !ok {
-		return ""
+// splitPages splits a message into pages which each fit in a discord message. Splits are made at a
+// line break or space where possible, and code blocks cut by a split are continued on the next page.
+func splitPages(message string) []string {
+	pages := []string{}
+	for len(message) > maxMessageLen {
+		var page string
+		if index := strings.LastIndex(message[minSplitIndex:maxSplitIndex+1], "\n"); index != -1 {
+			page = message[:minSplitIndex+index]
+			// blank lines are dropped, but the indentation of the next line is kept for code blocks
+			message = strings.TrimLeft(message[minSplitIndex+index:], "\n")
+		} else if index := strings.LastIndexFunc(message[minSplitIndex:maxSplitIndex+1], unicode.IsSpace); index != -1 {
+			page = message[:minSplitIndex+index]
+			_, size := utf8.DecodeRuneInString(message[minSplitIndex+index:])
+			message = message[minSplitIndex+index+size:]
+		} else {
+			// a line without any space is cut where it must be, but never within a character
+			splitIndex := maxSplitIndex
+			for splitIndex > 0 && !utf8.RuneStart(message[splitIndex]) {
+				splitIndex--
+			}
+			page = message[:splitIndex]
+			message = message[splitIndex:]
+		}
+		if strings.Count(page, codeBlock)%2 == 1 {
+			page = page + "\n" + codeBlock
+			message = codeBlock + "\n" + message
+		}
+		pages = append(pages, page)
 	}
-	buffer.mutex.Lock()
-	message := buffer.message
-	buffer.message = ""
-	buffer.mutex.Unlock()
-	return message
+	return append(pages, message)
+}
+
+func pageButtons(page, numPages int) []dg.MessageComponent {
+	return []dg.MessageComponent{dg.ActionsRow{
+		Components: []dg.MessageComponent{dg.Button{
+			Label:    "Prev",
+			Style:    dg.SecondaryButton,
+			Disabled: page == 0,
+			CustomID: prevPageID,
+		}, dg.Button{
+			Label:    fmt.Sprintf("%d/%d", page+1, numPages),
+			Style:    dg.SecondaryButton,
+			Disabled: true,
+			CustomID: pageIndicatorID,
+		}, dg.Button{
+			Label:    "Next",
+			Style:    dg.SecondaryButton,
+			Disabled: page == numPages-1,
+			CustomID: nextPageID,
+		}},
+	}}
 }
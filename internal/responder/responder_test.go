@@ -0,0 +1,63 @@
+package responder
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitPages(t *testing.T) {
+	line := strings.Repeat("x", 99)
+	lines := strings.TrimSuffix(strings.Repeat(line+"\n", 30), "\n")
+	table := strings.TrimSuffix(strings.Repeat("  "+line[2:]+"\n", 30), "\n")
+
+	tests := []struct {
+		name      string
+		message   string
+		wantPages int
+		// the separator dropped at each split
+		separator string
+	}{
+		{name: "short", message: "hello", wantPages: 1},
+		{name: "exactly the limit", message: strings.Repeat("a", maxMessageLen), wantPages: 1},
+		{name: "one over the limit", message: strings.Repeat("a", maxMessageLen+1), wantPages: 2},
+		{name: "lines", message: lines, wantPages: 2, separator: "\n"},
+		{name: "words", message: strings.Repeat("word ", 500), wantPages: 2, separator: " "},
+		{name: "one long line", message: strings.Repeat("a", 5*maxMessageLen), wantPages: 6},
+		{name: "two byte characters", message: strings.Repeat("é", maxMessageLen), wantPages: 3},
+		{name: "three byte characters", message: strings.Repeat("€", maxMessageLen), wantPages: 4},
+		{name: "four byte characters", message: strings.Repeat("🏐", maxMessageLen), wantPages: 5},
+		{name: "code block", message: codeBlock + "\n" + table + "\n" + codeBlock, wantPages: 2, separator: "\n"},
+	}
+	for _, test := range tests {
+		pages := splitPages(test.message)
+		if len(pages) != test.wantPages {
+			t.Errorf("%s: %d pages, want %d", test.name, len(pages), test.wantPages)
+		}
+		for i, page := range pages {
+			if len(page) > maxMessageLen {
+				t.Errorf("%s: page %d is %d bytes long, want at most %d", test.name, i+1, len(page), maxMessageLen)
+			}
+			if !utf8.ValidString(page) {
+				t.Errorf("%s: page %d splits a character", test.name, i+1)
+			}
+			if strings.Count(page, codeBlock)%2 != 0 {
+				t.Errorf("%s: page %d leaves a code block open", test.name, i+1)
+			}
+		}
+
+		// the pages read as the message once the splits and the code blocks continued across them are
+		// taken out
+		joined := pages[0]
+		for _, page := range pages[1:] {
+			if strings.HasSuffix(joined, "\n"+codeBlock) && strings.HasPrefix(page, codeBlock+"\n") {
+				joined = strings.TrimSuffix(joined, "\n"+codeBlock)
+				page = strings.TrimPrefix(page, codeBlock+"\n")
+			}
+			joined += test.separator + page
+		}
+		if joined != test.message {
+			t.Errorf("%s: pages %q do not join back into the message", test.name, pages)
+		}
+	}
+}